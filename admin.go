@@ -0,0 +1,345 @@
+package failure
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminHandler - read-only http view of a node's client table
+type adminHandler struct {
+	node *Node
+}
+
+// AdminHandler - http.Handler serving the node's client table as JSON && a live dashboard,
+// mount it w. http.StripPrefix to serve under a sub-path:
+//
+//	GET /                       -> live dashboard, see: dashboard.go
+//	GET /events                 -> client table as a stream of server-sent events
+//	GET /clients                -> every client, see: clientFilter for query params
+//	GET /clients/{addr}         -> a single client (addr path-escaped) && its full interval window
+//	GET /clients/{addr}/history -> the client's phi history, `since` a duration ago (e.g. 5m)
+//	                               or an RFC 3339 time
+func (n *Node) AdminHandler() http.Handler {
+	return &adminHandler{node: n}
+}
+
+// adminFloat - float64 that encodes NaN && +/-Inf (e.g. phi of a client that's certainly gone)
+// as the strings "NaN", "+Inf" && "-Inf", which encoding/json refuses to encode as numbers
+type adminFloat float64
+
+func (f adminFloat) MarshalJSON() ([]byte, error) {
+	switch v := float64(f); {
+	case math.IsNaN(v):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(v, 1):
+		return []byte(`"+Inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-Inf"`), nil
+	}
+	return json.Marshal(float64(f))
+}
+
+func (f *adminFloat) UnmarshalJSON(b []byte) error {
+	switch string(b) {
+	case `"NaN"`:
+		*f = adminFloat(math.NaN())
+	case `"+Inf"`:
+		*f = adminFloat(math.Inf(1))
+	case `"-Inf"`:
+		*f = adminFloat(math.Inf(-1))
+	default:
+		return json.Unmarshal(b, (*float64)(f))
+	}
+	return nil
+}
+
+// adminClient - JSON view of a ClientStatus
+type adminClient struct {
+	ClientID      string     `json:"client_addr"`
+	AppID         string     `json:"client_app_id"`
+	Addr          string     `json:"client_serving_addr"`
+	State         string     `json:"state"`
+	Phi           adminFloat `json:"phi"`
+	LastHeartbeat time.Time  `json:"last_heartbeat"`
+	Samples       int        `json:"samples"`
+	Mean          adminFloat `json:"interval_mean"`
+	StdDev        adminFloat `json:"interval_stddev"`
+}
+
+// adminClientDetail - response to GET /clients/{addr}
+type adminClientDetail struct {
+	adminClient
+	Intervals []adminFloat `json:"intervals"` // ms, oldest first
+}
+
+// adminSample - JSON view of a PhiSample
+type adminSample struct {
+	Time      time.Time  `json:"time"`
+	Phi       adminFloat `json:"phi"`
+	Interval  adminFloat `json:"interval"`
+	Heartbeat bool       `json:"heartbeat"`
+}
+
+// adminTable - response to GET /clients
+type adminTable struct {
+	ServerAppID string        `json:"server_app_id"`
+	ServerAddr  string        `json:"server_addr"`
+	Time        time.Time     `json:"time"`
+	Clients     []adminClient `json:"clients"`
+}
+
+// adminError - body of every non-2xx response
+type adminError struct {
+	Error string `json:"error"`
+}
+
+func newAdminClient(status ClientStatus) adminClient {
+	return adminClient{
+		ClientID:      status.ClientID,
+		AppID:         status.AppID,
+		Addr:          status.Addr,
+		State:         status.State.String(),
+		Phi:           adminFloat(status.Phi),
+		LastHeartbeat: status.LastHeartbeat,
+		Samples:       status.Samples,
+		Mean:          adminFloat(status.Mean),
+		StdDev:        adminFloat(status.StdDev),
+	}
+}
+
+// clientSortKeys - values of `sort` (optionally prefixed w. `-` for descending) && the
+// ordering they apply
+var clientSortKeys = map[string]func(a, b *ClientStatus) bool{
+	"client_addr":     func(a, b *ClientStatus) bool { return a.ClientID < b.ClientID },
+	"client_app_id":   func(a, b *ClientStatus) bool { return a.AppID < b.AppID },
+	"state":           func(a, b *ClientStatus) bool { return a.State < b.State },
+	"phi":             func(a, b *ClientStatus) bool { return lessNaNFirst(a.Phi, b.Phi) },
+	"last_heartbeat":  func(a, b *ClientStatus) bool { return a.LastHeartbeat.Before(b.LastHeartbeat) },
+	"samples":         func(a, b *ClientStatus) bool { return a.Samples < b.Samples },
+	"interval_mean":   func(a, b *ClientStatus) bool { return lessNaNFirst(a.Mean, b.Mean) },
+	"interval_stddev": func(a, b *ClientStatus) bool { return lessNaNFirst(a.StdDev, b.StdDev) },
+}
+
+// lessNaNFirst - a < b w. NaN (e.g. phi before a client has samples) ordered before any number
+func lessNaNFirst(a, b float64) bool {
+	if math.IsNaN(a) {
+		return !math.IsNaN(b)
+	}
+	return a < b
+}
+
+// clientFilter - query params for GET /clients, all optional:
+//
+//	state=healthy,suspected -> only clients in one of the listed states
+//	client_app_id=worker    -> only clients of the app
+//	min_phi=4               -> only clients w. phi >= min_phi
+//	sort=-phi               -> order by a clientSortKeys key, `-` for descending; default client_addr
+//	limit=10                -> at most limit clients, after sorting
+type clientFilter struct {
+	states map[ClientState]bool
+	appID  string
+	minPhi *float64
+	less   func(a, b *ClientStatus) bool
+	desc   bool
+	limit  int
+}
+
+// parseClientFilter - filter from the request's query params
+func parseClientFilter(r *http.Request) (*clientFilter, error) {
+
+	var (
+		q      = r.URL.Query()
+		filter = &clientFilter{
+			appID: q.Get("client_app_id"),
+			less:  clientSortKeys["client_addr"],
+		}
+		err error
+	)
+
+	if states := q.Get("state"); states != "" {
+		filter.states = make(map[ClientState]bool)
+		for _, s := range strings.Split(states, ",") {
+			state, err := ParseClientState(s)
+			if err != nil {
+				return nil, err
+			}
+			filter.states[state] = true
+		}
+	}
+
+	if minPhi := q.Get("min_phi"); minPhi != "" {
+		phi, err := strconv.ParseFloat(minPhi, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_phi %q", minPhi)
+		}
+		filter.minPhi = &phi
+	}
+
+	if key := q.Get("sort"); key != "" {
+		filter.desc = strings.HasPrefix(key, "-")
+		less, ok := clientSortKeys[strings.TrimPrefix(key, "-")]
+		if !ok {
+			return nil, fmt.Errorf("invalid sort %q", key)
+		}
+		filter.less = less
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		if filter.limit, err = strconv.Atoi(limit); err != nil || filter.limit < 0 {
+			return nil, fmt.Errorf("invalid limit %q", limit)
+		}
+	}
+	return filter, nil
+}
+
+// apply - filtered && sorted copy of statuses
+func (f *clientFilter) apply(statuses []ClientStatus) []ClientStatus {
+
+	matched := make([]ClientStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if f.states != nil && !f.states[status.State] {
+			continue
+		}
+		if f.appID != "" && status.AppID != f.appID {
+			continue
+		}
+		// NaN phi never matches min_phi
+		if f.minPhi != nil && !(status.Phi >= *f.minPhi) {
+			continue
+		}
+		matched = append(matched, status)
+	}
+
+	// stable over the node's client_addr ordering, so ties stay deterministic
+	sort.SliceStable(matched, func(i, j int) bool {
+		if f.desc {
+			return f.less(&matched[j], &matched[i])
+		}
+		return f.less(&matched[i], &matched[j])
+	})
+
+	if f.limit > 0 && len(matched) > f.limit {
+		matched = matched[:f.limit]
+	}
+	return matched
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeAdminJSON(w, http.StatusMethodNotAllowed, adminError{Error: "method not allowed"})
+		return
+	}
+
+	switch path := strings.TrimSuffix(r.URL.Path, "/"); {
+	case path == "":
+		h.serveDashboard(w, r)
+	case path == "/events":
+		h.serveEvents(w, r)
+	case path == "/clients":
+		h.serveClients(w, r)
+	case strings.HasPrefix(path, "/clients/") && strings.HasSuffix(path, "/history"):
+		h.serveHistory(w, r, strings.TrimSuffix(strings.TrimPrefix(path, "/clients/"), "/history"))
+	case strings.HasPrefix(path, "/clients/"):
+		h.serveClient(w, strings.TrimPrefix(path, "/clients/"))
+	default:
+		writeAdminJSON(w, http.StatusNotFound, adminError{Error: "not found"})
+	}
+}
+
+// serveClients - GET /clients
+func (h *adminHandler) serveClients(w http.ResponseWriter, r *http.Request) {
+
+	filter, err := parseClientFilter(r)
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, adminError{Error: err.Error()})
+		return
+	}
+
+	writeAdminJSON(w, http.StatusOK, h.table(filter))
+}
+
+// table - the node's current client table, filtered && sorted
+func (h *adminHandler) table(filter *clientFilter) adminTable {
+
+	var (
+		statuses = filter.apply(h.node.Clients())
+		table    = adminTable{
+			ServerAppID: h.node.metadata.AppID,
+			ServerAddr:  h.node.metadata.HostAddress,
+			Time:        h.node.Now(),
+			Clients:     make([]adminClient, len(statuses)),
+		}
+	)
+	for i, status := range statuses {
+		table.Clients[i] = newAdminClient(status)
+	}
+	return table
+}
+
+// serveClient - GET /clients/{addr}
+func (h *adminHandler) serveClient(w http.ResponseWriter, clientID string) {
+
+	status, ok := h.node.Client(clientID)
+	intervals, windowOK := h.node.ClientIntervals(clientID)
+	if !ok || !windowOK {
+		writeAdminJSON(w, http.StatusNotFound, adminError{Error: fmt.Sprintf("no client %q", clientID)})
+		return
+	}
+
+	detail := adminClientDetail{
+		adminClient: newAdminClient(status),
+		Intervals:   make([]adminFloat, len(intervals)),
+	}
+	for i, interval := range intervals {
+		detail.Intervals[i] = adminFloat(interval)
+	}
+	writeAdminJSON(w, http.StatusOK, detail)
+}
+
+// serveHistory - GET /clients/{addr}/history
+func (h *adminHandler) serveHistory(w http.ResponseWriter, r *http.Request, clientID string) {
+
+	var since time.Time
+	if param := r.URL.Query().Get("since"); param != "" {
+		if ago, err := time.ParseDuration(param); err == nil {
+			since = h.node.Now().Add(-ago)
+		} else if since, err = time.Parse(time.RFC3339Nano, param); err != nil {
+			writeAdminJSON(w, http.StatusBadRequest, adminError{Error: fmt.Sprintf("invalid since %q", param)})
+			return
+		}
+	}
+
+	history, ok := h.node.ClientHistory(clientID, since)
+	if !ok {
+		writeAdminJSON(w, http.StatusNotFound, adminError{Error: fmt.Sprintf("no client %q", clientID)})
+		return
+	}
+
+	samples := make([]adminSample, len(history))
+	for i, sample := range history {
+		samples[i] = adminSample{
+			Time:      sample.Time,
+			Phi:       adminFloat(sample.Phi),
+			Interval:  adminFloat(sample.Interval),
+			Heartbeat: sample.Heartbeat,
+		}
+	}
+	writeAdminJSON(w, http.StatusOK, samples)
+}
+
+// writeAdminJSON - write v as the JSON response body w. status code
+func writeAdminJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,123 @@
+package failure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// adminGet - GET path from the node's admin handler, decoding the JSON body into v
+func adminGet(t *testing.T, n *Node, path string, v any) int {
+	rec := httptest.NewRecorder()
+	n.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	return rec.Code
+}
+
+// adminTestNode - node w. a healthy && a suspected worker, && a `cache` client w/o samples yet
+func adminTestNode(t *testing.T) *Node {
+
+	n, clock := newTestNode(&NodeOptions{SuspicionThreshold: 4, PurgeGracePeriod: time.Hour})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000} {
+		beat(n, clock, "10.0.0.3:40000", interval*time.Millisecond)
+	}
+	clock.Advance(5 * time.Second)
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+
+	for _, interval := range []time.Duration{0, 900, 1100} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+	n.ReceiveHeartbeat(context.Background(), "10.0.0.2:40000", &failproto.Beat{ClientID: "cache"})
+
+	require.Equal(t, StateSuspected, n.RecentClients["10.0.0.3:40000"].State())
+	return n
+}
+
+func TestAdminClients(t *testing.T) {
+
+	n := adminTestNode(t)
+
+	var table adminTable
+	require.Equal(t, http.StatusOK, adminGet(t, n, "/clients", &table))
+	assert.Equal(t, "test-node", table.ServerAppID)
+	require.Len(t, table.Clients, 3)
+	assert.Equal(t, "10.0.0.1:40000", table.Clients[0].ClientID)
+
+	// phi of a client w/o samples is NaN && still encodes
+	var raw struct {
+		Clients []map[string]any `json:"clients"`
+	}
+	adminGet(t, n, "/clients?client_app_id=cache", &raw)
+	require.Len(t, raw.Clients, 1)
+	assert.Equal(t, "NaN", raw.Clients[0]["phi"])
+	assert.Equal(t, "unknown", raw.Clients[0]["state"])
+}
+
+func TestAdminClientsFilterAndSort(t *testing.T) {
+
+	n := adminTestNode(t)
+
+	addrs := func(path string) []string {
+		var table adminTable
+		require.Equal(t, http.StatusOK, adminGet(t, n, path, &table))
+		var addrs []string
+		for _, c := range table.Clients {
+			addrs = append(addrs, c.ClientID)
+		}
+		return addrs
+	}
+
+	assert.Equal(t, []string{"10.0.0.3:40000"}, addrs("/clients?state=suspected"))
+	assert.Equal(t, []string{"10.0.0.1:40000", "10.0.0.3:40000"}, addrs("/clients?state=healthy,suspected"))
+	assert.Equal(t, []string{"10.0.0.1:40000", "10.0.0.3:40000"}, addrs("/clients?client_app_id=worker"))
+	assert.Equal(t, []string{"10.0.0.3:40000"}, addrs("/clients?min_phi=4"))
+	assert.Equal(t, []string{"10.0.0.3:40000", "10.0.0.1:40000", "10.0.0.2:40000"}, addrs("/clients?sort=-phi"))
+	assert.Equal(t, []string{"10.0.0.2:40000", "10.0.0.1:40000"}, addrs("/clients?sort=phi&limit=2"))
+	assert.Equal(t, []string{"10.0.0.2:40000", "10.0.0.1:40000", "10.0.0.3:40000"}, addrs("/clients?sort=state"))
+
+	for _, query := range []string{"state=gone", "min_phi=x", "sort=color", "limit=-1"} {
+		var e adminError
+		assert.Equal(t, http.StatusBadRequest, adminGet(t, n, "/clients?"+query, &e), query)
+		assert.NotEmpty(t, e.Error)
+	}
+}
+
+func TestAdminClient(t *testing.T) {
+
+	n := adminTestNode(t)
+
+	var detail adminClientDetail
+	require.Equal(t, http.StatusOK, adminGet(t, n, "/clients/"+url.PathEscape("10.0.0.1:40000"), &detail))
+	assert.Equal(t, "worker", detail.AppID)
+	assert.Equal(t, "healthy", detail.State)
+	assert.Equal(t, []adminFloat{900, 1100}, detail.Intervals)
+
+	var e adminError
+	assert.Equal(t, http.StatusNotFound, adminGet(t, n, "/clients/10.0.0.9:40000", &e))
+	assert.Equal(t, http.StatusNotFound, adminGet(t, n, "/nope", &e))
+
+	rec := httptest.NewRecorder()
+	n.AdminHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/clients", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestIntervalsWrap(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{EstimationWindowSize: 3})
+	for _, interval := range []time.Duration{0, 1, 2, 3, 4, 5} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+	intervals, ok := n.ClientIntervals("10.0.0.1:40000")
+	require.True(t, ok)
+	assert.Equal(t, []float64{3, 4, 5}, intervals)
+}
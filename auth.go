@@ -0,0 +1,302 @@
+package failure
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultAuthMaxSkew - furthest a signed beat's send time may be from the node's clock when
+// AuthOptions.MaxSkew is unset
+const DefaultAuthMaxSkew time.Duration = 30 * time.Second
+
+// AuthMode - how a node decides who sent a heartbeat
+type AuthMode int
+
+const (
+	// AuthNone - every heartbeat is taken at its word
+	AuthNone AuthMode = iota
+
+	// AuthHMAC - heartbeats must be signed w. a key in AuthOptions.Keys, see: SignBeat
+	AuthHMAC
+
+	// AuthMTLS - the client's app ID comes from its verified TLS client certificate, the server
+	// must be set up to verify client certificates (e.g. tls.RequireAndVerifyClientCert)
+	AuthMTLS
+)
+
+// AuthOptions - how a node authenticates the heartbeats its interceptors receive, heartbeats
+// passed to ReceiveHeartbeat directly are trusted
+type AuthOptions struct {
+	Mode     AuthMode
+	Keys     *KeyRing                                     // AuthHMAC, keys beats may be signed w.
+	MaxSkew  time.Duration                                // AuthHMAC, optional, defaults to DefaultAuthMaxSkew
+	Identity func(cert *x509.Certificate) (string, error) // AuthMTLS, optional, app ID for a client certificate, defaults to CertIdentity
+}
+
+// maxSkew - furthest a signed beat's send time may be from the node's clock
+func (o *AuthOptions) maxSkew() time.Duration {
+	if o.MaxSkew > 0 {
+		return o.MaxSkew
+	}
+	return DefaultAuthMaxSkew
+}
+
+// CertIdentity - app ID for a client certificate, its subject's common name or w/o one its
+// first DNS name
+func CertIdentity(cert *x509.Certificate) (string, error) {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName, nil
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0], nil
+	}
+	return "", errors.New("certificate has no common name or DNS name")
+}
+
+// KeyRing - shared HMAC keys by ID, keys can be added && removed while in use to rotate them
+type KeyRing struct {
+	keys map[string][]byte // guarded by mu
+	mu   sync.RWMutex
+}
+
+// NewKeyRing - key ring holding keys (key ID -> secret)
+func NewKeyRing(keys map[string][]byte) *KeyRing {
+	k := &KeyRing{keys: make(map[string][]byte, len(keys))}
+	for id, secret := range keys {
+		k.keys[id] = secret
+	}
+	return k
+}
+
+// Set - add or replace a key
+func (k *KeyRing) Set(id string, secret []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.keys[id] = secret
+}
+
+// Remove - drop a key, beats signed w. it are rejected from then on
+func (k *KeyRing) Remove(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, id)
+}
+
+// secret - secret of the key w. id
+func (k *KeyRing) secret(id string) ([]byte, bool) {
+	if k == nil {
+		return nil, false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	secret, ok := k.keys[id]
+	return secret, ok
+}
+
+// SigningKey - key a publisher signs its beats w., ID names it in the nodes' key rings
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// SignBeat - stamp beat w. its send time && sign it w. key
+func SignBeat(beat *failproto.Beat, key *SigningKey, sentAt time.Time) {
+	beat.SentUnixNano = sentAt.UnixNano()
+	beat.KeyID = key.ID
+	beat.Signature = beatMAC(beat, key.Secret)
+}
+
+// beatMAC - HMAC-SHA256 over every field of the beat but its signature, each length-prefixed
+// so no two beats share an encoding
+func beatMAC(beat *failproto.Beat, secret []byte) []byte {
+
+	var buf []byte
+	for _, s := range []string{beat.ClientID, beat.Addr, beat.KeyID} {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+		buf = append(buf, s...)
+	}
+	buf = binary.BigEndian.AppendUint64(buf, beat.Seq)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(beat.SentUnixNano))
+	if beat.Leave {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(buf)
+	return mac.Sum(nil)
+}
+
+// authError - heartbeat that failed authentication, reason labels the rejection metric
+type authError struct {
+	reason string
+	msg    string
+}
+
+func (e *authError) Error() string {
+	return e.msg
+}
+
+var (
+	errUnsigned         = &authError{reason: "unsigned", msg: "heartbeat is not signed"}
+	errUnknownKey       = &authError{reason: "unknown_key", msg: "heartbeat signed w. an unknown key"}
+	errBadSignature     = &authError{reason: "bad_signature", msg: "heartbeat signature does not match"}
+	errStaleBeat        = &authError{reason: "stale", msg: "heartbeat sent too far from the node's time"}
+	errReplayedBeat     = &authError{reason: "replay", msg: "heartbeat already seen"}
+	errNoCertificate    = &authError{reason: "no_certificate", msg: "no verified client certificate"}
+	errIdentityMismatch = &authError{reason: "identity_mismatch", msg: "heartbeat app ID does not match the client certificate"}
+)
+
+// replayGuard - latest signed beat seen from each sender, a beat must be newer than the last
+// (sent later, or sent at the same time w. a higher seq) to be accepted
+type replayGuard struct {
+	last map[string]replayMark // guarded by mu
+	mu   sync.Mutex
+}
+
+// replayMark - send time && seq of a sender's latest beat
+type replayMark struct {
+	sentUnixNano int64
+	seq          uint64
+}
+
+// accept - note beat from sender if it's newer than the last one
+func (g *replayGuard) accept(sender string, beat *failproto.Beat) bool {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.last == nil {
+		g.last = make(map[string]replayMark)
+	}
+	if last, ok := g.last[sender]; ok {
+		if beat.SentUnixNano < last.sentUnixNano || (beat.SentUnixNano == last.sentUnixNano && beat.Seq <= last.seq) {
+			return false
+		}
+	}
+	g.last[sender] = replayMark{sentUnixNano: beat.SentUnixNano, seq: beat.Seq}
+	return true
+}
+
+// prune - forget senders whose latest beat is older than cutoff, anything they could replay
+// is stale by now
+func (g *replayGuard) prune(cutoff time.Time) {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for sender, last := range g.last {
+		if last.sentUnixNano < cutoff.UnixNano() {
+			delete(g.last, sender)
+		}
+	}
+}
+
+// authenticate - check a heartbeat per NodeOptions.Auth, returns the beat to process (w. its app
+// ID from the client certificate under AuthMTLS) or an Unauthenticated error. Rejections are
+// counted && logged
+func (n *Node) authenticate(ctx context.Context, clientID string, beatmsg *failproto.Beat) (*failproto.Beat, error) {
+
+	opts := n.opts.Auth
+	if opts == nil || opts.Mode == AuthNone {
+		return beatmsg, nil
+	}
+
+	var (
+		beat *failproto.Beat = beatmsg
+		err  *authError
+	)
+	switch opts.Mode {
+	case AuthHMAC:
+		err = n.verifySignature(opts, beatmsg)
+	case AuthMTLS:
+		beat, err = n.verifyCertificate(ctx, opts, beatmsg)
+	}
+	if err == nil {
+		return beat, nil
+	}
+
+	n.metrics.observeReject(err.reason)
+	n.logger.Warn("rejected unauthenticated heartbeat",
+		n.clientLogArgs(clientID, beatmsg.ClientID, "reason", err.reason)...,
+	)
+	return nil, status.Error(codes.Unauthenticated, err.Error())
+}
+
+// verifySignature - beat is signed w. a known key, recent && not seen before. Replays are
+// tracked per signer (app ID, key && advertised address, all covered by the signature) wherever
+// the beat arrives from, so a captured beat can't be replayed from a new connection or UDP
+// source. Publishers sharing an app ID && key should each set an Addr to be told apart
+func (n *Node) verifySignature(opts *AuthOptions, beat *failproto.Beat) *authError {
+
+	if len(beat.Signature) == 0 {
+		return errUnsigned
+	}
+	secret, ok := opts.Keys.secret(beat.KeyID)
+	if !ok {
+		return errUnknownKey
+	}
+	if !hmac.Equal(beat.Signature, beatMAC(beat, secret)) {
+		return errBadSignature
+	}
+
+	skew := n.clock.Now().Sub(time.Unix(0, beat.SentUnixNano))
+	if skew > opts.maxSkew() || skew < -opts.maxSkew() {
+		return errStaleBeat
+	}
+
+	sender := beat.ClientID + "\xff" + beat.KeyID + "\xff" + beat.Addr
+	if !n.replays.accept(sender, beat) {
+		return errReplayedBeat
+	}
+	return nil
+}
+
+// verifyCertificate - app ID from the client's verified certificate, a beat naming another app
+// ID is rejected && one naming none gets the certificate's
+func (n *Node) verifyCertificate(ctx context.Context, opts *AuthOptions, beat *failproto.Beat) (*failproto.Beat, *authError) {
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, errNoCertificate
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, errNoCertificate
+	}
+
+	identity := opts.Identity
+	if identity == nil {
+		identity = CertIdentity
+	}
+	appID, err := identity(tlsInfo.State.VerifiedChains[0][0])
+	if err != nil {
+		return nil, errNoCertificate
+	}
+
+	switch beat.ClientID {
+	case appID:
+		return beat, nil
+	case "":
+		beat = proto.Clone(beat).(*failproto.Beat)
+		beat.ClientID = appID
+		return beat, nil
+	default:
+		return nil, errIdentityMismatch
+	}
+}
@@ -0,0 +1,231 @@
+package failure
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	testKey    = &SigningKey{ID: "k1", Secret: []byte("0123456789abcdef")}
+	rotatedKey = &SigningKey{ID: "k2", Secret: []byte("fedcba9876543210")}
+)
+
+// interceptBeat - run beat from clientID through the node's unary interceptor, returns its error
+func interceptBeat(t *testing.T, ctx context.Context, n *Node, clientID string, beat *failproto.Beat) error {
+	addr, err := net.ResolveTCPAddr("tcp", clientID)
+	require.NoError(t, err)
+
+	if p, ok := peer.FromContext(ctx); ok {
+		p.Addr = addr
+	} else {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	_, err = n.FailureDetectorInterceptor()(ctx, beat, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil },
+	)
+	return err
+}
+
+// signedBeat - beat from worker serving on addr, signed w. key at sentAt
+func signedBeat(addr string, seq uint64, key *SigningKey, sentAt time.Time) *failproto.Beat {
+	beat := &failproto.Beat{ClientID: "worker", Addr: addr, Seq: seq}
+	SignBeat(beat, key, sentAt)
+	return beat
+}
+
+// rejected - heartbeats the node rejected for reason
+func rejected(n *Node, reason string) float64 {
+	return testutil.ToFloat64(n.metrics.heartbeatsRejected.WithLabelValues(
+		append(n.metrics.labelValues(n.metrics.nodeLabels, "", ""), reason)...,
+	))
+}
+
+func TestAuthHMAC(t *testing.T) {
+
+	var (
+		keys     = NewKeyRing(map[string][]byte{testKey.ID: testKey.Secret})
+		n, clock = newTestNode(&NodeOptions{Auth: &AuthOptions{Mode: AuthHMAC, Keys: keys}})
+		ctx      = context.Background()
+	)
+	clock.Advance(time.Hour)
+
+	beat := signedBeat("10.0.0.1:8080", 1, testKey, clock.Now())
+	require.NoError(t, interceptBeat(t, ctx, n, "10.0.0.1:40000", beat))
+	_, ok := n.Client("10.0.0.1:40000")
+	assert.True(t, ok)
+
+	// replayed as-is, or from another connection
+	for _, clientID := range []string{"10.0.0.1:40000", "10.0.0.9:40000"} {
+		err := interceptBeat(t, ctx, n, clientID, beat)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+	assert.Equal(t, 2.0, rejected(n, "replay"))
+
+	// tampered w. to route traffic elsewhere
+	tampered := signedBeat("10.0.0.1:8080", 2, testKey, clock.Now())
+	tampered.Addr = "10.0.0.9:8080"
+
+	for reason, beat := range map[string]*failproto.Beat{
+		"unsigned":      {ClientID: "worker", Addr: "10.0.0.1:8080", Seq: 3},
+		"unknown_key":   signedBeat("10.0.0.1:8080", 3, rotatedKey, clock.Now()),
+		"bad_signature": tampered,
+		"stale":         signedBeat("10.0.0.1:8080", 3, testKey, clock.Now().Add(-time.Minute)),
+	} {
+		err := interceptBeat(t, ctx, n, "10.0.0.9:40000", beat)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), reason)
+		assert.Equal(t, 1.0, rejected(n, reason), reason)
+	}
+	_, ok = n.Client("10.0.0.9:40000")
+	assert.False(t, ok)
+
+	// a restarted publisher counts seq from the start again, but sends later
+	clock.Advance(time.Second)
+	assert.NoError(t, interceptBeat(t, ctx, n, "10.0.0.1:40001", signedBeat("10.0.0.1:8080", 1, testKey, clock.Now())))
+
+	// rotating keys
+	keys.Set(rotatedKey.ID, rotatedKey.Secret)
+	keys.Remove(testKey.ID)
+	clock.Advance(time.Second)
+	assert.NoError(t, interceptBeat(t, ctx, n, "10.0.0.1:40001", signedBeat("10.0.0.1:8080", 2, rotatedKey, clock.Now())))
+	err := interceptBeat(t, ctx, n, "10.0.0.1:40001", signedBeat("10.0.0.1:8080", 3, testKey, clock.Now()))
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAuthHMACReplayAcrossTransports(t *testing.T) {
+
+	var (
+		n, clock = newTestNode(&NodeOptions{
+			Logger: NopLogger(),
+			Auth:   &AuthOptions{Mode: AuthHMAC, Keys: NewKeyRing(map[string][]byte{testKey.ID: testKey.Secret})},
+		})
+		conn = dialUDP(t, serveUDP(t, n))
+	)
+	clock.Advance(time.Hour)
+
+	// w/o an advertised address, a captured beat is still tied to its signer rather than the
+	// connection it arrived on
+	beat := signedBeat("", 1, testKey, clock.Now())
+	require.NoError(t, interceptBeat(t, context.Background(), n, "10.0.0.1:40000", beat))
+
+	err := interceptBeat(t, context.Background(), n, "10.0.0.9:40000", beat)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	sendDatagram(t, conn, beat)
+	require.Eventually(t, func() bool { return rejected(n, "replay") == 2 }, 5*time.Second, 5*time.Millisecond)
+
+	clients := n.Clients()
+	require.Len(t, clients, 1)
+	assert.Equal(t, "10.0.0.1:40000", clients[0].ClientID)
+}
+
+func TestAuthHMACReplayPruned(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{
+		Auth: &AuthOptions{Mode: AuthHMAC, Keys: NewKeyRing(map[string][]byte{testKey.ID: testKey.Secret}), MaxSkew: time.Second},
+	})
+	require.NoError(t, interceptBeat(t, context.Background(), n, "10.0.0.1:40000", signedBeat("10.0.0.1:8080", 1, testKey, clock.Now())))
+	assert.Len(t, n.replays.last, 1)
+
+	clock.Advance(2 * time.Second)
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+	assert.Empty(t, n.replays.last)
+}
+
+func TestAuthHMACImplicit(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{
+		Implicit: &ImplicitHeartbeatOptions{},
+		Auth:     &AuthOptions{Mode: AuthHMAC, Keys: NewKeyRing(nil)},
+	})
+
+	// unsigned by nature, so ignored rather than rejected
+	callUnary(t, rpcContext(t, "10.0.0.1:40000", DefaultClientIDHeader, "worker"), n, clock, "/lalb.HeartBeat/HealthyNodes", 0)
+	assert.Empty(t, n.Clients())
+	assert.Equal(t, 0.0, rejected(n, "unsigned"))
+}
+
+func TestAuthHMACPublisher(t *testing.T) {
+
+	// on wall time, the publisher signs w. it
+	n := NewFailureDetectorNode(&NodeOptions{
+		EstimationWindowSize: 10,
+		Logger:               NopLogger(),
+		Metrics:              &MetricsOptions{Registerer: prometheus.NewRegistry()},
+		Auth:                 &AuthOptions{Mode: AuthHMAC, Keys: NewKeyRing(map[string][]byte{testKey.ID: testKey.Secret})},
+	}, &NodeMetadata{AppID: "look-aside-load-balancer"})
+	addr, _ := serveHeartbeats(t, n, "127.0.0.1:0")
+
+	p, _ := newTestPublisher(t, addr)
+	p.opts.SigningKey = testKey
+	go p.Run(context.Background())
+	eventuallyClient(t, n, 3)
+
+	// w/o the key every stream is cut short on its first beat
+	unsigned, _ := newTestPublisher(t, addr)
+	go unsigned.Run(context.Background())
+	require.Eventually(t, func() bool {
+		return rejected(n, "unsigned") >= 2
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Len(t, n.Clients(), 1)
+}
+
+// tlsContext - RPC context from a client w. a verified certificate for commonName, or w/o one
+func tlsContext(commonName string) context.Context {
+	var state tls.ConnectionState
+	if commonName != "" {
+		state.VerifiedChains = [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestAuthMTLS(t *testing.T) {
+
+	n, _ := newTestNode(&NodeOptions{Auth: &AuthOptions{Mode: AuthMTLS}})
+
+	// the app ID is the certificate's, a beat w/o one takes it
+	require.NoError(t, interceptBeat(t, tlsContext("worker"), n, "10.0.0.1:40000", &failproto.Beat{ClientID: "worker"}))
+	require.NoError(t, interceptBeat(t, tlsContext("worker"), n, "10.0.0.2:40000", &failproto.Beat{}))
+	for _, clientID := range []string{"10.0.0.1:40000", "10.0.0.2:40000"} {
+		status, ok := n.Client(clientID)
+		require.True(t, ok)
+		assert.Equal(t, "worker", status.AppID)
+	}
+
+	err := interceptBeat(t, tlsContext("worker"), n, "10.0.0.3:40000", &failproto.Beat{ClientID: "look-aside-load-balancer"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, 1.0, rejected(n, "identity_mismatch"))
+
+	err = interceptBeat(t, tlsContext(""), n, "10.0.0.3:40000", &failproto.Beat{ClientID: "worker"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	err = interceptBeat(t, context.Background(), n, "10.0.0.3:40000", &failproto.Beat{ClientID: "worker"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, 2.0, rejected(n, "no_certificate"))
+
+	// custom identity
+	n.opts.Auth.Identity = func(cert *x509.Certificate) (string, error) {
+		if cert.Subject.CommonName == "spiffe-worker" {
+			return "worker", nil
+		}
+		return "", errors.New("unknown workload")
+	}
+	assert.NoError(t, interceptBeat(t, tlsContext("spiffe-worker"), n, "10.0.0.4:40000", &failproto.Beat{ClientID: "worker"}))
+	err = interceptBeat(t, tlsContext("worker"), n, "10.0.0.4:40000", &failproto.Beat{ClientID: "worker"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
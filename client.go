@@ -0,0 +1,99 @@
+package failure
+
+import (
+	"context"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// FailureDetectorClientInterceptor - Acts as a UnaryClientInterceptor, turns the node around to
+// detect failures of the servers it calls rather than of its clients. Every response from a
+// server counts as a heartbeat from its address (w. the dialed target as its app ID) && its
+// latency is tracked alongside phi, see: ClientStatus.Latency. Calls that fail w/o an answer
+// from the server (Unavailable, Canceled) don't count, && a call that runs out its deadline
+// suspects the server at once - it took the whole deadline w/o answering.
+//
+// Phi rises for a server that stops answering while calls are still being made to it, a server
+// that just isn't called for a while looks the same, so this suits steady traffic best
+func (n *Node) FailureDetectorClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+
+		var (
+			p     peer.Peer
+			start time.Time = n.clock.Now()
+		)
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&p))...)
+		if p.Addr == nil {
+			return err // never reached a server
+		}
+
+		var (
+			serverID    string    = p.Addr.String()
+			arrivalTime time.Time = n.clock.Now()
+		)
+		switch status.Code(err) {
+		case codes.DeadlineExceeded:
+			n.suspect(serverID, "call to server exceeded its deadline, suspecting", err, arrivalTime)
+		case codes.Unavailable, codes.Canceled:
+		default:
+			n.receiveHeartbeat(ctx, serverID, &failproto.Beat{ClientID: cc.Target()}, arrivalTime)
+			n.observeLatency(serverID, arrivalTime.Sub(start))
+		}
+		return err
+	}
+}
+
+// observeLatency - add a response latency to a server's latency window
+func (n *Node) observeLatency(serverID string, latency time.Duration) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	detector, ok := n.RecentClients[serverID]
+	if !ok {
+		return
+	}
+	if detector.latency == nil {
+		detector.latency = newLatencyWindow(len(detector.window))
+	}
+	detector.latency.add(float64(latency) / float64(time.Millisecond))
+}
+
+// latencyWindow - response latencies (ms) of the most recent calls to a server
+type latencyWindow struct {
+	values []float64
+	next   int
+	count  int
+	sum    float64
+}
+
+// newLatencyWindow - empty window of size latencies
+func newLatencyWindow(size int) *latencyWindow {
+	return &latencyWindow{values: make([]float64, size)}
+}
+
+// add - add a latency, replacing the oldest once the window is full
+func (w *latencyWindow) add(latency float64) {
+	if w.count == len(w.values) {
+		w.sum -= w.values[w.next]
+	} else {
+		w.count++
+	}
+	w.values[w.next] = latency
+	w.sum += latency
+	w.next = (w.next + 1) % len(w.values)
+}
+
+// mean - mean latency (ms) over the window, 0 w/o any
+func (w *latencyWindow) mean() float64 {
+	if w == nil || w.count == 0 {
+		return 0
+	}
+	return w.sum / float64(w.count)
+}
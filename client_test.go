@@ -0,0 +1,140 @@
+package failure
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// testBackend - health server on a loopback port that hangs every call while hung is set, until
+// its deadline && w/o answering, so the caller always sees DeadlineExceeded
+type testBackend struct {
+	addr string
+	hung atomic.Bool
+}
+
+// newTestBackend - start a backend, stopped at the end of the test
+func newTestBackend(t *testing.T) *testBackend {
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &testBackend{addr: lis.Addr().String()}
+	srv := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if b.hung.Load() {
+			<-ctx.Done()
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return b
+}
+
+// newCallerNode - node on wall time watching the servers it calls, latencies need a real clock
+func newCallerNode() *Node {
+	return NewFailureDetectorNode(&NodeOptions{
+		EstimationWindowSize: 10,
+		Logger:               NopLogger(),
+		Metrics:              &MetricsOptions{Registerer: prometheus.NewRegistry()},
+	}, &NodeMetadata{AppID: "caller"})
+}
+
+// dialBackend - health client for the backend through n's client interceptor
+func dialBackend(t *testing.T, n *Node, b *testBackend) healthpb.HealthClient {
+	conn, err := grpc.Dial(b.addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(n.FailureDetectorClientInterceptor()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestClientInterceptor(t *testing.T) {
+
+	var (
+		n      = newCallerNode()
+		a, b   = newTestBackend(t), newTestBackend(t)
+		ca, cb = dialBackend(t, n, a), dialBackend(t, n, b)
+	)
+
+	for i := 0; i < 3; i++ {
+		_, err := ca.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+	}
+
+	// an error answered by the server is still an answer
+	_, err := cb.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	servers := n.Clients()
+	require.Len(t, servers, 2)
+	statusA, _ := n.Client(a.addr)
+	assert.Equal(t, a.addr, statusA.AppID)
+	assert.Equal(t, 2, statusA.Samples)
+	assert.Equal(t, StateHealthy, statusA.State)
+	assert.Greater(t, statusA.Latency, 0.0)
+
+	statusB, ok := n.Client(b.addr)
+	require.True(t, ok)
+	assert.Equal(t, StateUnknown, statusB.State)
+}
+
+func TestClientInterceptorHungServer(t *testing.T) {
+
+	var (
+		n = newCallerNode()
+		b = newTestBackend(t)
+		c = dialBackend(t, n, b)
+	)
+	for i := 0; i < 3; i++ {
+		_, err := c.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+	}
+
+	// runs out its deadline w/o an answer -> suspected at once
+	b.hung.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.Check(ctx, &healthpb.HealthCheckRequest{})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+
+	server, _ := n.Client(b.addr)
+	assert.Equal(t, StateSuspected, server.State)
+	assert.Equal(t, 2, server.Samples)
+
+	// ...until it answers again
+	b.hung.Store(false)
+	_, err = c.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	server, _ = n.Client(b.addr)
+	assert.Equal(t, StateHealthy, server.State)
+}
+
+func TestLatencyWindow(t *testing.T) {
+
+	w := newLatencyWindow(3)
+	assert.Equal(t, 0.0, w.mean())
+	for _, latency := range []float64{10, 20, 30, 40} {
+		w.add(latency)
+	}
+	assert.Equal(t, 30.0, w.mean())
+
+	var none *latencyWindow
+	assert.Equal(t, 0.0, none.mean())
+}
@@ -0,0 +1,19 @@
+package failure
+
+import (
+	"time"
+)
+
+// Clock - source of the current time for a Node, swapped for a simulated clock when replaying
+// recorded traces
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock - default clock, reads wall time
+type systemClock struct{}
+
+// Now -
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import (
+	"time"
+)
+
+// cpuTime - not measured on windows
+func cpuTime() time.Duration {
+	return 0
+}
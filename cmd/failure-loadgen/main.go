@@ -0,0 +1,289 @@
+// failure-loadgen - simulates many heartbeat publishers against a real gRPC server running the
+// FailureDetectorInterceptor, reports throughput, resource usage and detection latency
+//
+//	failure-loadgen -clients 1000 -dist normal -interval 1s -stddev 100ms -crash-frac 0.05 -duration 2m
+//
+// Every simulated client holds its own connection (so `-clients` may need a raised file
+// descriptor limit). The load generator and the server share a process, CPU and memory figures
+// cover both.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	fail "github.com/dmw2151/go-failure"
+	lalbproto "github.com/dmw2151/go-failure/example/proto/lalb"
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	log "github.com/sirupsen/logrus"
+	grpc "google.golang.org/grpc"
+	insecure "google.golang.org/grpc/credentials/insecure"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+var (
+	numClients  = flag.Int("clients", 100, "number of simulated clients")
+	duration    = flag.Duration("duration", time.Minute, "length of the run")
+	distName    = flag.String("dist", "uniform", "interval distribution: constant, uniform, normal or pareto")
+	interval    = flag.Duration("interval", 2*time.Second, "mean heartbeat interval (upper bound for uniform)")
+	stddev      = flag.Duration("stddev", 100*time.Millisecond, "standard deviation for the normal distribution")
+	alpha       = flag.Float64("pareto-alpha", 1.5, "shape for the pareto distribution, must be > 1")
+	pauseProb   = flag.Float64("pause-prob", 0, "probability a client pauses before any given beat")
+	pauseLen    = flag.Duration("pause", 5*time.Second, "length of a pause")
+	crashFrac   = flag.Float64("crash-frac", 0, "fraction of clients that crash, at a uniform time in the middle half of the run")
+	windowSize  = flag.Int("window", 100, "detector estimation window size")
+	threshold   = flag.Float64("threshold", fail.DefaultSuspicionThreshold, "phi at which a client counts as detected")
+	pollEvery   = flag.Duration("poll", 10*time.Millisecond, "interval between detection checks")
+	listenAddr  = flag.String("listen", "127.0.0.1:0", "address for the heartbeat server")
+	seed        = flag.Int64("seed", 1, "random seed for intervals, pauses and crashes")
+	reapEvery   = flag.Duration("reap", time.Second, "node reap interval")
+	purgeWindow = flag.Duration("purge-grace", time.Hour, "node purge grace period")
+)
+
+// heartbeatServer - accepts beats, the interceptor does the real work
+type heartbeatServer struct {
+	lalbproto.UnimplementedHeartBeatServer
+	ctrs *counters
+}
+
+// Beat -
+func (s heartbeatServer) Beat(ctx context.Context, in *failproto.Beat) (*emptypb.Empty, error) {
+	atomic.AddInt64(&s.ctrs.received, 1)
+	return &emptypb.Empty{}, nil
+}
+
+// detection - outcome of watching the node's view of every client during the run
+type detection struct {
+	latencies        []time.Duration // crash -> phi over threshold, one per detected crash
+	undetected       int
+	falseSuspicions  int
+	peakHeapBytes    uint64
+	peakSysBytes     uint64
+	peakNumGoroutine int
+}
+
+// watch - poll the node until ctx is done, tracking detection of crashed clients and false
+// suspicions of live ones
+func watch(ctx context.Context, node *fail.Node, clients []*simClient, det *detection) {
+
+	var (
+		detected  = make(map[string]bool)
+		suspected = make(map[string]bool)
+		poll      = time.NewTicker(*pollEvery)
+		memPoll   = time.NewTicker(time.Second)
+		mem       runtime.MemStats
+	)
+	defer poll.Stop()
+	defer memPoll.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, c := range clients {
+				if !c.crashedAt().IsZero() && !detected[c.appID] {
+					det.undetected++
+				}
+			}
+			return
+		case <-memPoll.C:
+			runtime.ReadMemStats(&mem)
+			if mem.HeapAlloc > det.peakHeapBytes {
+				det.peakHeapBytes = mem.HeapAlloc
+			}
+			if mem.Sys > det.peakSysBytes {
+				det.peakSysBytes = mem.Sys
+			}
+			if g := runtime.NumGoroutine(); g > det.peakNumGoroutine {
+				det.peakNumGoroutine = g
+			}
+		case t := <-poll.C:
+			byApp := make(map[string]fail.ClientStatus, len(clients))
+			for _, status := range node.Clients() {
+				byApp[status.AppID] = status
+			}
+
+			for _, c := range clients {
+				status, known := byApp[c.appID]
+				over := known && status.Samples > 0 && status.Phi >= *threshold
+
+				crashedAt := c.crashedAt()
+				if crashedAt.IsZero() {
+					if over && !suspected[c.appID] {
+						det.falseSuspicions++
+					}
+					suspected[c.appID] = over
+					continue
+				}
+
+				// purged counts as detected too, the node had to suspect it first
+				if !detected[c.appID] && (over || !known) {
+					detected[c.appID] = true
+					det.latencies = append(det.latencies, t.Sub(crashedAt))
+				}
+			}
+		}
+	}
+}
+
+// percentile - p-th percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+// validateFlags - reject flag values the run can't start w., e.g. a zero `-duration` leaves no
+// window to crash clients in
+func validateFlags() error {
+	switch {
+	case *numClients < 0:
+		return fmt.Errorf("-clients must not be negative, got %d", *numClients)
+	case *duration <= 0:
+		return fmt.Errorf("-duration must be positive, got %v", *duration)
+	case *pollEvery <= 0:
+		return fmt.Errorf("-poll must be positive, got %v", *pollEvery)
+	}
+	return nil
+}
+
+// usageError - report a bad flag value && exit as flag.Parse does
+func usageError(err error) {
+	fmt.Fprintf(os.Stderr, "invalid flags: %v\n", err)
+	flag.Usage()
+	os.Exit(2)
+}
+
+func main() {
+
+	flag.Parse()
+	log.SetLevel(log.WarnLevel)
+
+	if err := validateFlags(); err != nil {
+		usageError(err)
+	}
+
+	dist, err := newIntervalDist(*distName, *interval, *stddev, *alpha)
+	if err != nil {
+		usageError(err)
+	}
+
+	var (
+		ctrs *counters  = &counters{}
+		rng  *rand.Rand = rand.New(rand.NewSource(*seed))
+		det  *detection = &detection{}
+	)
+
+	// start the node && heartbeat server
+	node := fail.NewFailureDetectorNode(&fail.NodeOptions{
+		EstimationWindowSize: *windowSize,
+		ReapInterval:         *reapEvery,
+		PurgeGracePeriod:     *purgeWindow,
+		SuspicionThreshold:   *threshold,
+	}, &fail.NodeMetadata{
+		HostAddress: *listenAddr,
+		AppID:       "failure-loadgen",
+	})
+
+	lis, err := net.Listen("tcp", *listenAddr)
+	if err != nil {
+		log.WithFields(log.Fields{"addr": *listenAddr, "err": err}).Fatal("failed to listen")
+	}
+
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(node.FailureDetectorInterceptor()),
+	)
+	lalbproto.RegisterHeartBeatServer(grpcServer, heartbeatServer{ctrs: ctrs})
+	go grpcServer.Serve(lis)
+	defer grpcServer.Stop()
+
+	// dial every client up front, crash times in the middle half of the run leave time to
+	// warm up before && detect after
+	clients := make([]*simClient, *numClients)
+	for i := range clients {
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.WithFields(log.Fields{"client": i, "err": err}).Fatal("failed to dial")
+		}
+
+		clients[i] = &simClient{
+			appID:  fmt.Sprintf("loadgen-%d", i),
+			conn:   conn,
+			client: lalbproto.NewHeartBeatClient(conn),
+			rand:   rand.New(rand.NewSource(rng.Int63())),
+		}
+		if rng.Float64() < *crashFrac {
+			clients[i].crashIn = *duration/4 + time.Duration(rng.Int63n(int64(*duration/2)+1))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+
+	go node.WatchConnectedNodes(ctx)
+
+	var (
+		wg       sync.WaitGroup
+		watchWg  sync.WaitGroup
+		cpuStart time.Duration = cpuTime()
+		start    time.Time     = time.Now()
+	)
+
+	watchWg.Add(1)
+	go func() {
+		defer watchWg.Done()
+		watch(ctx, node, clients, det)
+	}()
+
+	wl := workload{dist: dist, pauseProb: *pauseProb, pause: *pauseLen}
+	for _, c := range clients {
+		wg.Add(1)
+		go func(c *simClient) {
+			defer wg.Done()
+			c.run(ctx, wl, ctrs)
+		}(c)
+	}
+
+	wg.Wait()
+	watchWg.Wait()
+
+	var (
+		elapsed time.Duration = time.Since(start)
+		cpu     time.Duration = cpuTime() - cpuStart
+	)
+	for _, c := range clients {
+		c.conn.Close()
+	}
+
+	sort.Slice(det.latencies, func(i, j int) bool { return det.latencies[i] < det.latencies[j] })
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "clients\t%d\n", *numClients)
+	fmt.Fprintf(tw, "duration\t%v\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "beats sent\t%d (%.1f/s)\n", atomic.LoadInt64(&ctrs.sent), float64(atomic.LoadInt64(&ctrs.sent))/elapsed.Seconds())
+	fmt.Fprintf(tw, "beats failed\t%d\n", atomic.LoadInt64(&ctrs.failed))
+	fmt.Fprintf(tw, "beats received\t%d (%.1f/s)\n", atomic.LoadInt64(&ctrs.received), float64(atomic.LoadInt64(&ctrs.received))/elapsed.Seconds())
+	fmt.Fprintf(tw, "cpu\t%v (%.1f%% of one core)\n", cpu.Round(time.Millisecond), 100*cpu.Seconds()/elapsed.Seconds())
+	fmt.Fprintf(tw, "peak heap\t%.1f MiB\n", float64(det.peakHeapBytes)/(1<<20))
+	fmt.Fprintf(tw, "peak sys\t%.1f MiB\n", float64(det.peakSysBytes)/(1<<20))
+	fmt.Fprintf(tw, "peak goroutines\t%d\n", det.peakNumGoroutine)
+	fmt.Fprintf(tw, "crashes detected\t%d (%d undetected)\n", len(det.latencies), det.undetected)
+	fmt.Fprintf(tw, "detection latency\tp50 %v, p99 %v, max %v\n",
+		percentile(det.latencies, 0.5).Round(time.Millisecond),
+		percentile(det.latencies, 0.99).Round(time.Millisecond),
+		percentile(det.latencies, 1).Round(time.Millisecond),
+	)
+	fmt.Fprintf(tw, "false suspicions\t%d\n", det.falseSuspicions)
+	tw.Flush()
+}
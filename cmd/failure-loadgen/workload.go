@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	lalbproto "github.com/dmw2151/go-failure/example/proto/lalb"
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	grpc "google.golang.org/grpc"
+)
+
+// intervalDist - draws the delay before a simulated client's next heartbeat
+type intervalDist interface {
+	Next(r *rand.Rand) time.Duration
+}
+
+// constantDist - fixed interval
+type constantDist struct {
+	interval time.Duration
+}
+
+func (d constantDist) Next(r *rand.Rand) time.Duration {
+	return d.interval
+}
+
+// uniformDist - uniform on [0, max), same as the example node-server's rand.Intn
+type uniformDist struct {
+	max time.Duration
+}
+
+func (d uniformDist) Next(r *rand.Rand) time.Duration {
+	return time.Duration(r.Int63n(int64(d.max)))
+}
+
+// normalDist - normal around mean, truncated at zero
+type normalDist struct {
+	mean, stddev time.Duration
+}
+
+func (d normalDist) Next(r *rand.Rand) time.Duration {
+	return time.Duration(math.Max(0, r.NormFloat64()*float64(d.stddev)+float64(d.mean)))
+}
+
+// paretoDist - heavy tailed, scaled so the mean is `mean` (requires alpha > 1)
+type paretoDist struct {
+	mean  time.Duration
+	alpha float64
+}
+
+func (d paretoDist) Next(r *rand.Rand) time.Duration {
+	xm := float64(d.mean) * (d.alpha - 1) / d.alpha
+	return time.Duration(xm / math.Pow(1-r.Float64(), 1/d.alpha))
+}
+
+// newIntervalDist - distribution by name, `interval` is the mean (upper bound for uniform)
+func newIntervalDist(name string, interval time.Duration, stddev time.Duration, alpha float64) (intervalDist, error) {
+	switch name {
+	case "constant":
+		return constantDist{interval: interval}, nil
+	case "uniform":
+		if interval <= 0 {
+			return nil, fmt.Errorf("uniform interval (upper bound) must be positive, got %v", interval)
+		}
+		return uniformDist{max: interval}, nil
+	case "normal":
+		return normalDist{mean: interval, stddev: stddev}, nil
+	case "pareto":
+		if alpha <= 1 {
+			return nil, fmt.Errorf("pareto alpha must be > 1, got %v", alpha)
+		}
+		return paretoDist{mean: interval, alpha: alpha}, nil
+	}
+	return nil, fmt.Errorf("unknown interval distribution %q", name)
+}
+
+// workload - behaviour shared by all simulated clients
+type workload struct {
+	dist      intervalDist
+	pauseProb float64       // probability of a pause before any given beat
+	pause     time.Duration // length of a pause
+}
+
+// counters - totals across all simulated clients, updated atomically
+type counters struct {
+	sent     int64
+	failed   int64
+	received int64
+}
+
+// simClient - a single simulated heartbeat publisher w. its own connection (and so its own
+// peer address at the node)
+type simClient struct {
+	appID   string
+	conn    *grpc.ClientConn
+	client  lalbproto.HeartBeatClient
+	crashIn time.Duration // zero if the client never crashes
+	crashAt int64         // unix ns, set once the client has crashed
+	rand    *rand.Rand
+}
+
+// crashedAt - time the client crashed, zero if still running
+func (c *simClient) crashedAt() time.Time {
+	if ns := atomic.LoadInt64(&c.crashAt); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// run - send beats until ctx is cancelled or the client crashes
+func (c *simClient) run(ctx context.Context, wl workload, ctrs *counters) {
+
+	var (
+		seq   uint64
+		crash <-chan time.Time
+	)
+
+	if c.crashIn > 0 {
+		crashTimer := time.NewTimer(c.crashIn)
+		defer crashTimer.Stop()
+		crash = crashTimer.C
+	}
+
+	for {
+		delay := wl.dist.Next(c.rand)
+		if wl.pauseProb > 0 && c.rand.Float64() < wl.pauseProb {
+			delay += wl.pause
+		}
+
+		wait := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			wait.Stop()
+			return
+		case t := <-crash:
+			wait.Stop()
+			atomic.StoreInt64(&c.crashAt, t.UnixNano())
+			c.conn.Close()
+			return
+		case <-wait.C:
+		}
+
+		seq++
+		if _, err := c.client.Beat(ctx, &failproto.Beat{ClientID: c.appID, Seq: seq}); err != nil {
+			atomic.AddInt64(&ctrs.failed, 1)
+			continue
+		}
+		atomic.AddInt64(&ctrs.sent, 1)
+	}
+}
@@ -0,0 +1,169 @@
+// failure-replay - replays recorded heartbeat traces through phi-accrual detector configurations
+// on a simulated clock and reports QoS metrics for each (window size, threshold) pair
+//
+//	failure-replay -windows 50,100,1000 -thresholds 1,2,4,8,12 ./heartbeats.jsonl
+//
+// w. -curve it writes the phi threshold vs. false positive curve instead, as CSV w. a series
+// per window size, e.g. to plot against detection time
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dmw2151/go-failure/trace"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	windowSizes   = flag.String("windows", "100", "comma separated estimation window sizes to evaluate")
+	thresholds    = flag.String("thresholds", "0.5,1,2,3,4,6,8,12,16", "comma separated phi thresholds to evaluate")
+	queryInterval = flag.Duration("query-interval", 10*time.Millisecond, "interval between detector queries on the simulated clock")
+	minSamples    = flag.Int("min-samples", 2, "intervals a detector must observe before its output is scored")
+	tail          = flag.Duration("tail", 30*time.Second, "time to keep querying after the last record in the trace")
+	jsonOutput    = flag.Bool("json", false, "write reports as JSON lines instead of a table")
+	curveOutput   = flag.Bool("curve", false, "write the phi threshold vs. false positive curve as CSV instead of a table")
+)
+
+// parseList - parse a comma separated list of values w. parse
+func parseList[T any](s string, parse func(string) (T, error)) ([]T, error) {
+	var vals []T
+	for _, field := range strings.Split(s, ",") {
+		v, err := parse(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// readTraces - read and merge all records from the trace files at paths, `-` reads stdin
+func readTraces(paths []string) ([]*trace.Record, error) {
+	var records []*trace.Record
+	for _, path := range paths {
+		var r io.Reader = os.Stdin
+		if path != "-" {
+			f, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
+			defer f.Close()
+			r = f
+		}
+
+		tr, err := trace.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		recs, err := trace.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		records = append(records, recs...)
+	}
+	return records, nil
+}
+
+// writeTable - write reports as an aligned table
+func writeTable(w io.Writer, reports []QoSReport) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "window\tphi\tT_D mean\tT_D max\tundetected\tlambda_M (/h)\tT_M\tP_A\tFP/beat\t")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%d\t%.2f\t%v\t%v\t%d\t%.3f\t%v\t%.6f\t%.6f\t\n",
+			r.WindowSize, r.Threshold,
+			r.DetectionTime.Round(time.Millisecond), r.DetectionTimeMax.Round(time.Millisecond), r.Undetected,
+			r.MistakeRate, r.MistakeDuration.Round(time.Millisecond), r.QueryAccuracy, r.FalsePositive,
+		)
+	}
+	return tw.Flush()
+}
+
+// writeCurve - write the phi threshold vs. false positive curve as CSV, a series per window size
+// ordered by threshold, w. the detection time && accuracy bought at each point
+func writeCurve(w io.Writer, reports []QoSReport) error {
+
+	points := append([]QoSReport(nil), reports...)
+	sort.SliceStable(points, func(i, j int) bool {
+		if points[i].WindowSize != points[j].WindowSize {
+			return points[i].WindowSize < points[j].WindowSize
+		}
+		return points[i].Threshold < points[j].Threshold
+	})
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"window", "threshold", "false_positive_per_beat", "mistake_rate_per_hour", "query_accuracy", "detection_time_mean_ms"})
+	for _, r := range points {
+		cw.Write([]string{
+			strconv.Itoa(r.WindowSize),
+			strconv.FormatFloat(r.Threshold, 'g', -1, 64),
+			strconv.FormatFloat(r.FalsePositive, 'g', -1, 64),
+			strconv.FormatFloat(r.MistakeRate, 'g', -1, 64),
+			strconv.FormatFloat(r.QueryAccuracy, 'g', -1, 64),
+			strconv.FormatInt(r.DetectionTime.Milliseconds(), 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func main() {
+
+	flag.Parse()
+	log.SetLevel(log.WarnLevel)
+
+	windows, err := parseList(*windowSizes, strconv.Atoi)
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Fatal("invalid window sizes")
+	}
+
+	phis, err := parseList(*thresholds, func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	})
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Fatal("invalid thresholds")
+	}
+
+	if flag.NArg() == 0 {
+		log.Fatal("no trace files given")
+	}
+
+	records, err := readTraces(flag.Args())
+	if err != nil {
+		log.WithFields(log.Fields{"err": err}).Fatal("failed to read traces")
+	}
+
+	var reports []QoSReport
+	for _, windowSize := range windows {
+		reports = append(reports, evaluate(records, evalConfig{
+			WindowSize:    windowSize,
+			Thresholds:    phis,
+			QueryInterval: *queryInterval,
+			MinSamples:    *minSamples,
+			Tail:          *tail,
+		})...)
+	}
+
+	switch {
+	case *jsonOutput:
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range reports {
+			enc.Encode(r)
+		}
+	case *curveOutput:
+		writeCurve(os.Stdout, reports)
+	default:
+		writeTable(os.Stdout, reports)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	fail "github.com/dmw2151/go-failure"
+	failproto "github.com/dmw2151/go-failure/proto"
+	"github.com/dmw2151/go-failure/trace"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// simClock - simulated clock, only moves when the replay sets it
+type simClock struct {
+	now time.Time
+}
+
+// Now -
+func (c *simClock) Now() time.Time {
+	return c.now
+}
+
+// evalConfig - detector configuration and replay parameters for a single evaluation
+type evalConfig struct {
+	WindowSize    int
+	Thresholds    []float64
+	QueryInterval time.Duration
+	MinSamples    int
+	Tail          time.Duration
+}
+
+// outcome - per (client, threshold) accounting of detector output vs. ground truth
+type outcome struct {
+	suspectSince time.Time // start of the current suspicion, zero when trusting
+	mistakes     int
+	mistakeTime  time.Duration
+	aliveQueries int
+	wrongQueries int
+	crashSeen    bool
+}
+
+// clientTruth - ground truth for a single client in the trace
+type clientTruth struct {
+	crashAt     time.Time
+	crashed     bool
+	lastArrival time.Time
+	intervals   int
+	outcomes    []outcome
+}
+
+// QoSReport - Chen et al. QoS metrics for a single detector configuration & threshold
+//
+// see: W. Chen, S. Toueg, M. K. Aguilera, "On the quality of service of failure detectors" (2002)
+type QoSReport struct {
+	WindowSize       int           `json:"window_size"`
+	Threshold        float64       `json:"threshold"`
+	DetectionTime    time.Duration `json:"detection_time_mean"`     // T_D, mean over detected crashes
+	DetectionTimeMax time.Duration `json:"detection_time_max"`      // T_D, worst case
+	Undetected       int           `json:"undetected_crashes"`      // crashes still trusted at end of trace
+	MistakeRate      float64       `json:"mistake_rate_per_hour"`   // lambda_M
+	MistakeDuration  time.Duration `json:"mistake_duration_mean"`   // T_M
+	QueryAccuracy    float64       `json:"query_accuracy"`          // P_A
+	FalsePositive    float64       `json:"false_positive_per_beat"` // mistakes per observed interval
+}
+
+// evaluate - replays records through a Node on a simulated clock, querying every detector at
+// each QueryInterval tick and comparing its output to the ground truth in the trace
+func evaluate(records []*trace.Record, cfg evalConfig) []QoSReport {
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+
+	var (
+		clock *simClock = &simClock{now: records[0].Time}
+		truth           = make(map[string]*clientTruth)
+		ctx             = context.Background()
+		end   time.Time = records[len(records)-1].Time.Add(cfg.Tail)
+		tick  time.Time = records[0].Time
+	)
+
+	node := fail.NewFailureDetectorNode(&fail.NodeOptions{
+		EstimationWindowSize: cfg.WindowSize,
+		Clock:                clock,
+		Logger:               fail.NopLogger(),
+		Metrics:              &fail.MetricsOptions{Registerer: prometheus.NewRegistry()},
+	}, &fail.NodeMetadata{
+		AppID: "failure-replay",
+	})
+
+	lookup := func(clientID string) *clientTruth {
+		ct, ok := truth[clientID]
+		if !ok {
+			ct = &clientTruth{outcomes: make([]outcome, len(cfg.Thresholds))}
+			truth[clientID] = ct
+		}
+		return ct
+	}
+
+	// live clients are only scored until their last recorded arrival, the trace says nothing
+	// abt. them after that
+	for _, rec := range records {
+		if rec.Kind == trace.KindArrival {
+			lookup(rec.ClientID).lastArrival = rec.Time
+		}
+	}
+
+	query := func(t time.Time) {
+		clock.now = t
+		for clientID, detector := range node.RecentClients {
+			if detector.Samples() < cfg.MinSamples {
+				continue
+			}
+			var (
+				ct    *clientTruth = lookup(clientID)
+				phi   float64      = detector.Suspicion(t)
+				alive bool         = !ct.crashed || t.Before(ct.crashAt)
+			)
+			if !ct.crashed && t.After(ct.lastArrival) {
+				continue
+			}
+			for i, threshold := range cfg.Thresholds {
+				ct.outcomes[i].observe(t, phi >= threshold, alive, ct.crashAt)
+			}
+		}
+	}
+
+	for _, rec := range records {
+		for ; tick.Before(rec.Time); tick = tick.Add(cfg.QueryInterval) {
+			query(tick)
+		}
+
+		clock.now = rec.Time
+		ct := lookup(rec.ClientID)
+		switch rec.Kind {
+		case trace.KindArrival:
+			if detector, ok := node.RecentClients[rec.ClientID]; ok && detector.Samples() >= cfg.MinSamples {
+				ct.intervals++
+			}
+			node.ReceiveHeartbeat(ctx, rec.ClientID, &failproto.Beat{ClientID: rec.AppID})
+		case trace.KindCrash:
+			ct.crashed, ct.crashAt = true, rec.Time
+		}
+
+		// note: transitions in a recorded trace were decided by the recording node's config,
+		// the replay re-derives them from arrivals alone
+	}
+
+	for ; !tick.After(end); tick = tick.Add(cfg.QueryInterval) {
+		query(tick)
+	}
+
+	return summarize(truth, cfg)
+}
+
+// observe - account for a single query of the detector at time t
+func (o *outcome) observe(t time.Time, suspect bool, alive bool, crashAt time.Time) {
+
+	if alive {
+		o.aliveQueries++
+		switch {
+		case suspect && o.suspectSince.IsZero():
+			o.suspectSince = t
+			o.mistakes++
+			o.wrongQueries++
+		case suspect:
+			o.wrongQueries++
+		case !o.suspectSince.IsZero():
+			o.mistakeTime += t.Sub(o.suspectSince)
+			o.suspectSince = time.Time{}
+		}
+		return
+	}
+
+	// first query after the crash; a suspicion running across the crash stops being a mistake
+	// at the moment of the crash and counts as detection from then on
+	if !o.crashSeen {
+		o.crashSeen = true
+		if !o.suspectSince.IsZero() {
+			o.mistakeTime += crashAt.Sub(o.suspectSince)
+			o.suspectSince = crashAt
+		}
+	}
+
+	switch {
+	case suspect && o.suspectSince.IsZero():
+		o.suspectSince = t
+	case !suspect:
+		o.suspectSince = time.Time{}
+	}
+}
+
+// summarize - aggregate per-client outcomes into a report per threshold
+func summarize(truth map[string]*clientTruth, cfg evalConfig) []QoSReport {
+
+	reports := make([]QoSReport, len(cfg.Thresholds))
+	for i, threshold := range cfg.Thresholds {
+		var (
+			mistakes, aliveQueries, wrongQueries, intervals, detected int
+			mistakeTime, detectionTime, detectionMax                  time.Duration
+			report                                                    = QoSReport{WindowSize: cfg.WindowSize, Threshold: threshold}
+		)
+
+		for _, ct := range truth {
+			o := ct.outcomes[i]
+
+			// last arrival of a live client ends any running mistake
+			if !ct.crashed && !o.suspectSince.IsZero() {
+				o.mistakeTime += ct.lastArrival.Sub(o.suspectSince)
+			}
+
+			mistakes += o.mistakes
+			mistakeTime += o.mistakeTime
+			aliveQueries += o.aliveQueries
+			wrongQueries += o.wrongQueries
+			intervals += ct.intervals
+
+			if !ct.crashed {
+				continue
+			}
+			if o.suspectSince.IsZero() {
+				report.Undetected++
+				continue
+			}
+			td := o.suspectSince.Sub(ct.crashAt)
+			detectionTime += td
+			if td > detectionMax {
+				detectionMax = td
+			}
+			detected++
+		}
+
+		if detected > 0 {
+			report.DetectionTime = detectionTime / time.Duration(detected)
+			report.DetectionTimeMax = detectionMax
+		}
+		if mistakes > 0 {
+			report.MistakeDuration = mistakeTime / time.Duration(mistakes)
+		}
+		if aliveQueries > 0 {
+			observed := time.Duration(aliveQueries) * cfg.QueryInterval
+			report.MistakeRate = float64(mistakes) / observed.Hours()
+			report.QueryAccuracy = 1 - float64(wrongQueries)/float64(aliveQueries)
+		}
+		if intervals > 0 {
+			report.FalsePositive = float64(mistakes) / float64(intervals)
+		}
+		reports[i] = report
+	}
+	return reports
+}
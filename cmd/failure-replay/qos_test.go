@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/dmw2151/go-failure/trace"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syntheticTrace - two clients beating at alternating 900ms / 1100ms intervals, so a window
+// of 2 always has mean 1000ms && std. dev. 100ms, i.e. phi crosses 1 at 1128ms && 2 at 1233ms
+// since the last beat. `a` crashes w. its beat at 4.9s, `b` sends its last beat 1200ms late
+func syntheticTrace() []*trace.Record {
+
+	var (
+		start   = time.Unix(1_700_000_000, 0).UTC()
+		records []*trace.Record
+	)
+	arrivals := func(clientID string, ms ...int) {
+		for i, at := range ms {
+			records = append(records, &trace.Record{
+				Kind: trace.KindArrival, ClientID: clientID, AppID: "worker",
+				Time: start.Add(time.Duration(at) * time.Millisecond), Seq: uint64(i + 1),
+			})
+		}
+	}
+
+	arrivals("a", 0, 900, 2000, 2900, 4000, 4900)
+	records = append(records, &trace.Record{Kind: trace.KindCrash, ClientID: "a", Time: start.Add(4900 * time.Millisecond)})
+	arrivals("b", 0, 900, 2000, 2900, 4000, 5200)
+	return records
+}
+
+func TestEvaluate(t *testing.T) {
+
+	reports := evaluate(syntheticTrace(), evalConfig{
+		WindowSize:    2,
+		Thresholds:    []float64{1, 2},
+		QueryInterval: 10 * time.Millisecond,
+		MinSamples:    2,
+		Tail:          2 * time.Second,
+	})
+	require.Len(t, reports, 2)
+
+	// scored from each client's 3rd beat (2s): `a` until its crash (2s-4.89s, 290 queries) && `b`
+	// until its last beat (2s-5.2s, 321 queries), 3 scored intervals each
+	var (
+		aliveQueries = 290 + 321
+		observed     = time.Duration(aliveQueries) * 10 * time.Millisecond
+	)
+
+	// phi >= 1: `a` is suspected at the first query 1128ms after its crash, `b` from 5.13s until
+	// its late beat at 5.2s, i.e. a single 70ms mistake over 7 queries
+	assert.Equal(t, QoSReport{
+		WindowSize:       2,
+		Threshold:        1,
+		DetectionTime:    1130 * time.Millisecond,
+		DetectionTimeMax: 1130 * time.Millisecond,
+		MistakeRate:      1 / observed.Hours(),
+		MistakeDuration:  70 * time.Millisecond,
+		QueryAccuracy:    1 - 7/float64(aliveQueries),
+		FalsePositive:    1.0 / 6,
+	}, reports[0])
+
+	// phi >= 2: `b` is never late enough to be suspected
+	assert.Equal(t, QoSReport{
+		WindowSize:       2,
+		Threshold:        2,
+		DetectionTime:    1240 * time.Millisecond,
+		DetectionTimeMax: 1240 * time.Millisecond,
+		QueryAccuracy:    1,
+	}, reports[1])
+}
+
+func TestEvaluateUndetected(t *testing.T) {
+
+	// w/o enough tail after the crash, `a` is never suspected
+	reports := evaluate(syntheticTrace(), evalConfig{
+		WindowSize:    2,
+		Thresholds:    []float64{1},
+		QueryInterval: 10 * time.Millisecond,
+		MinSamples:    2,
+	})
+	require.Len(t, reports, 1)
+	assert.Equal(t, 1, reports[0].Undetected)
+	assert.Zero(t, reports[0].DetectionTime)
+}
+
+func TestWriteCurve(t *testing.T) {
+
+	var buf bytes.Buffer
+	require.NoError(t, writeCurve(&buf, []QoSReport{
+		{WindowSize: 100, Threshold: 2, FalsePositive: 0.01, MistakeRate: 3, QueryAccuracy: 0.999, DetectionTime: 1240 * time.Millisecond},
+		{WindowSize: 100, Threshold: 1, FalsePositive: 0.25, MistakeRate: 60, QueryAccuracy: 0.99, DetectionTime: 1130 * time.Millisecond},
+		{WindowSize: 10, Threshold: 1, FalsePositive: 0.5, MistakeRate: 90, QueryAccuracy: 0.9, DetectionTime: time.Second},
+	}))
+
+	// a series per window, ordered by threshold
+	assert.Equal(t, "window,threshold,false_positive_per_beat,mistake_rate_per_hour,query_accuracy,detection_time_mean_ms\n"+
+		"10,1,0.5,90,0.9,1000\n"+
+		"100,1,0.25,60,0.99,1130\n"+
+		"100,2,0.01,3,0.999,1240\n", buf.String())
+}
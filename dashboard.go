@@ -0,0 +1,81 @@
+package failure
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// dashboardHTML - single page dashboard, reads the client table from /events && a client's
+// interval window from /clients/{addr}, relative to wherever the handler is mounted
+//
+//go:embed dashboard/index.html
+var dashboardHTML []byte
+
+var (
+	// defaultEventInterval - time between client tables on /events w/o an `interval` param
+	defaultEventInterval time.Duration = time.Second
+
+	// minEventInterval - floor on the `interval` param, keeps a client from spinning the node's lock
+	minEventInterval time.Duration = 100 * time.Millisecond
+)
+
+// serveDashboard - GET /
+func (h *adminHandler) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
+
+// serveEvents - GET /events, a `clients` event w. the client table (same filter params &&
+// body as GET /clients) immediately && then every `interval` (e.g. 500ms) until the client
+// disconnects
+func (h *adminHandler) serveEvents(w http.ResponseWriter, r *http.Request) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAdminJSON(w, http.StatusInternalServerError, adminError{Error: "streaming unsupported"})
+		return
+	}
+
+	filter, err := parseClientFilter(r)
+	if err != nil {
+		writeAdminJSON(w, http.StatusBadRequest, adminError{Error: err.Error()})
+		return
+	}
+
+	var interval time.Duration = defaultEventInterval
+	if param := r.URL.Query().Get("interval"); param != "" {
+		if interval, err = time.ParseDuration(param); err != nil || interval < minEventInterval {
+			writeAdminJSON(w, http.StatusBadRequest, adminError{
+				Error: fmt.Sprintf("invalid interval %q, must be at least %s", param, minEventInterval),
+			})
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		data, err := json.Marshal(h.table(filter))
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: clients\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package failure
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboard(t *testing.T) {
+
+	n, _ := newTestNode(&NodeOptions{})
+	handler := http.StripPrefix("/admin", n.AdminHandler())
+	for _, path := range []string{"/admin/", "/admin"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+		assert.Contains(t, rec.Body.String(), `new EventSource(base + "events")`)
+	}
+}
+
+// nextEvent - name && data of the next server-sent event on r
+func nextEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	var name, data string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		switch line = strings.TrimSuffix(line, "\n"); {
+		case line == "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+
+	n := adminTestNode(t)
+	srv := httptest.NewServer(n.AdminHandler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events?state=suspected&interval=100ms", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// the first table is sent immediately, the next on the interval
+	r := bufio.NewReader(resp.Body)
+	for i := 0; i < 2; i++ {
+		name, data := nextEvent(t, r)
+		assert.Equal(t, "clients", name)
+
+		var table adminTable
+		require.NoError(t, json.Unmarshal([]byte(data), &table))
+		require.Len(t, table.Clients, 1)
+		assert.Equal(t, "10.0.0.3:40000", table.Clients[0].ClientID)
+	}
+}
+
+func TestEventsInvalidInterval(t *testing.T) {
+
+	n, _ := newTestNode(&NodeOptions{})
+	for _, query := range []string{"interval=fast", "interval=1ms", "sort=color"} {
+		var e adminError
+		assert.Equal(t, http.StatusBadRequest, adminGet(t, n, "/events?"+query, &e), query)
+	}
+}
@@ -2,59 +2,62 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"time"
 
-	lalbproto "github.com/dmw2151/go-failure/example/proto/lalb"
+	fail "github.com/dmw2151/go-failure"
 	orcaproto "github.com/dmw2151/go-failure/example/proto/orca"
+	"github.com/dmw2151/go-failure/phibalancer"
 
-	log "github.com/sirupsen/logrus"
 	grpc "google.golang.org/grpc"
 	insecure "google.golang.org/grpc/credentials/insecure"
+	peer "google.golang.org/grpc/peer"
 )
 
 var (
-	lookAsideLoadBalancerAddr string  = "localhost:52151"
-	svcLabel                  string  = "worker"
-	maxAllowedSuspicion       float64 = 0.8
-	numNodesRequested         int64   = 1
+	lookAsideLoadBalancerAdmin string  = "http://localhost:52150/admin"
+	svcLabel                   string  = "worker"
+	maxAllowedSuspicion        float64 = 0.8
+	numNodesRequested          int64   = 10
 )
 
 func main() {
 
-	conn, _ := grpc.Dial(
-		lookAsideLoadBalancerAddr, []grpc.DialOption{
+	// the look-aside-loadbalancer / discovery service pushes its healthy nodes (w. their phi) to
+	// the phi resolver, the phi_aware policy keeps a connection to each && routes by phi
+	if err := phibalancer.RegisterResolver(&phibalancer.ResolverOptions{
+		URL:      lookAsideLoadBalancerAdmin,
+		Interval: 500 * time.Millisecond,
+		Logger:   fail.SlogLogger(slog.Default()),
+	}); err != nil {
+		slog.Error("failed to register phi resolver", "err", err)
+		return
+	}
+	phibalancer.Register(nil)
+
+	orcaconn, err := grpc.Dial(
+		fmt.Sprintf("%s:///%s?threshold=%v&limit=%d", phibalancer.Scheme, svcLabel, maxAllowedSuspicion, numNodesRequested),
+		[]grpc.DialOption{
 			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithDefaultServiceConfig(fmt.Sprintf(
+				`{"loadBalancingConfig": [{%q: {"threshold": %v}}]}`, phibalancer.Name, maxAllowedSuspicion,
+			)),
 		}...,
 	)
-	defer conn.Close()
-
-	// start the client - this will talk to the look-aside loadbalancing server / discovery service
-	// then one of the downstream application servers
-	lalbClient := lalbproto.NewHeartBeatClient(conn)
-
-	// requesting a healthy node from look-aside-loadbalancer...
-	healthyNodes, _ := lalbClient.HealthyNodes(context.Background(), &lalbproto.NodeHealthRequest{
-		Limit:        numNodesRequested,
-		Threshold:    maxAllowedSuspicion,
-		ServiceLabel: svcLabel,
-	})
-
-	// note: bug here -> the call to healthy nodes returns the *client* address, not the listening
-	// address of the orca server...
-	if len(healthyNodes.Statuses) > 0 {
-		connToUse := healthyNodes.Statuses[0]
-		orcaconn, _ := grpc.Dial(
-			"127.0.0.1:52152", []grpc.DialOption{
-				grpc.WithTransportCredentials(insecure.NewCredentials()),
-			}...,
+	if err != nil {
+		slog.Error("failed to dial nodes", "err", err)
+		return
+	}
+	defer orcaconn.Close()
+
+	// waits for the resolver's first healthy node
+	var p peer.Peer
+	orcaClient := orcaproto.NewORCAClient(orcaconn)
+	if resp, err := orcaClient.Orca(context.Background(), &orcaproto.ORCARequest{}, grpc.WaitForReady(true), grpc.Peer(&p)); err == nil {
+		slog.Info("got an o'reilly animal",
+			"an-orielly-animal", resp.Name,
+			"connection", p.Addr,
 		)
-		defer orcaconn.Close()
-
-		orcaClient := orcaproto.NewORCAClient(orcaconn)
-		if resp, err := orcaClient.Orca(context.Background(), &orcaproto.ORCARequest{}); err == nil {
-			log.WithFields(log.Fields{
-				"an-orielly-animal": resp.Name,
-				"connection":        connToUse.Addr,
-			}).Info("got an o'reilly anima")
-		}
 	}
 }
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"log/slog"
 	"net"
 	"net/http"
+	"os"
 	"time"
 
 	fail "github.com/dmw2151/go-failure"
@@ -11,8 +13,8 @@ import (
 	failproto "github.com/dmw2151/go-failure/proto"
 
 	promhttp "github.com/prometheus/client_golang/prometheus/promhttp"
-	log "github.com/sirupsen/logrus"
 	grpc "google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	emptypb "google.golang.org/protobuf/types/known/emptypb"
 )
 
@@ -20,9 +22,13 @@ var (
 	failureDetectorMetricsAddress = "localhost:52150"
 	balancerListenAddresss        = "localhost:52151"
 
+	logger = slog.New(slog.NewTextHandler(os.Stderr, nil)).With("app", "look-aside-load-balancer")
+
 	nOpts = fail.NodeOptions{
 		EstimationWindowSize: 100,
 		ReapInterval:         time.Second * 10,
+		Logger:               fail.SlogLogger(logger),
+		Processing:           &fail.ProcessingOptions{Mode: fail.ProcessPool, DropPolicy: fail.DropOldest},
 	}
 
 	nMetadata = fail.NodeMetadata{
@@ -46,18 +52,17 @@ func (lb lookasideLoadBalancer) Beat(ctx context.Context, in *failproto.Beat) (*
 func (lb lookasideLoadBalancer) HealthyNodes(ctx context.Context, in *lalbproto.NodeHealthRequest) (*lalbproto.NodeHealthResponse, error) {
 
 	var (
-		hNodes                = []*lalbproto.NodeHealthStatus{}
-		ctr         int64     = 0
-		arrivalTime time.Time = time.Now()
+		hNodes       = []*lalbproto.NodeHealthStatus{}
+		ctr    int64 = 0
 	)
 
 	// todo: run these on own go-routines to save a few ms (prob. only worth when large #
 	// of connected clients)
-	for addr, detector := range lb.failureDetector.RecentClients {
-		if phi := detector.Suspicion(arrivalTime); phi < in.Threshold {
+	for _, client := range lb.failureDetector.Clients() {
+		if client.Phi < in.Threshold {
 			hNodes = append(hNodes, &lalbproto.NodeHealthStatus{
-				Addr:      addr,
-				Suspicion: phi,
+				Addr:      client.Addr,
+				Suspicion: client.Phi,
 			})
 			ctr++
 		}
@@ -74,38 +79,46 @@ func (lb lookasideLoadBalancer) HealthyNodes(ctx context.Context, in *lalbproto.
 
 // startPromMetricsEndPoint -
 func startPromMetricsEndPoint(addr string) {
-	log.Info("starting look-aside-lb metrics server")
+	logger.Info("starting look-aside-lb metrics server", "addr", addr)
 	http.Handle("/metrics", promhttp.Handler())
 	http.ListenAndServe(addr, nil)
 }
 
 func main() {
 
-	// begin serving a metrics endpoint at localhost:52150
-	go startPromMetricsEndPoint(failureDetectorMetricsAddress)
-
 	// init failure detector node & begin monitoring the status of all clients
 	failureDetector := fail.NewFailureDetectorNode(&nOpts, &nMetadata)
 	go failureDetector.WatchConnectedNodes(context.Background())
 
+	// begin serving a metrics endpoint at localhost:52150, w. the detector table under /admin/
+	http.Handle("/admin/", http.StripPrefix("/admin", failureDetector.AdminHandler()))
+	go startPromMetricsEndPoint(failureDetectorMetricsAddress)
+
 	// init grpc server && listen + serve
 	lis, err := net.Listen("tcp", balancerListenAddresss)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"balancerListenAddresss": balancerListenAddresss,
-			"err":                    err,
-		}).Error("failed to start look-aside-lb; failed to listen on address")
+		logger.Error("failed to start look-aside-lb; failed to listen on address",
+			"addr", balancerListenAddresss,
+			"err", err,
+		)
 	}
 
 	// start look-aside load balancer
 	grpcServer := grpc.NewServer(
 		grpc.UnaryInterceptor(failureDetector.FailureDetectorInterceptor()),
+		grpc.StreamInterceptor(failureDetector.FailureDetectorStreamInterceptor()),
 	)
+	failproto.RegisterHeartbeatServer(grpcServer, fail.HeartbeatService{})
+
+	// answers grpc_health_probe -service=worker by the phi of the worker nodes
+	healthpb.RegisterHealthServer(grpcServer, failureDetector.HealthServer(&fail.HealthOptions{
+		Services: map[string]fail.HealthRule{"worker": {MinHealthy: 1}},
+	}))
 
 	lalbproto.RegisterHeartBeatServer(grpcServer, lookasideLoadBalancer{
 		failureDetector: failureDetector,
 	})
 
-	log.Info("starting look-aside-lb server")
+	logger.Info("starting look-aside-lb server", "addr", balancerListenAddresss)
 	grpcServer.Serve(lis)
 }
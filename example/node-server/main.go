@@ -2,83 +2,79 @@ package main
 
 import (
 	"context"
-	"math/rand"
+	"log/slog"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
-	lalbproto "github.com/dmw2151/go-failure/example/proto/lalb"
+	fail "github.com/dmw2151/go-failure"
 	orcaproto "github.com/dmw2151/go-failure/example/proto/orca"
-	failproto "github.com/dmw2151/go-failure/proto"
 
-	log "github.com/sirupsen/logrus"
 	grpc "google.golang.org/grpc"
-	insecure "google.golang.org/grpc/credentials/insecure"
 )
 
 const (
 	lookAsideLoadBalancerAddr string = "localhost:52151"
 	orcaListenAddr            string = "0.0.0.0:52152"
+	orcaAdvertiseAddr         string = "127.0.0.1:52152"
 )
 
 type orcaServer struct {
 	orcaproto.UnimplementedORCAServer
-	heartBeatClient            lalbproto.HeartBeatClient
-	heartBeatPublishIntervalMs int
 }
 
 func (orca orcaServer) Orca(ctx context.Context, req *orcaproto.ORCARequest) (*orcaproto.ORCAResponse, error) {
 	return &orcaproto.ORCAResponse{Name: "Sus Scrofa Linnaeus"}, nil
 }
 
-// publishHeartBeat -
-func (orca *orcaServer) publishHeartBeat(ctx context.Context, msg *failproto.Beat) error {
-	for {
-		log.Info("sending heartbeat message...")
-		dur := time.Duration(rand.Intn(orca.heartBeatPublishIntervalMs)) * time.Millisecond
-		time.Sleep(dur)
-		if _, err := orca.heartBeatClient.Beat(ctx, msg); err != nil {
-			log.Error(err)
-		}
-	}
-	return ctx.Err()
-}
-
 func main() {
 
-	conn, _ := grpc.Dial(
-		lookAsideLoadBalancerAddr, []grpc.DialOption{
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
-		}...,
-	)
-	defer conn.Close()
-
-	// start the load-balancer heartbeat client
-	orca := orcaServer{
-		heartBeatClient:            lalbproto.NewHeartBeatClient(conn),
-		heartBeatPublishIntervalMs: 2000,
-	}
-
-	msg := failproto.Beat{
-		ClientID: "worker",
+	// start publishing heartbeats to the load-balancer (w. the address clients reach the orca
+	// server on), leaving on shutdown
+	publisher, err := fail.NewPublisher(&fail.PublisherOptions{
+		AppID:    "worker",
+		Addr:     orcaAdvertiseAddr,
+		Targets:  []string{lookAsideLoadBalancerAddr},
+		Interval: time.Second,
+		Logger:   fail.SlogLogger(slog.Default()),
+	})
+	if err != nil {
+		slog.Error("failed to start heartbeat publisher", "err", err)
+		return
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go orca.publishHeartBeat(ctx, &msg)
+	go publisher.Run(context.Background())
 
 	// bind to addr && start ORCA server...
 	lis, err := net.Listen("tcp", orcaListenAddr)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"orcaListenAddr": orcaListenAddr,
-			"err":            err,
-		}).Error("failed to start orca server; failed to listen on address")
+		slog.Error("failed to start orca server; failed to listen on address",
+			"addr", orcaListenAddr,
+			"err", err,
+		)
+		publisher.Close()
+		return
 	}
 
 	grpcServer := grpc.NewServer()
-	orcaproto.RegisterORCAServer(grpcServer, orca)
-
-	log.Info("starting orca server")
-	grpcServer.Serve(lis)
+	orcaproto.RegisterORCAServer(grpcServer, orcaServer{})
+
+	// on shutdown, leave first so the load-balancer stops handing out this server, then finish
+	// the RPCs in flight. Serve blocks until then
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		slog.Info("shutting down orca server", "addr", orcaListenAddr)
+		if err := publisher.Close(); err != nil {
+			slog.Warn("failed to leave load-balancer", "err", err)
+		}
+		grpcServer.GracefulStop()
+	}()
 
+	slog.Info("starting orca server", "addr", orcaListenAddr)
+	if err := grpcServer.Serve(lis); err != nil {
+		slog.Error("orca server failed", "err", err)
+	}
 }
@@ -0,0 +1,130 @@
+package failure
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultHealthWatchInterval - time between re-evaluations of a watched service when
+// HealthOptions.WatchInterval is unset
+const DefaultHealthWatchInterval time.Duration = time.Second
+
+// HealthRule - when a service counts as SERVING
+type HealthRule struct {
+	Threshold  float64 // optional, phi a client must stay under to count as healthy, defaults to the node's suspicion threshold
+	MinHealthy int     // optional, healthy clients needed for SERVING, defaults to 1
+}
+
+// HealthOptions - how the node's clients map to grpc.health.v1 service statuses
+type HealthOptions struct {
+	HealthRule                          // rule for every service w/o its own
+	Services      map[string]HealthRule // optional, per-service rules; listed services are never NOT_FOUND
+	WatchInterval time.Duration         // optional, defaults to DefaultHealthWatchInterval
+}
+
+// HealthServer - grpc.health.v1 server answering for each service (i.e. client app ID) by the
+// phi of the node's clients w. that app ID. The empty service, by convention the server itself,
+// is always SERVING
+type HealthServer struct {
+	healthpb.UnimplementedHealthServer
+	node *Node
+	opts *HealthOptions
+}
+
+// HealthServer - grpc.health.v1 server for the node's clients, register it w.
+// healthpb.RegisterHealthServer for grpc_health_probe, kubernetes gRPC probes, etc.
+func (n *Node) HealthServer(opts *HealthOptions) *HealthServer {
+	if opts == nil {
+		opts = &HealthOptions{}
+	}
+	return &HealthServer{node: n, opts: opts}
+}
+
+// Check - implements healthpb.HealthServer, NOT_FOUND for a service the node has no clients of
+// && no rule for
+func (s *HealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	servingStatus := s.evaluate(req.Service)
+	if servingStatus == healthpb.HealthCheckResponse_SERVICE_UNKNOWN {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.Service)
+	}
+	return &healthpb.HealthCheckResponse{Status: servingStatus}, nil
+}
+
+// Watch - implements healthpb.HealthServer, sends the service's status && then every change to
+// it until the stream ends. An unknown service is SERVICE_UNKNOWN until it has clients
+func (s *HealthServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+
+	interval := s.opts.WatchInterval
+	if interval <= 0 {
+		interval = DefaultHealthWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last healthpb.HealthCheckResponse_ServingStatus = -1
+	for {
+		if current := s.evaluate(req.Service); current != last {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: current}); err != nil {
+				return err
+			}
+			last = current
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		}
+	}
+}
+
+// evaluate - service's current status by its rule
+func (s *HealthServer) evaluate(service string) healthpb.HealthCheckResponse_ServingStatus {
+
+	if service == "" {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+
+	rule, configured := s.opts.Services[service]
+	if !configured {
+		rule = s.opts.HealthRule
+	}
+
+	var (
+		threshold  float64 = rule.Threshold
+		minHealthy int     = rule.MinHealthy
+		known      bool    = configured
+		healthy    int
+	)
+	if threshold <= 0 {
+		threshold = s.node.suspicionThreshold()
+	}
+	if minHealthy <= 0 {
+		minHealthy = 1
+	}
+
+	// phi is NaN for a healthy client whose intervals haven't varied yet, only phi at or over
+	// the threshold counts against it
+	for _, client := range s.node.Clients() {
+		if client.AppID != service {
+			continue
+		}
+		known = true
+		if client.State == StateHealthy && !(client.Phi >= threshold) {
+			healthy++
+		}
+	}
+
+	switch {
+	case !known:
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	case healthy >= minHealthy:
+		return healthpb.HealthCheckResponse_SERVING
+	default:
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+}
@@ -0,0 +1,121 @@
+package failure
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// appBeat - send a heartbeat from clientID under appID after advancing the clock by interval
+func appBeat(n *Node, clock *testClock, clientID, appID string, interval time.Duration) {
+	clock.Advance(interval)
+	n.ReceiveHeartbeat(context.Background(), clientID, &failproto.Beat{ClientID: appID})
+}
+
+// checkStatus - status of service by s.Check, SERVICE_UNKNOWN on NOT_FOUND
+func checkStatus(t *testing.T, s *HealthServer, service string) healthpb.HealthCheckResponse_ServingStatus {
+	resp, err := s.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+	if status.Code(err) == codes.NotFound {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+	}
+	require.NoError(t, err)
+	return resp.Status
+}
+
+func TestHealthServerCheck(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{})
+	for _, interval := range []time.Duration{0, 900 * time.Millisecond, 1100 * time.Millisecond} {
+		clock.Advance(interval)
+		appBeat(n, clock, "10.0.0.1:40000", "worker", 0)
+		appBeat(n, clock, "10.0.0.2:40000", "worker", 0)
+		appBeat(n, clock, "10.0.0.3:40000", "api", 0)
+	}
+	appBeat(n, clock, "10.0.0.4:40000", "batch", 0)
+
+	s := n.HealthServer(&HealthOptions{
+		Services: map[string]HealthRule{
+			"worker":  {MinHealthy: 2},
+			"api":     {MinHealthy: 2},
+			"billing": {},
+		},
+	})
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, checkStatus(t, s, ""))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, checkStatus(t, s, "worker"))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, s, "api"))
+
+	// no rule of its own && its only client has too few samples to be healthy
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, s, "batch"))
+
+	// w. a rule a service is known before it has clients
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, s, "billing"))
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVICE_UNKNOWN, checkStatus(t, s, "unknown"))
+
+	// phi rises w/o beats, a lower threshold gives up on the clients sooner
+	clock.Advance(1500 * time.Millisecond)
+	strict := n.HealthServer(&HealthOptions{HealthRule: HealthRule{Threshold: 0.5}})
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, checkStatus(t, s, "worker"))
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, checkStatus(t, strict, "worker"))
+}
+
+func TestHealthServerWatch(t *testing.T) {
+
+	// a's intervals are complete, b is one beat short of healthy
+	n, clock := newTestNode(&NodeOptions{})
+	for i, interval := range []time.Duration{0, 900 * time.Millisecond, 1100 * time.Millisecond} {
+		appBeat(n, clock, "10.0.0.1:40000", "worker", interval)
+		if i < 2 {
+			appBeat(n, clock, "10.0.0.2:40000", "worker", 0)
+		}
+	}
+
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, n.HealthServer(&HealthOptions{
+		HealthRule:    HealthRule{MinHealthy: 2},
+		WatchInterval: 5 * time.Millisecond,
+	}))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{Service: "worker"})
+	require.NoError(t, err)
+
+	next := func() healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := stream.Recv()
+		require.NoError(t, err)
+		return resp.Status
+	}
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, next())
+
+	// only changes are sent
+	n.ReceiveHeartbeat(context.Background(), "10.0.0.2:40000", &failproto.Beat{ClientID: "worker"})
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, next())
+
+	n.ReceiveHeartbeat(context.Background(), "10.0.0.1:40000", &failproto.Beat{ClientID: "worker", Leave: true})
+	assert.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, next())
+
+	n.ReceiveHeartbeat(context.Background(), "10.0.0.2:40000", &failproto.Beat{ClientID: "worker", Leave: true})
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVICE_UNKNOWN, next())
+}
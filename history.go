@@ -0,0 +1,110 @@
+package failure
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultHistorySize - phi samples kept per client when NodeOptions.HistorySize is unset, e.g.
+// 2 min. of reap ticks at 1s
+const DefaultHistorySize int = 120
+
+// PhiSample - a client's suspicion at a point in time
+type PhiSample struct {
+	Time      time.Time
+	Phi       float64
+	Interval  float64 // ms since the previous heartbeat, the arrival interval on a heartbeat
+	Heartbeat bool    // sampled on a heartbeat arrival, otherwise on a reap tick
+}
+
+// phiHistory - fixed-size ring of a client's most recent phi samples
+type phiHistory struct {
+	samples []PhiSample
+	next    int
+	full    bool
+}
+
+// newPhiHistory - ring of size samples, nil (keeps nothing) if size is not positive
+func newPhiHistory(size int) *phiHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &phiHistory{samples: make([]PhiSample, size)}
+}
+
+// add - record a sample in time order, overwriting the oldest once the ring is full. Samples
+// usually come in order, but a pooled heartbeat is timed on arrival && may be recorded after a
+// later reap tick's sample, so a late one is moved back into place (or dropped if it's older
+// than everything the full ring keeps)
+func (h *phiHistory) add(sample PhiSample) {
+	if h == nil {
+		return
+	}
+	if h.full && sample.Time.Before(h.at(0).Time) {
+		return
+	}
+
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % len(h.samples)
+	h.full = h.full || h.next == 0
+
+	for i := h.len() - 1; i > 0 && h.at(i-1).Time.After(sample.Time); i-- {
+		prev, cur := h.index(i-1), h.index(i)
+		h.samples[prev], h.samples[cur] = h.samples[cur], h.samples[prev]
+	}
+}
+
+// len - number of samples held
+func (h *phiHistory) len() int {
+	if h.full {
+		return len(h.samples)
+	}
+	return h.next
+}
+
+// index - position in the ring of the i-th oldest sample
+func (h *phiHistory) index(i int) int {
+	if h.full {
+		return (h.next + i) % len(h.samples)
+	}
+	return i
+}
+
+// at - i-th oldest sample
+func (h *phiHistory) at(i int) PhiSample {
+	return h.samples[h.index(i)]
+}
+
+// since - samples at or after t, oldest first
+func (h *phiHistory) since(t time.Time) []PhiSample {
+	if h == nil {
+		return []PhiSample{}
+	}
+
+	var ordered []PhiSample
+	if h.full {
+		ordered = append(append(ordered, h.samples[h.next:]...), h.samples[:h.next]...)
+	} else {
+		ordered = append(ordered, h.samples[:h.next]...)
+	}
+
+	// samples are kept in time order (see: add), drop everything before t
+	start := sort.Search(len(ordered), func(i int) bool {
+		return !ordered[i].Time.Before(t)
+	})
+	return ordered[start:]
+}
+
+// ClientHistory - a client's phi samples at or after since (zero for all of them), oldest
+// first; false if the node has no record of the client
+func (n *Node) ClientHistory(clientID string, since time.Time) ([]PhiSample, bool) {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	detector, ok := n.RecentClients[clientID]
+	if !ok {
+		return nil, false
+	}
+	return detector.history.since(since), true
+}
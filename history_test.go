@@ -0,0 +1,127 @@
+package failure
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhiHistoryWrap(t *testing.T) {
+
+	h := newPhiHistory(3)
+	for i := 0; i < 5; i++ {
+		h.add(PhiSample{Time: time.Unix(int64(i), 0), Phi: float64(i)})
+	}
+
+	var phis []float64
+	for _, sample := range h.since(time.Time{}) {
+		phis = append(phis, sample.Phi)
+	}
+	assert.Equal(t, []float64{2, 3, 4}, phis)
+	assert.Len(t, h.since(time.Unix(4, 0)), 1)
+	assert.Empty(t, h.since(time.Unix(5, 0)))
+
+	// disabled history keeps nothing
+	var disabled *phiHistory = newPhiHistory(-1)
+	disabled.add(PhiSample{})
+	assert.Empty(t, disabled.since(time.Time{}))
+}
+
+func TestPhiHistoryOutOfOrder(t *testing.T) {
+
+	times := func(samples []PhiSample) []int64 {
+		var ts []int64
+		for _, sample := range samples {
+			ts = append(ts, sample.Time.Unix())
+		}
+		return ts
+	}
+
+	// a heartbeat timed at 3s recorded after the reap tick at 4s goes before it
+	h := newPhiHistory(4)
+	for _, ts := range []int64{1, 2, 4, 3} {
+		h.add(PhiSample{Time: time.Unix(ts, 0)})
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4}, times(h.since(time.Time{})))
+	assert.Equal(t, []int64{3, 4}, times(h.since(time.Unix(3, 0))))
+
+	// ...also once the ring has wrapped, pushing out the oldest
+	h.add(PhiSample{Time: time.Unix(6, 0)})
+	h.add(PhiSample{Time: time.Unix(5, 0)})
+	assert.Equal(t, []int64{3, 4, 5, 6}, times(h.since(time.Time{})))
+	assert.Equal(t, []int64{5, 6}, times(h.since(time.Unix(5, 0))))
+
+	// a sample older than everything kept is dropped
+	h.add(PhiSample{Time: time.Unix(2, 0)})
+	assert.Equal(t, []int64{3, 4, 5, 6}, times(h.since(time.Time{})))
+}
+
+func TestClientHistory(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{PurgeGracePeriod: time.Hour})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+	clock.Advance(1500 * time.Millisecond)
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+
+	// no sample for the first heartbeat, one per later heartbeat && one for the reap
+	history, ok := n.ClientHistory("10.0.0.1:40000", time.Time{})
+	require.True(t, ok)
+	require.Len(t, history, 4)
+	assert.Equal(t, []bool{true, true, true, false}, []bool{
+		history[0].Heartbeat, history[1].Heartbeat, history[2].Heartbeat, history[3].Heartbeat,
+	})
+	assert.Equal(t, 1100.0, history[1].Interval)
+	assert.Equal(t, 1500.0, history[3].Interval)
+	assert.Equal(t, clock.Now(), history[3].Time)
+	assert.Greater(t, history[3].Phi, history[2].Phi)
+
+	recent, _ := n.ClientHistory("10.0.0.1:40000", clock.Now().Add(-2*time.Second))
+	assert.Len(t, recent, 2)
+
+	_, ok = n.ClientHistory("10.0.0.2:40000", time.Time{})
+	assert.False(t, ok)
+}
+
+func TestClientHistorySize(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{HistorySize: 2})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+	history, _ := n.ClientHistory("10.0.0.1:40000", time.Time{})
+	assert.Len(t, history, 2)
+
+	n, clock = newTestNode(&NodeOptions{HistorySize: -1})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+	history, ok := n.ClientHistory("10.0.0.1:40000", time.Time{})
+	assert.True(t, ok)
+	assert.Empty(t, history)
+}
+
+func TestAdminHistory(t *testing.T) {
+
+	n := adminTestNode(t)
+
+	var samples []adminSample
+	require.Equal(t, http.StatusOK, adminGet(t, n, "/clients/10.0.0.3:40000/history", &samples))
+	require.Len(t, samples, 4)
+	assert.False(t, samples[3].Heartbeat)
+	assert.Equal(t, adminFloat(5000), samples[3].Interval)
+
+	require.Equal(t, http.StatusOK, adminGet(t, n, "/clients/10.0.0.3:40000/history?since=0s", &samples))
+	assert.Empty(t, samples)
+	require.Equal(t, http.StatusOK, adminGet(t, n, "/clients/10.0.0.3:40000/history?since=1970-01-01T00:00:08Z", &samples))
+	assert.Len(t, samples, 1)
+
+	var e adminError
+	assert.Equal(t, http.StatusBadRequest, adminGet(t, n, "/clients/10.0.0.3:40000/history?since=yesterday", &e))
+	assert.Equal(t, http.StatusNotFound, adminGet(t, n, "/clients/10.0.0.9:40000/history", &e))
+}
@@ -0,0 +1,147 @@
+package failure
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// DefaultClientIDHeader - metadata key a client sends its app ID in when
+// ImplicitHeartbeatOptions.Header is unset
+const DefaultClientIDHeader string = "x-failure-client-id"
+
+// DefaultImplicitMinInterval - min. time between implicit heartbeats from a client when
+// ImplicitHeartbeatOptions.MinInterval is unset
+const DefaultImplicitMinInterval time.Duration = time.Second
+
+// ImplicitHeartbeatOptions - count ordinary RPCs from recognized clients as heartbeats, so busy
+// clients only need to send explicit Beats while idle. A client is recognized by its app ID in
+// the Header metadata key, && is identified by its peer address like an explicit Beat
+type ImplicitHeartbeatOptions struct {
+	Header string // optional, defaults to DefaultClientIDHeader
+
+	// MinInterval - RPCs sooner than this after the client's last heartbeat (implicit or not)
+	// aren't counted, so a client's traffic rate doesn't skew its window towards zero. Should be
+	// abt. the interval the client sends explicit Beats at, defaults to DefaultImplicitMinInterval
+	MinInterval time.Duration
+
+	// Include - methods whose RPCs count as heartbeats, either full method names
+	// ("/pkg.Service/Method") or services ("/pkg.Service/"). Defaults to every method
+	Include []string
+
+	// Exclude - methods whose RPCs never count, same format as Include && takes precedence
+	Exclude []string
+}
+
+// counts - whether RPCs to fullMethod count as heartbeats
+func (o *ImplicitHeartbeatOptions) counts(fullMethod string) bool {
+	if matchesMethod(o.Exclude, fullMethod) {
+		return false
+	}
+	return len(o.Include) == 0 || matchesMethod(o.Include, fullMethod)
+}
+
+// header - metadata key carrying the client's app ID
+func (o *ImplicitHeartbeatOptions) header() string {
+	if o.Header != "" {
+		return strings.ToLower(o.Header)
+	}
+	return DefaultClientIDHeader
+}
+
+// minInterval - min. time between implicit heartbeats from a client
+func (o *ImplicitHeartbeatOptions) minInterval() time.Duration {
+	if o.MinInterval > 0 {
+		return o.MinInterval
+	}
+	return DefaultImplicitMinInterval
+}
+
+// matchesMethod - fullMethod is one of methods, or in one of the services among them
+func matchesMethod(methods []string, fullMethod string) bool {
+	for _, m := range methods {
+		if m == fullMethod || (strings.HasSuffix(m, "/") && strings.HasPrefix(fullMethod, m)) {
+			return true
+		}
+	}
+	return false
+}
+
+// implicitHeartbeat - count an RPC to fullMethod as a heartbeat, if implicit heartbeats are on &&
+// it comes from a recognized client that's due one
+func (n *Node) implicitHeartbeat(ctx context.Context, fullMethod string) {
+
+	opts := n.opts.Implicit
+	if opts == nil || !opts.counts(fullMethod) {
+		return
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return
+	}
+	appIDs := md.Get(opts.header())
+	if len(appIDs) == 0 || appIDs[0] == "" {
+		return
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return
+	}
+
+	// an ordinary RPC can't carry a signature, under AuthMTLS the header must match the certificate
+	if n.opts.Auth != nil && n.opts.Auth.Mode == AuthHMAC {
+		return
+	}
+
+	clientID := p.Addr.String()
+	if !n.reserveImplicit(clientID, opts.minInterval()) {
+		return
+	}
+	beat, err := n.authenticate(ctx, clientID, &failproto.Beat{ClientID: appIDs[0]})
+	if err != nil {
+		return
+	}
+	n.dispatch(ctx, clientID, beat)
+}
+
+// reserveImplicit - claim an implicit heartbeat for the client if it's due one, i.e. at least
+// minInterval since both its last heartbeat && its last claimed implicit one. The heartbeat is
+// only processed after the claim (maybe by a pool worker), so checking && claiming in one step
+// is what stops concurrent RPCs from a busy client all counting
+func (n *Node) reserveImplicit(clientID string, minInterval time.Duration) bool {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.clock.Now()
+	if detector, ok := n.RecentClients[clientID]; ok && now.Sub(detector.lastHeartbeat) < minInterval {
+		return false
+	}
+	if last, ok := n.implicitLast[clientID]; ok && now.Sub(last) < minInterval {
+		return false
+	}
+	if n.implicitLast == nil {
+		n.implicitLast = make(map[string]time.Time)
+	}
+	n.implicitLast[clientID] = now
+	return true
+}
+
+// pruneImplicit - forget implicit heartbeats claimed over minInterval ago, they no longer hold
+// anything back. caller must hold n.mu
+func (n *Node) pruneImplicit(t time.Time) {
+	if n.opts.Implicit == nil {
+		return
+	}
+	for clientID, last := range n.implicitLast {
+		if t.Sub(last) >= n.opts.Implicit.minInterval() {
+			delete(n.implicitLast, clientID)
+		}
+	}
+}
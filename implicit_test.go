@@ -0,0 +1,182 @@
+package failure
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// rpcContext - incoming context of an RPC from clientID, w. the given metadata pairs
+func rpcContext(t *testing.T, clientID string, kv ...string) context.Context {
+	addr, err := net.ResolveTCPAddr("tcp", clientID)
+	require.NoError(t, err)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(kv...))
+}
+
+// callUnary - an ordinary unary RPC to method through the node's interceptor after advancing the
+// clock by interval
+func callUnary(t *testing.T, ctx context.Context, n *Node, clock *testClock, method string, interval time.Duration) {
+	clock.Advance(interval)
+	_, err := n.FailureDetectorInterceptor()(ctx, &emptypb.Empty{}, &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil },
+	)
+	require.NoError(t, err)
+}
+
+func TestImplicitHeartbeats(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{Implicit: &ImplicitHeartbeatOptions{}})
+	ctx := rpcContext(t, "10.0.0.1:40000", DefaultClientIDHeader, "worker")
+
+	// RPCs closer together than MinInterval count once
+	for _, interval := range []time.Duration{0, 300, 300, 500, 1200, 100} {
+		callUnary(t, ctx, n, clock, "/lalb.HeartBeat/HealthyNodes", interval*time.Millisecond)
+	}
+	window, ok := n.ClientIntervals("10.0.0.1:40000")
+	require.True(t, ok)
+	assert.Equal(t, []float64{1100, 1200}, window)
+
+	status, _ := n.Client("10.0.0.1:40000")
+	assert.Equal(t, "worker", status.AppID)
+
+	// unrecognized clients don't count
+	callUnary(t, rpcContext(t, "10.0.0.2:40000"), n, clock, "/lalb.HeartBeat/HealthyNodes", 0)
+	_, ok = n.Client("10.0.0.2:40000")
+	assert.False(t, ok)
+}
+
+func TestImplicitHeartbeatsDisabled(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{})
+	callUnary(t, rpcContext(t, "10.0.0.1:40000", DefaultClientIDHeader, "worker"), n, clock, "/lalb.HeartBeat/HealthyNodes", 0)
+	assert.Empty(t, n.Clients())
+}
+
+func TestImplicitHeartbeatMethods(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{Implicit: &ImplicitHeartbeatOptions{
+		Header:  "X-Client",
+		Include: []string{"/lalb.HeartBeat/", "/orca.Orca/Report"},
+		Exclude: []string{"/lalb.HeartBeat/HealthyNodes"},
+	}})
+
+	for method, counts := range map[string]bool{
+		"/lalb.HeartBeat/Beat":         true,
+		"/orca.Orca/Report":            true,
+		"/lalb.HeartBeat/HealthyNodes": false,
+		"/orca.Orca/Stream":            false,
+		"/lalb.HeartBeatX/Beat":        false,
+	} {
+		n.RecentClients, n.implicitLast = make(map[string]*PhiAccrualDetector), nil
+		callUnary(t, rpcContext(t, "10.0.0.1:40000", "x-client", "worker"), n, clock, method, 0)
+		_, ok := n.Client("10.0.0.1:40000")
+		assert.Equal(t, counts, ok, method)
+	}
+}
+
+// fakeServerStream - server side of a stream carrying count messages
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	clock *testClock
+	count int
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	if s.count == 0 {
+		return io.EOF
+	}
+	s.count--
+	s.clock.Advance(time.Second)
+	return nil
+}
+
+func TestImplicitHeartbeatsStream(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{Implicit: &ImplicitHeartbeatOptions{}})
+	ss := &fakeServerStream{
+		ctx:   rpcContext(t, "10.0.0.1:40000", DefaultClientIDHeader, "worker"),
+		clock: clock,
+		count: 3,
+	}
+
+	// opening the stream && every message on it counts, ending it w/o Beats isn't a break
+	err := n.FailureDetectorStreamInterceptor()(nil, ss, &grpc.StreamServerInfo{FullMethod: "/orca.Orca/Stream"},
+		func(srv interface{}, stream grpc.ServerStream) error {
+			for {
+				if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+					return nil
+				}
+			}
+		},
+	)
+	require.NoError(t, err)
+
+	status, ok := n.Client("10.0.0.1:40000")
+	require.True(t, ok)
+	assert.Equal(t, 3, status.Samples)
+	assert.Equal(t, StateHealthy, status.State)
+}
+
+func TestImplicitHeartbeatsConcurrent(t *testing.T) {
+
+	// pooled, so no RPC sees another's heartbeat processed before deciding whether it counts
+	n, clock := newTestNode(&NodeOptions{
+		Implicit:   &ImplicitHeartbeatOptions{},
+		Processing: &ProcessingOptions{Mode: ProcessPool, Workers: 1},
+	})
+	counter := &arrivalCounter{}
+	n.AddObserver(counter)
+
+	var (
+		ctx         = rpcContext(t, "10.0.0.1:40000", DefaultClientIDHeader, "worker")
+		interceptor = n.FailureDetectorInterceptor()
+	)
+	burst := func() {
+		var (
+			start = make(chan struct{})
+			wg    sync.WaitGroup
+		)
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				_, err := interceptor(ctx, &emptypb.Empty{}, &grpc.UnaryServerInfo{FullMethod: "/lalb.HeartBeat/HealthyNodes"},
+					func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil },
+				)
+				assert.NoError(t, err)
+			}()
+		}
+		close(start)
+		wg.Wait()
+	}
+
+	// a burst of RPCs counts once per MinInterval
+	burst()
+	clock.Advance(500 * time.Millisecond)
+	burst()
+	clock.Advance(500 * time.Millisecond)
+	burst()
+	n.Close()
+	assert.Equal(t, int64(2), counter.arrivals.Load())
+
+	// claims outliving MinInterval are pruned
+	n.PurgeInactiveClients(context.Background(), clock.Now().Add(time.Second))
+	assert.Empty(t, n.implicitLast)
+}
@@ -0,0 +1,81 @@
+package failure
+
+import (
+	"log/slog"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Logger - structured logger for detector events, args are alternating key/value pairs. The
+// method set matches *slog.Logger, so any *slog.Logger can be used as-is
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// SlogLogger - Logger backed by log/slog, nil uses slog.Default()
+func SlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		return slog.Default()
+	}
+	return l
+}
+
+// logrusLogger - Logger backed by a logrus.FieldLogger
+type logrusLogger struct {
+	l logrus.FieldLogger
+}
+
+// LogrusLogger - Logger backed by logrus, nil uses the global logrus instance (the default for
+// a Node w. no Logger set)
+func LogrusLogger(l logrus.FieldLogger) Logger {
+	if l == nil {
+		l = logrus.StandardLogger()
+	}
+	return logrusLogger{l: l}
+}
+
+func (ll logrusLogger) Debug(msg string, args ...any) { ll.l.WithFields(logrusFields(args)).Debug(msg) }
+func (ll logrusLogger) Info(msg string, args ...any)  { ll.l.WithFields(logrusFields(args)).Info(msg) }
+func (ll logrusLogger) Warn(msg string, args ...any)  { ll.l.WithFields(logrusFields(args)).Warn(msg) }
+func (ll logrusLogger) Error(msg string, args ...any) { ll.l.WithFields(logrusFields(args)).Error(msg) }
+
+// logrusFields - key/value pairs to logrus.Fields, parsed the same as slog: a string key takes
+// the next arg as its value, a slog.Attr stands alone, && anything else (incl. a trailing key w/o
+// a value) is logged under `!BADKEY` on its own
+func logrusFields(args []any) logrus.Fields {
+	fields := make(logrus.Fields, len(args)/2)
+	for len(args) > 0 {
+		switch key := args[0].(type) {
+		case string:
+			if len(args) == 1 {
+				fields["!BADKEY"] = key
+				return fields
+			}
+			fields[key] = args[1]
+			args = args[2:]
+		case slog.Attr:
+			fields[key.Key] = key.Value.Resolve().Any()
+			args = args[1:]
+		default:
+			fields["!BADKEY"] = key
+			args = args[1:]
+		}
+	}
+	return fields
+}
+
+// nopLogger - discards everything
+type nopLogger struct{}
+
+// NopLogger - Logger that discards all detector events
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+func (nopLogger) Debug(msg string, args ...any) {}
+func (nopLogger) Info(msg string, args ...any)  {}
+func (nopLogger) Warn(msg string, args ...any)  {}
+func (nopLogger) Error(msg string, args ...any) {}
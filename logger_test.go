@@ -0,0 +1,48 @@
+package failure
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogLogger(t *testing.T) {
+
+	var buf bytes.Buffer
+	n, clock := newTestNode(&NodeOptions{
+		Logger: SlogLogger(slog.New(slog.NewJSONHandler(&buf, nil))),
+	})
+	beat(n, clock, "10.0.0.1:40000", 0)
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "received heartbeat from new client", line["msg"])
+	assert.Equal(t, "worker", line["client_app_id"])
+	assert.Equal(t, "test-node", line["server_app_id"])
+	assert.Equal(t, "10.0.0.1:40000", line["client_addr"])
+	assert.Equal(t, "127.0.0.1:52151", line["server_addr"])
+}
+
+func TestLogrusFields(t *testing.T) {
+	assert.Equal(t, logrus.Fields{"a": 1, "b": "x"}, logrusFields([]any{"a", 1, "b", "x"}))
+	assert.Equal(t, logrus.Fields{"a": 1, "!BADKEY": "dangling"}, logrusFields([]any{"a", 1, "dangling"}))
+
+	// a non-string key is a value of its own, the rest pair up as they would w. slog
+	args := []any{42, "a", 1, slog.Int("b", 2), "c", "x"}
+	assert.Equal(t, logrus.Fields{"!BADKEY": 42, "a": 1, "b": int64(2), "c": "x"}, logrusFields(args))
+
+	var (
+		buf  bytes.Buffer
+		line map[string]any
+	)
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("msg", args...)
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	for key := range logrusFields(args) {
+		assert.Contains(t, line, key)
+	}
+}
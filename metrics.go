@@ -1,35 +1,453 @@
 package failure
 
 import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// DefaultMetricsNamespace - namespace for a Node's metrics when MetricsOptions.Namespace is unset
+const DefaultMetricsNamespace string = "failure_detector"
+
 var (
+	// failureDetectorLabels - default label set, one series per client
 	failureDetectorLabels = []string{
 		"client_app_id", "server_app_id", "client_addr", "server_addr",
 	}
 
+	// HeartbeatIntervalBuckets - bucket bounds (ms) for the heartbeat interval histogram
+	HeartbeatIntervalBuckets []float64 = prometheus.ExponentialBucketsRange(32, 8192, 16)
+
+	// SuspicionBuckets - bucket bounds for the suspicion (phi) histogram
+	SuspicionBuckets []float64 = prometheus.ExponentialBucketsRange(0.001, 16, 16)
+
+	// tableStates - states a client can be in while still in the node's table
+	tableStates = []ClientState{StateUnknown, StateHealthy, StateSuspected}
+)
+
+// MetricsOptions - where && how a Node publishes its metrics
+type MetricsOptions struct {
+	Registerer  prometheus.Registerer // defaults to prometheus.DefaultRegisterer
+	Namespace   string                // defaults to DefaultMetricsNamespace
+	ConstLabels prometheus.Labels     // added to every series, e.g. to tell nodes in one process apart
+
+	// Labels - subset of `client_app_id`, `server_app_id`, `client_addr` && `server_addr` to put
+	// on client series, defaults to all four. W/o `client_addr` (which w. ephemeral peer ports
+	// means a new series per connection) clients are aggregated by the remaining labels, e.g.
+	// []string{"client_app_id", "server_app_id"} reports per service. Any other label is a
+	// programming error && NewFailureDetectorNode panics on it, as promauto does
+	Labels []string
+
+	// AggregateByApp - report the scrape-time client gauges per client app ID rather than per
+	// client, keeps cardinality to the number of apps
+	AggregateByApp bool
+}
+
+// nodeMetrics - per-node prometheus.Collector; the active client count && client gauges are read
+// from the node's table at scrape time, interval && suspicion histograms are observed as
+// heartbeats arrive
+type nodeMetrics struct {
+	node        *Node
+	labelNames  []string
+	nodeLabels  []string       // server_* labels from labelNames, for series abt. the node itself
+	aggregate   bool           // scrape-time gauges grouped by gaugeLabels rather than per client
+	gaugeLabels []string       //
+	refs        map[string]int // clients contributing to each histogram series, by label values
+	refsMu      sync.Mutex
+
 	// failure_detector_active_clients -> the total number of connected clients
-	activeClientsGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
-		Namespace: "failure_detector",
-		Name:      "active_clients",
-		Help:      "the total number of connected clients",
-	}, failureDetectorLabels)
+	activeClients *prometheus.Desc
 
 	// failure_detector_heartbeat_interval -> agg. heartbeat intervals from clients
-	heartbeatIntervalHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: "failure_detector",
-		Name:      "heartbeat_interval",
-		Help:      "agg. heartbeat intervals from clients",
-		Buckets:   prometheus.ExponentialBucketsRange(32, 8192, 16),
-	}, failureDetectorLabels)
+	heartbeatInterval *prometheus.HistogramVec
 
 	// failure_detector_suspicion -> suspicion distribution for each client
-	suspicionHist = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Namespace: "failure_detector",
-		Name:      "suspicion",
-		Help:      "per-connection suspicion",
-		Buckets:   prometheus.ExponentialBucketsRange(0.001, 16, 16),
-	}, failureDetectorLabels)
-)
+	suspicion *prometheus.HistogramVec
+
+	// failure_detector_heartbeat_queue_depth -> heartbeats queued for each pool worker
+	queueDepth *prometheus.Desc
+
+	// failure_detector_heartbeats_dropped_total -> heartbeats dropped w. the pool's queue full
+	heartbeatsDropped *prometheus.CounterVec
+
+	// failure_detector_heartbeats_rejected_total -> heartbeats that failed authentication (or decoding, over UDP), by reason
+	heartbeatsRejected *prometheus.CounterVec
+
+	// failure_detector_heartbeats_limited_total -> heartbeats over a rate limit, by limit && action
+	heartbeatsLimited *prometheus.CounterVec
+
+	// scrape-time client gauges, see: clientGauges && groupGauges
+	phi            *prometheus.Desc
+	state          *prometheus.Desc
+	sinceHeartbeat *prometheus.Desc
+	intervalMean   *prometheus.Desc
+	intervalStdDev *prometheus.Desc
+}
+
+// newNodeMetrics - metrics collector for n, registered w. mOpts.Registerer. Panics on an invalid
+// label set rather than leave the node running w/o metrics
+func newNodeMetrics(n *Node, mOpts *MetricsOptions) (*nodeMetrics, error) {
+
+	var opts MetricsOptions
+	if mOpts != nil {
+		opts = *mOpts
+	}
+	if opts.Registerer == nil {
+		opts.Registerer = prometheus.DefaultRegisterer
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultMetricsNamespace
+	}
+	if len(opts.Labels) == 0 {
+		opts.Labels = failureDetectorLabels
+	}
+
+	m := &nodeMetrics{
+		node: n,
+		refs: make(map[string]int),
+	}
+
+	if err := m.setLabels(opts.Labels); err != nil {
+		panic(err)
+	}
+	hasClientAddr := len(m.gaugeLabels) < len(m.labelNames)
+
+	// per-client gauges are named client_*, aggregated ones app_*
+	var gaugePrefix string = "client"
+	m.aggregate = opts.AggregateByApp || !hasClientAddr
+	if m.aggregate {
+		gaugePrefix = "app"
+	} else {
+		m.gaugeLabels = m.labelNames
+	}
+
+	gaugeDesc := func(name string, help string, extraLabels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(opts.Namespace, gaugePrefix, name), help,
+			append(append([]string{}, m.gaugeLabels...), extraLabels...), opts.ConstLabels,
+		)
+	}
+
+	m.activeClients = prometheus.NewDesc(
+		prometheus.BuildFQName(opts.Namespace, "", "active_clients"),
+		"the total number of connected clients",
+		m.labelNames, opts.ConstLabels,
+	)
+
+	m.queueDepth = prometheus.NewDesc(
+		prometheus.BuildFQName(opts.Namespace, "", "heartbeat_queue_depth"),
+		"heartbeats queued for each processing pool worker",
+		append(append([]string{}, m.nodeLabels...), "worker"), opts.ConstLabels,
+	)
+
+	m.heartbeatsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   opts.Namespace,
+		Name:        "heartbeats_dropped_total",
+		Help:        "heartbeats dropped by the processing pool's drop policy",
+		ConstLabels: opts.ConstLabels,
+	}, m.nodeLabels)
+
+	m.heartbeatsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   opts.Namespace,
+		Name:        "heartbeats_rejected_total",
+		Help:        "heartbeats rejected by the node's authentication or as malformed, by reason",
+		ConstLabels: opts.ConstLabels,
+	}, append(append([]string{}, m.nodeLabels...), "reason"))
+
+	m.heartbeatsLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   opts.Namespace,
+		Name:        "heartbeats_limited_total",
+		Help:        "heartbeats over the node's per-client (limit=client) or global (limit=global) rate limit, rejected or coalesced",
+		ConstLabels: opts.ConstLabels,
+	}, append(append([]string{}, m.nodeLabels...), "limit", "action"))
+
+	m.heartbeatInterval = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   opts.Namespace,
+		Name:        "heartbeat_interval",
+		Help:        "agg. heartbeat intervals from clients",
+		ConstLabels: opts.ConstLabels,
+		Buckets:     HeartbeatIntervalBuckets,
+	}, m.labelNames)
+
+	m.suspicion = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   opts.Namespace,
+		Name:        "suspicion",
+		Help:        "per-connection suspicion",
+		ConstLabels: opts.ConstLabels,
+		Buckets:     SuspicionBuckets,
+	}, m.labelNames)
+
+	if m.aggregate {
+		m.phi = gaugeDesc("phi_max", "max current suspicion across the app's clients")
+		m.state = gaugeDesc("clients", "number of the app's clients in each state", "state")
+		m.sinceHeartbeat = gaugeDesc("time_since_heartbeat_max", "max time (ms) since a heartbeat from any of the app's clients")
+		m.intervalMean = gaugeDesc("heartbeat_interval_mean", "mean of the app's clients' window mean intervals (ms)")
+		m.intervalStdDev = gaugeDesc("heartbeat_interval_stddev", "mean of the app's clients' window interval std. deviations (ms)")
+	} else {
+		m.phi = gaugeDesc("phi", "current suspicion of the client")
+		m.state = gaugeDesc("state", "1 for the client's current state, 0 otherwise", "state")
+		m.sinceHeartbeat = gaugeDesc("time_since_heartbeat", "time (ms) since the last heartbeat from the client")
+		m.intervalMean = gaugeDesc("heartbeat_interval_mean", "mean heartbeat interval (ms) over the client's window")
+		m.intervalStdDev = gaugeDesc("heartbeat_interval_stddev", "heartbeat interval std. deviation (ms) over the client's window")
+	}
+
+	return m, opts.Registerer.Register(m)
+}
+
+// setLabels - set the histogram && active client labels from a configured subset of
+// failureDetectorLabels, kept in canonical order whatever order they're configured in
+func (m *nodeMetrics) setLabels(configured []string) error {
+
+	m.labelNames, m.gaugeLabels, m.nodeLabels = nil, nil, nil
+	for _, name := range failureDetectorLabels {
+		for _, c := range configured {
+			if c != name {
+				continue
+			}
+			m.labelNames = append(m.labelNames, name)
+			if name != "client_addr" {
+				m.gaugeLabels = append(m.gaugeLabels, name)
+			}
+			if strings.HasPrefix(name, "server_") {
+				m.nodeLabels = append(m.nodeLabels, name)
+			}
+			break // a duplicate leaves labelNames short of configured
+		}
+	}
+
+	if len(m.labelNames) != len(configured) {
+		return fmt.Errorf("failure: unknown or duplicate metric labels in %v, expected a subset of %v", configured, failureDetectorLabels)
+	}
+	return nil
+}
+
+// Describe - implements prometheus.Collector
+func (m *nodeMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.activeClients
+	ch <- m.phi
+	ch <- m.state
+	ch <- m.sinceHeartbeat
+	ch <- m.intervalMean
+	ch <- m.intervalStdDev
+	ch <- m.queueDepth
+	m.heartbeatsDropped.Describe(ch)
+	m.heartbeatsRejected.Describe(ch)
+	m.heartbeatsLimited.Describe(ch)
+	m.heartbeatInterval.Describe(ch)
+	m.suspicion.Describe(ch)
+}
+
+// Collect - implements prometheus.Collector
+func (m *nodeMetrics) Collect(ch chan<- prometheus.Metric) {
+
+	var (
+		statuses []ClientStatus = m.node.Clients()
+		now      time.Time      = m.node.Now()
+		active                  = make(map[string][]string)
+		counts                  = make(map[string]float64)
+		order    []string
+	)
+
+	// one active client series per client, or a count per label set when aggregated
+	for _, status := range statuses {
+		values := m.labelValues(m.labelNames, status.ClientID, status.AppID)
+		key := strings.Join(values, "\xff")
+		if _, ok := active[key]; !ok {
+			active[key] = values
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+	for _, key := range order {
+		ch <- prometheus.MustNewConstMetric(m.activeClients, prometheus.GaugeValue, counts[key], active[key]...)
+	}
+
+	if m.aggregate {
+		m.groupGauges(ch, statuses, now)
+	} else {
+		m.clientGauges(ch, statuses, now)
+	}
+
+	// queue depths only w. a pool, drops only once there are any
+	if m.node.pool != nil {
+		nodeValues := m.labelValues(m.nodeLabels, "", "")
+		for worker, depth := range m.node.pool.depths() {
+			ch <- prometheus.MustNewConstMetric(m.queueDepth, prometheus.GaugeValue, float64(depth),
+				append(append([]string{}, nodeValues...), strconv.Itoa(worker))...,
+			)
+		}
+	}
+	m.heartbeatsDropped.Collect(ch)
+	m.heartbeatsRejected.Collect(ch)
+	m.heartbeatsLimited.Collect(ch)
+
+	m.heartbeatInterval.Collect(ch)
+	m.suspicion.Collect(ch)
+}
+
+// labelValues - values for the given label names for a client of the node
+func (m *nodeMetrics) labelValues(names []string, clientID string, appID string) []string {
+	values := make([]string, len(names))
+	for i, name := range names {
+		switch name {
+		case "client_app_id":
+			values[i] = appID
+		case "server_app_id":
+			values[i] = m.node.metadata.AppID
+		case "client_addr":
+			values[i] = clientID
+		case "server_addr":
+			values[i] = m.node.metadata.HostAddress
+		}
+	}
+	return values
+}
+
+// track - note a new client contributing to its histogram series
+func (m *nodeMetrics) track(clientID string, appID string) {
+	m.refsMu.Lock()
+	defer m.refsMu.Unlock()
+	m.refs[strings.Join(m.labelValues(m.labelNames, clientID, appID), "\xff")]++
+}
+
+// observeHeartbeat - record an interval (ms) && the phi at arrival, phi is skipped if NaN or Inf
+func (m *nodeMetrics) observeHeartbeat(clientID string, appID string, interval float64, phi float64) {
+	values := m.labelValues(m.labelNames, clientID, appID)
+
+	// note: do not update histogram w. the most recent phi if NaN or Inf, these vals
+	// ruin the distribution of the histogram!
+	if !(math.IsNaN(phi) || math.IsInf(phi, 0)) {
+		m.suspicion.WithLabelValues(values...).Observe(phi)
+	}
+	m.heartbeatInterval.WithLabelValues(values...).Observe(interval)
+}
+
+// observeDrop - count a heartbeat dropped by the processing pool
+func (m *nodeMetrics) observeDrop() {
+	m.heartbeatsDropped.WithLabelValues(m.labelValues(m.nodeLabels, "", "")...).Inc()
+}
+
+// observeReject - count a heartbeat rejected by authentication
+func (m *nodeMetrics) observeReject(reason string) {
+	m.heartbeatsRejected.WithLabelValues(append(m.labelValues(m.nodeLabels, "", ""), reason)...).Inc()
+}
+
+// observeLimit - count a heartbeat over a rate limit
+func (m *nodeMetrics) observeLimit(scope string, action string) {
+	m.heartbeatsLimited.WithLabelValues(append(m.labelValues(m.nodeLabels, "", ""), scope, action)...).Inc()
+}
+
+// forget - drop a removed client from its histogram series, the series themselves are deleted
+// once no remaining client contributes to them. Returns the number of series deleted
+func (m *nodeMetrics) forget(clientID string, appID string) int {
+
+	m.refsMu.Lock()
+	defer m.refsMu.Unlock()
+
+	var (
+		values []string = m.labelValues(m.labelNames, clientID, appID)
+		key    string   = strings.Join(values, "\xff")
+	)
+
+	if m.refs[key] > 1 {
+		m.refs[key]--
+		return 0
+	}
+	delete(m.refs, key)
+
+	var deleted int
+	for _, vec := range []*prometheus.HistogramVec{m.heartbeatInterval, m.suspicion} {
+		if vec.DeleteLabelValues(values...) {
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// clientGauges - one series per client for each scrape-time gauge
+func (m *nodeMetrics) clientGauges(ch chan<- prometheus.Metric, statuses []ClientStatus, now time.Time) {
+	for _, status := range statuses {
+		labels := m.labelValues(m.gaugeLabels, status.ClientID, status.AppID)
+
+		for _, state := range tableStates {
+			var v float64
+			if status.State == state {
+				v = 1
+			}
+			ch <- prometheus.MustNewConstMetric(m.state, prometheus.GaugeValue, v, append(labels, state.String())...)
+		}
+
+		ch <- prometheus.MustNewConstMetric(m.sinceHeartbeat, prometheus.GaugeValue,
+			float64(now.Sub(status.LastHeartbeat)/time.Millisecond), labels...,
+		)
+
+		// phi && window stats are NaN until the client has sent enough heartbeats
+		if status.Samples < minPhiSamples {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(m.phi, prometheus.GaugeValue, status.Phi, labels...)
+		ch <- prometheus.MustNewConstMetric(m.intervalMean, prometheus.GaugeValue, status.Mean, labels...)
+		ch <- prometheus.MustNewConstMetric(m.intervalStdDev, prometheus.GaugeValue, status.StdDev, labels...)
+	}
+}
+
+// groupAggregate - scrape-time gauges for all clients sharing the same gauge label values
+type groupAggregate struct {
+	labels           []string
+	states           map[ClientState]int
+	phiMax, sinceMax float64
+	meanSum, stdSum  float64
+	nWithStats       int
+}
+
+// groupGauges - one series per distinct set of gauge label values (e.g. per client app ID) for
+// each scrape-time gauge
+func (m *nodeMetrics) groupGauges(ch chan<- prometheus.Metric, statuses []ClientStatus, now time.Time) {
+
+	var (
+		groups = make(map[string]*groupAggregate)
+		order  []string
+	)
+
+	for _, status := range statuses {
+		labels := m.labelValues(m.gaugeLabels, status.ClientID, status.AppID)
+		key := strings.Join(labels, "\xff")
+
+		agg, ok := groups[key]
+		if !ok {
+			agg = &groupAggregate{labels: labels, states: make(map[ClientState]int), phiMax: math.Inf(-1)}
+			groups[key] = agg
+			order = append(order, key)
+		}
+
+		agg.states[status.State]++
+		agg.sinceMax = math.Max(agg.sinceMax, float64(now.Sub(status.LastHeartbeat)/time.Millisecond))
+		if status.Samples >= minPhiSamples {
+			agg.phiMax = math.Max(agg.phiMax, status.Phi)
+			agg.meanSum += status.Mean
+			agg.stdSum += status.StdDev
+			agg.nWithStats++
+		}
+	}
+
+	for _, key := range order {
+		agg := groups[key]
+
+		for _, state := range tableStates {
+			ch <- prometheus.MustNewConstMetric(m.state, prometheus.GaugeValue, float64(agg.states[state]), append(agg.labels, state.String())...)
+		}
+		ch <- prometheus.MustNewConstMetric(m.sinceHeartbeat, prometheus.GaugeValue, agg.sinceMax, agg.labels...)
+
+		if agg.nWithStats == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(m.phi, prometheus.GaugeValue, agg.phiMax, agg.labels...)
+		ch <- prometheus.MustNewConstMetric(m.intervalMean, prometheus.GaugeValue, agg.meanSum/float64(agg.nWithStats), agg.labels...)
+		ch <- prometheus.MustNewConstMetric(m.intervalStdDev, prometheus.GaugeValue, agg.stdSum/float64(agg.nWithStats), agg.labels...)
+	}
+}
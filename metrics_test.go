@@ -0,0 +1,243 @@
+package failure
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatherValue - value of the single series of a gauge in reg
+func gatherValue(t *testing.T, reg *prometheus.Registry, name string) float64 {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			require.Len(t, family.GetMetric(), 1)
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatalf("no metric %s", name)
+	return 0
+}
+
+func TestNodeMetricsIsolated(t *testing.T) {
+
+	var (
+		regA, regB = prometheus.NewRegistry(), prometheus.NewRegistry()
+		a, clockA  = newTestNode(&NodeOptions{Metrics: &MetricsOptions{Registerer: regA}})
+		b, _       = newTestNode(&NodeOptions{Metrics: &MetricsOptions{Registerer: regB}})
+	)
+
+	for _, interval := range []time.Duration{0, 900, 1100} {
+		beat(a, clockA, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+	beat(a, clockA, "10.0.0.2:40000", 0)
+
+	count, err := testutil.GatherAndCount(regA, "failure_detector_active_clients")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = testutil.GatherAndCount(regB, "failure_detector_active_clients", "failure_detector_heartbeat_interval")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	assert.Equal(t, 0, testutil.CollectAndCount(b.metrics))
+	assert.Equal(t, 1, testutil.CollectAndCount(a.metrics, "failure_detector_heartbeat_interval"))
+}
+
+func TestNodeMetricsNamespaceAndLabels(t *testing.T) {
+
+	reg := prometheus.NewRegistry()
+	n, clock := newTestNode(&NodeOptions{
+		Metrics: &MetricsOptions{
+			Registerer:  reg,
+			Namespace:   "lalb",
+			ConstLabels: prometheus.Labels{"shard": "a"},
+		},
+	})
+	beat(n, clock, "10.0.0.1:40000", 0)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP lalb_active_clients the total number of connected clients
+# TYPE lalb_active_clients gauge
+lalb_active_clients{client_addr="10.0.0.1:40000",client_app_id="worker",server_addr="127.0.0.1:52151",server_app_id="test-node",shard="a"} 1
+`), "lalb_active_clients")
+	assert.NoError(t, err)
+}
+
+func TestActiveClientsAtScrapeTime(t *testing.T) {
+
+	reg := prometheus.NewRegistry()
+	n, clock := newTestNode(&NodeOptions{
+		PurgeGracePeriod: time.Minute,
+		Metrics:          &MetricsOptions{Registerer: reg},
+	})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+
+	count, _ := testutil.GatherAndCount(reg, "failure_detector_active_clients")
+	assert.Equal(t, 1, count)
+
+	clock.Advance(time.Hour)
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+
+	count, _ = testutil.GatherAndCount(reg, "failure_detector_active_clients")
+	assert.Equal(t, 0, count)
+}
+
+func TestClientGaugesAtScrapeTime(t *testing.T) {
+
+	reg := prometheus.NewRegistry()
+	n, clock := newTestNode(&NodeOptions{
+		SuspicionThreshold: 4,
+		Metrics:            &MetricsOptions{Registerer: reg},
+	})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+
+	// no heartbeat arrives, phi still moves between scrapes
+	clock.Advance(500 * time.Millisecond)
+	before := gatherValue(t, reg, "failure_detector_client_phi")
+	clock.Advance(time.Second)
+	after := gatherValue(t, reg, "failure_detector_client_phi")
+	assert.Less(t, before, after)
+
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP failure_detector_client_state 1 for the client's current state, 0 otherwise
+# TYPE failure_detector_client_state gauge
+failure_detector_client_state{client_addr="10.0.0.1:40000",client_app_id="worker",server_addr="127.0.0.1:52151",server_app_id="test-node",state="healthy"} 0
+failure_detector_client_state{client_addr="10.0.0.1:40000",client_app_id="worker",server_addr="127.0.0.1:52151",server_app_id="test-node",state="suspected"} 1
+failure_detector_client_state{client_addr="10.0.0.1:40000",client_app_id="worker",server_addr="127.0.0.1:52151",server_app_id="test-node",state="unknown"} 0
+# HELP failure_detector_client_time_since_heartbeat time (ms) since the last heartbeat from the client
+# TYPE failure_detector_client_time_since_heartbeat gauge
+failure_detector_client_time_since_heartbeat{client_addr="10.0.0.1:40000",client_app_id="worker",server_addr="127.0.0.1:52151",server_app_id="test-node"} 1500
+# HELP failure_detector_client_heartbeat_interval_mean mean heartbeat interval (ms) over the client's window
+# TYPE failure_detector_client_heartbeat_interval_mean gauge
+failure_detector_client_heartbeat_interval_mean{client_addr="10.0.0.1:40000",client_app_id="worker",server_addr="127.0.0.1:52151",server_app_id="test-node"} 1000
+`), "failure_detector_client_state", "failure_detector_client_time_since_heartbeat", "failure_detector_client_heartbeat_interval_mean")
+	assert.NoError(t, err)
+}
+
+func TestClientGaugesAggregateByApp(t *testing.T) {
+
+	reg := prometheus.NewRegistry()
+	n, clock := newTestNode(&NodeOptions{
+		Metrics: &MetricsOptions{Registerer: reg, AggregateByApp: true},
+	})
+	for _, interval := range []time.Duration{0, 900, 1100} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+	beat(n, clock, "10.0.0.2:40000", 0)
+
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP failure_detector_app_clients number of the app's clients in each state
+# TYPE failure_detector_app_clients gauge
+failure_detector_app_clients{client_app_id="worker",server_addr="127.0.0.1:52151",server_app_id="test-node",state="healthy"} 1
+failure_detector_app_clients{client_app_id="worker",server_addr="127.0.0.1:52151",server_app_id="test-node",state="suspected"} 0
+failure_detector_app_clients{client_app_id="worker",server_addr="127.0.0.1:52151",server_app_id="test-node",state="unknown"} 1
+`), "failure_detector_app_clients")
+	assert.NoError(t, err)
+
+	count, _ := testutil.GatherAndCount(reg, "failure_detector_client_phi", "failure_detector_app_phi_max")
+	assert.Equal(t, 1, count)
+}
+
+// seriesWithLabel - number of series across all families in reg w. label == value
+func seriesWithLabel(t *testing.T, reg *prometheus.Registry, label string, value string) int {
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	var count int
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label && pair.GetValue() == value {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+func TestPurgeRemovesAllSeries(t *testing.T) {
+
+	reg := prometheus.NewRegistry()
+	n, clock := newTestNode(&NodeOptions{
+		PurgeGracePeriod: time.Minute,
+		Metrics:          &MetricsOptions{Registerer: reg},
+	})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000, 950} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+		beat(n, clock, "10.0.0.2:40000", 0)
+	}
+	require.NotZero(t, seriesWithLabel(t, reg, "client_addr", "10.0.0.1:40000"))
+
+	// keep 10.0.0.2 alive, let 10.0.0.1 go past the grace period
+	for i := 0; i < 120; i++ {
+		beat(n, clock, "10.0.0.2:40000", time.Second)
+	}
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+
+	_, ok := n.Client("10.0.0.1:40000")
+	require.False(t, ok)
+	assert.Equal(t, 0, seriesWithLabel(t, reg, "client_addr", "10.0.0.1:40000"))
+	assert.NotZero(t, seriesWithLabel(t, reg, "client_addr", "10.0.0.2:40000"))
+}
+
+func TestPurgeRemovesAggregatedSeries(t *testing.T) {
+
+	reg := prometheus.NewRegistry()
+	n, clock := newTestNode(&NodeOptions{
+		PurgeGracePeriod: time.Minute,
+		Metrics: &MetricsOptions{
+			Registerer: reg,
+			Labels:     []string{"server_app_id", "client_app_id"},
+		},
+	})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000, 950} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+		beat(n, clock, "10.0.0.2:40000", 0)
+	}
+
+	// no addr labels anywhere, both clients counted in the one series
+	assert.Equal(t, 0, seriesWithLabel(t, reg, "client_addr", "10.0.0.1:40000"))
+	assert.Equal(t, 2.0, gatherValue(t, reg, "failure_detector_active_clients"))
+
+	// series shared w. a live client survive the purge of the other...
+	for i := 0; i < 120; i++ {
+		beat(n, clock, "10.0.0.2:40000", time.Second)
+	}
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+	assert.Equal(t, 1.0, gatherValue(t, reg, "failure_detector_active_clients"))
+	count, _ := testutil.GatherAndCount(reg, "failure_detector_heartbeat_interval")
+	assert.Equal(t, 1, count)
+
+	// ...and go once the last one is purged
+	clock.Advance(time.Hour)
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+	assert.Equal(t, 0, seriesWithLabel(t, reg, "client_app_id", "worker"))
+}
+
+func TestInvalidMetricLabels(t *testing.T) {
+
+	// a misconfigured node doesn't quietly run w/o metrics
+	for _, labels := range [][]string{{"client_app_id", "pod"}, {"client_app_id", "client_app_id"}} {
+		assert.PanicsWithError(t, fmt.Sprintf("failure: unknown or duplicate metric labels in %v, expected a subset of %v", labels, failureDetectorLabels), func() {
+			newTestNode(&NodeOptions{
+				Metrics: &MetricsOptions{Registerer: prometheus.NewRegistry(), Labels: labels},
+				Logger:  NopLogger(),
+			})
+		})
+	}
+}
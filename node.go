@@ -3,21 +3,31 @@ package failure
 import (
 	"context"
 	"math"
+	"sync"
 	"time"
 
 	failproto "github.com/dmw2151/go-failure/proto"
+	"github.com/dmw2151/go-failure/trace"
 
-	log "github.com/sirupsen/logrus"
-	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/peer"
 )
 
 // Node - collection of health detectors for each client sending through the interceptor
 type Node struct {
-	RecentClients map[string]*PhiAccrualDetector // maps senderAddress -> detector
+	RecentClients map[string]*PhiAccrualDetector // maps senderAddress -> detector, guarded by mu
 	opts          *NodeOptions
 	metadata      *NodeMetadata
+	clock         Clock
+	logger        Logger
+	metrics       *nodeMetrics
+	persist       *persistence
+	pool          *heartbeatPool
+	replays       replayGuard          // latest signed beat from each sender, see: AuthHMAC
+	limiter       *rateLimiter         // nil w/o NodeOptions.RateLimit
+	implicitLast  map[string]time.Time // last implicit heartbeat claimed from each client, guarded by mu
+	observers     []Observer           // guarded by mu
+	mu            sync.RWMutex
 }
 
 // NodeMetadata - metadata abt. the running grpc application for labeling published metrics
@@ -31,72 +41,181 @@ type NodeOptions struct {
 	EstimationWindowSize int
 	ReapInterval         time.Duration
 	PurgeGracePeriod     time.Duration
+	SuspicionThreshold   float64                   // optional, defaults to DefaultSuspicionThreshold
+	HistorySize          int                       // optional, defaults to DefaultHistorySize, < 0 keeps no phi history
+	Clock                Clock                     // optional, defaults to wall time
+	Recorder             trace.Recorder            // optional, receives every arrival and state transition
+	Logger               Logger                    // optional, defaults to the global logrus instance
+	Metrics              *MetricsOptions           // optional, defaults to the default prometheus registry
+	Persistence          *PersistenceOptions       // optional, recover from && persist to a local directory
+	Processing           *ProcessingOptions        // optional, defaults to processing heartbeats synchronously
+	Implicit             *ImplicitHeartbeatOptions // optional, count ordinary RPCs from recognized clients as heartbeats
+	Auth                 *AuthOptions              // optional, defaults to accepting every heartbeat the interceptors receive
+	RateLimit            *RateLimitOptions         // optional, defaults to no limit on the heartbeats the interceptors receive
 }
 
 // NewFailureDetectorNode - new failure-detecting node
 func NewFailureDetectorNode(nOpts *NodeOptions, nMetadata *NodeMetadata) *Node {
-	return &Node{
+
+	var clock Clock = nOpts.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	var logger Logger = nOpts.Logger
+	if logger == nil {
+		logger = LogrusLogger(nil)
+	}
+
+	n := &Node{
 		RecentClients: make(map[string]*PhiAccrualDetector),
 		opts:          nOpts,
 		metadata:      nMetadata,
+		clock:         clock,
+		logger:        logger,
+	}
+
+	// a node whose metrics fail to register still detects failures, its metrics just aren't
+	// exported (e.g. a second node on the same registry w/o distinguishing const labels). Invalid
+	// MetricsOptions.Labels panic instead, see: newNodeMetrics
+	var err error
+	if n.metrics, err = newNodeMetrics(n, nOpts.Metrics); err != nil {
+		logger.Warn("failed to register failure detector metrics",
+			"server_app_id", nMetadata.AppID,
+			"server_addr", nMetadata.HostAddress,
+			"err", err,
+		)
+	}
+
+	// likewise a node that can't recover starts empty && doesn't persist
+	if nOpts.Persistence != nil {
+		if err := n.recover(nOpts.Persistence); err != nil {
+			n.RecentClients, n.persist = make(map[string]*PhiAccrualDetector), nil
+			logger.Error("failed to recover failure detector state",
+				"server_app_id", nMetadata.AppID,
+				"server_addr", nMetadata.HostAddress,
+				"dir", nOpts.Persistence.Dir,
+				"err", err,
+			)
+		}
 	}
+
+	n.limiter = newRateLimiter(nOpts.RateLimit)
+	if nOpts.Processing != nil && nOpts.Processing.Mode == ProcessPool {
+		n.pool = newHeartbeatPool(n, nOpts.Processing)
+	}
+	return n
+}
+
+// Now - current time according to the node's clock
+func (n *Node) Now() time.Time {
+	return n.clock.Now()
 }
 
 // ReceiveHeartbeat - create or update a record in the node's RecentClients
 func (n *Node) ReceiveHeartbeat(ctx context.Context, clientID string, beatmsg *failproto.Beat) error {
+	return n.receiveHeartbeat(ctx, clientID, beatmsg, n.clock.Now())
+}
 
-	var (
-		arrivalTime time.Time = time.Now()
-		phi, delta  float64
-	)
+// receiveHeartbeat - ReceiveHeartbeat for a heartbeat that arrived at arrivalTime
+func (n *Node) receiveHeartbeat(ctx context.Context, clientID string, beatmsg *failproto.Beat, arrivalTime time.Time) error {
+
+	var phi, delta float64
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	// publisher shutting down cleanly, nothing to detect
+	if beatmsg.Leave {
+		if detector, ok := n.RecentClients[clientID]; ok {
+			n.logger.Info("client left, removing",
+				n.clientLogArgs(clientID, detector.metadata.AppID)...,
+			)
+			n.removeClient(clientID, detector, ReasonLeft, arrivalTime)
+		}
+		return nil
+	}
+
+	n.record(&trace.Record{
+		Kind:     trace.KindArrival,
+		ClientID: clientID,
+		AppID:    beatmsg.ClientID,
+		Time:     arrivalTime,
+		Seq:      beatmsg.Seq,
+		Addr:     beatmsg.Addr,
+	})
 
 	// client process already exists -> update entry in RecentClients w. delta since last event
 	if detector, ok := n.RecentClients[clientID]; ok {
-		labels := prometheus.Labels{
-			"client_app_id": beatmsg.ClientID,
-			"server_app_id": n.metadata.AppID,
-			"client_addr":   clientID,
-			"server_addr":   n.metadata.HostAddress,
+
+		if beatmsg.Addr != "" {
+			detector.metadata.HostAddress = beatmsg.Addr
+		}
+
+		// first arrival since a restore, the interval back to the snapshot's last heartbeat spans
+		// the node's downtime -> re-anchor on this arrival instead of adding it to the window
+		if detector.resumed {
+			detector.resumed = false
+			detector.lastHeartbeat = arrivalTime
+			if detector.Samples() >= minPhiSamples {
+				n.transition(clientID, detector, StateHealthy, ReasonDetected, arrivalTime)
+			}
+			return nil
 		}
 
 		delta = float64(arrivalTime.Sub(detector.lastHeartbeat) / time.Millisecond)
 
-		// note: do not update histogram w. the most recent phi if NaN or Inf, these vals
-		// ruin the distribution of the histogram!
 		phi = detector.Suspicion(arrivalTime)
 		if !(math.IsNaN(phi) || math.IsInf(phi, 1) || math.IsInf(phi, -1)) {
 			detector.lastPhi = phi
-			suspicionHist.With(labels).Observe(phi)
 		}
 
-		// update timedelta, always safe to update w. delta, massive times just fall into +Inf 
-		// histogram bucket
+		// update timedelta, always safe to update w. delta, massive times just fall into +Inf
+		// histogram bucket. series are labeled w. the app ID the client joined w. so they can
+		// always be found again on removal
 		detector.AddValue(ctx, arrivalTime)
-		heartbeatIntervalHist.With(labels).Observe(delta)
+		detector.history.add(PhiSample{Time: arrivalTime, Phi: phi, Interval: delta, Heartbeat: true})
+		n.metrics.observeHeartbeat(clientID, detector.metadata.AppID, delta, phi)
+		for _, o := range n.observers {
+			o.ObserveHeartbeat(HeartbeatEvent{
+				ClientID: clientID,
+				AppID:    detector.metadata.AppID,
+				Time:     arrivalTime,
+				Interval: delta,
+				Phi:      phi,
+			})
+		}
+
+		// any arrival clears suspicion, once there's enough data for phi to mean something
+		if detector.Samples() >= minPhiSamples {
+			n.transition(clientID, detector, StateHealthy, ReasonDetected, arrivalTime)
+		}
 		return nil
 	}
 
-	// if client process DNE -> create an entry in RecentClients and increment the guage for
-	// activeClients
+	// if client process DNE -> create an entry in RecentClients, the active clients gauge picks
+	// it up on the next scrape
+	hostAddress := clientID
+	if beatmsg.Addr != "" {
+		hostAddress = beatmsg.Addr
+	}
 	n.RecentClients[clientID] = NewPhiAccrualDetector(arrivalTime, n.opts, &NodeMetadata{
-		HostAddress: clientID,
+		HostAddress: hostAddress,
 		AppID:       beatmsg.ClientID,
 	})
+	n.metrics.track(clientID, beatmsg.ClientID)
+	for _, o := range n.observers {
+		o.ObserveHeartbeat(HeartbeatEvent{
+			ClientID: clientID,
+			AppID:    beatmsg.ClientID,
+			Time:     arrivalTime,
+			First:    true,
+		})
+	}
 
-	log.WithFields(log.Fields{
-		"client_app_id":   beatmsg.ClientID,
-		"server_app_id":   n.metadata.AppID,
-		"client_addr":     clientID,
-		"server_addr":     n.metadata.HostAddress,
-		"current_clients": len(n.RecentClients),
-	}).Info("received heartbeat from new client")
-
-	activeClientsGauge.With(prometheus.Labels{
-		"client_app_id": beatmsg.ClientID,
-		"server_app_id": n.metadata.AppID,
-		"client_addr":   clientID,
-		"server_addr":   n.metadata.HostAddress,
-	}).Inc()
+	n.logger.Info("received heartbeat from new client",
+		n.clientLogArgs(clientID, beatmsg.ClientID, "current_clients", len(n.RecentClients))...,
+	)
 	return nil
 }
 
@@ -107,15 +226,33 @@ func (n *Node) WatchConnectedNodes(ctx context.Context) {
 	logTicker := time.NewTicker(n.opts.ReapInterval)
 	defer logTicker.Stop()
 
+	// checkpoints only w. persistence, a nil channel never fires
+	var checkpoints <-chan time.Time
+	if n.persist != nil {
+		checkpointTicker := time.NewTicker(n.persist.snapshotInterval())
+		defer checkpointTicker.Stop()
+		checkpoints = checkpointTicker.C
+	}
+
 	for {
 		select {
 		case t := <-logTicker.C:
 			n.PurgeInactiveClients(ctx, t)
+		case <-checkpoints:
+			if err := n.Checkpoint(); err != nil && err != errPersistenceClosed {
+				n.logger.Warn("failed to checkpoint failure detector state",
+					"server_app_id", n.metadata.AppID,
+					"server_addr", n.metadata.HostAddress,
+					"err", err,
+				)
+			}
 		case <-ctx.Done():
 			// context cancelled
-			log.WithFields(log.Fields{
-				"err": ctx.Err(),
-			}).Error("conext error")
+			n.logger.Info("stopped watching connected clients",
+				"server_app_id", n.metadata.AppID,
+				"server_addr", n.metadata.HostAddress,
+				"err", ctx.Err(),
+			)
 			return
 		}
 	}
@@ -127,54 +264,174 @@ func (n *Node) PurgeInactiveClients(ctx context.Context, calcTimestamp time.Time
 
 	var phi float64
 
+	if n.opts.Auth != nil && n.opts.Auth.Mode == AuthHMAC {
+		n.replays.prune(calcTimestamp.Add(-n.opts.Auth.maxSkew()))
+	}
+	n.limiter.prune(calcTimestamp)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.pruneImplicit(calcTimestamp)
+
 	// remove clients w. infinite suspicion
 	for addr, detector := range n.RecentClients {
 
 		phi = detector.Suspicion(calcTimestamp)
 		detector.lastPhi = phi
+		detector.history.add(PhiSample{
+			Time:     calcTimestamp,
+			Phi:      phi,
+			Interval: float64(calcTimestamp.Sub(detector.lastHeartbeat) / time.Millisecond),
+		})
+
+		if detector.state == StateHealthy && phi >= n.suspicionThreshold() {
+			n.transition(addr, detector, StateSuspected, ReasonDetected, calcTimestamp)
+		}
 
 		// require the following two conditions -
 		if (calcTimestamp.Sub(detector.lastHeartbeat) > n.opts.PurgeGracePeriod) && (phi == math.Inf(1)) {
 
-			var labels = prometheus.Labels{
-				"client_app_id": detector.metadata.AppID,
-				"server_app_id": n.metadata.AppID,
-				"client_addr":   addr,
-				"server_addr":   n.metadata.HostAddress,
-			}
+			n.logger.Info("no heartbeat from client in max suspicion interval, removing",
+				n.clientLogArgs(addr, detector.metadata.AppID)...,
+			)
 
-			// if client process suspicion == 1 & age -> decrement the guage for activeClients
-			activeClientsGauge.With(labels).Dec()
-			if n := heartbeatIntervalHist.DeletePartialMatch(labels); n == 0 {
-				log.WithFields(log.Fields{
-					"labels": labels,
-				}).Warn("failed to remove metrics of (suspected) crashed process")
-			}
+			n.removeClient(addr, detector, ReasonPurged, calcTimestamp)
+		}
+	}
+}
+
+// removeClient - drop a client from the node && every metric series that belongs to it, the
+// active clients gauge && client gauges stop reporting it once it's out of RecentClients.
+// caller must hold n.mu
+func (n *Node) removeClient(clientID string, detector *PhiAccrualDetector, reason TransitionReason, t time.Time) {
+	n.transition(clientID, detector, StateRemoved, reason, t)
+	n.metrics.forget(clientID, detector.metadata.AppID)
+	delete(n.RecentClients, clientID)
+}
+
+// suspicionThreshold - phi at which a healthy client becomes suspected
+func (n *Node) suspicionThreshold() float64 {
+	if n.opts.SuspicionThreshold > 0 {
+		return n.opts.SuspicionThreshold
+	}
+	return DefaultSuspicionThreshold
+}
+
+// transition - move a client to a new state for reason, recording the change if the state differs
+func (n *Node) transition(clientID string, detector *PhiAccrualDetector, to ClientState, reason TransitionReason, t time.Time) {
+
+	var from ClientState = detector.state
+	if from == to {
+		return
+	}
+	detector.state = to
 
-			log.WithFields(log.Fields{
-				"client_app_id": detector.metadata.AppID,
-				"server_app_id": n.metadata.AppID,
-				"client_addr":   addr,
-				"server_addr":   n.metadata.HostAddress,
-			}).Info("no heartbeat from client in max suspicion interval, removing")
+	n.logger.Debug("client state changed",
+		n.clientLogArgs(clientID, detector.metadata.AppID, "from", from.String(), "to", to.String(), "reason", reason.String())...,
+	)
+
+	n.record(&trace.Record{
+		Kind:     trace.KindTransition,
+		ClientID: clientID,
+		AppID:    detector.metadata.AppID,
+		Time:     t,
+		From:     from.String(),
+		To:       to.String(),
+	})
 
-			// warn:
-			delete(n.RecentClients, addr)
+	for _, o := range n.observers {
+		o.ObserveTransition(TransitionEvent{
+			ClientID: clientID,
+			AppID:    detector.metadata.AppID,
+			Time:     t,
+			From:     from,
+			To:       to,
+			Reason:   reason,
+			Phi:      detector.lastPhi,
+		})
+	}
+}
+
+// clientLogArgs - key/value pairs identifying a client (and this node) on every log line abt.
+// that client, followed by any extra pairs
+func (n *Node) clientLogArgs(clientID string, appID string, extra ...any) []any {
+	return append([]any{
+		"client_app_id", appID,
+		"server_app_id", n.metadata.AppID,
+		"client_addr", clientID,
+		"server_addr", n.metadata.HostAddress,
+	}, extra...)
+}
+
+// record - write a record to the node's trace && WAL, if any; failing to record never fails the
+// heartbeat itself. caller must hold n.mu
+func (n *Node) record(rec *trace.Record) {
+	if n.persist != nil {
+		if err := n.persist.append(rec); err != nil && err != errPersistenceClosed {
+			n.logger.Warn("failed to append to WAL",
+				n.clientLogArgs(rec.ClientID, rec.AppID, "kind", string(rec.Kind), "err", err)...,
+			)
 		}
 	}
+	if n.opts.Recorder == nil {
+		return
+	}
+	if err := n.opts.Recorder.Record(rec); err != nil {
+		n.logger.Warn("failed to record trace",
+			n.clientLogArgs(rec.ClientID, rec.AppID, "kind", string(rec.Kind), "err", err)...,
+		)
+	}
 }
 
 // FailureDetectorInterceptor - Acts as a UnaryServerInterceptor, updates detector node's heartbeat statistics when sees
-// an incoming failproto.Beat message
+// an incoming failproto.Beat message, or any other RPC from a recognized client w. NodeOptions.Implicit
 func (n *Node) FailureDetectorInterceptor() grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		// todo: add a check for `service-name` here + add a check for incoming *listen* address, not incoming client address!!
 		if msg, ok := req.(*failproto.Beat); ok {
 			if p, ok := peer.FromContext(ctx); ok {
-				go n.ReceiveHeartbeat(ctx, p.Addr.String(), msg)
+				// limited before authenticating, checking a flood of signatures is the expensive part
+				process, err := n.limit(p.Addr.String(), msg)
+				if err != nil {
+					return nil, err
+				}
+				if process {
+					beat, err := n.authenticate(ctx, p.Addr.String(), msg)
+					if err != nil {
+						return nil, err
+					}
+					n.dispatch(ctx, p.Addr.String(), beat)
+				}
 			}
+		} else {
+			n.implicitHeartbeat(ctx, info.FullMethod)
 		}
 		h, err := handler(ctx, req)
 		return h, err
 	}
 }
+
+// dispatch - process a heartbeat from the interceptor per NodeOptions.Processing. Pooled
+// heartbeats outlive the RPC, so they keep its values but not its cancellation
+func (n *Node) dispatch(ctx context.Context, clientID string, beatmsg *failproto.Beat) {
+
+	var arrivalTime time.Time = n.clock.Now()
+	if n.pool == nil {
+		n.receiveHeartbeat(ctx, clientID, beatmsg, arrivalTime)
+		return
+	}
+
+	n.pool.submit(ctx, heartbeatTask{
+		ctx:         context.WithoutCancel(ctx),
+		clientID:    clientID,
+		beat:        beatmsg,
+		arrivalTime: arrivalTime,
+	})
+}
+
+// Close - drain && stop the heartbeat worker pool, then checkpoint && close the node's WAL.
+// Heartbeats after Close are processed synchronously && no longer persisted
+func (n *Node) Close() error {
+	n.pool.close()
+	return n.closePersistence()
+}
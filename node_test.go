@@ -0,0 +1,210 @@
+package failure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+	"github.com/dmw2151/go-failure/trace"
+
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	log.SetLevel(log.WarnLevel)
+	os.Exit(m.Run())
+}
+
+// testClock - manually advanced clock, safe to read from a node's listener goroutines
+type testClock struct {
+	now time.Time // guarded by mu
+	mu  sync.Mutex
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestNode - node on a test clock starting at the unix epoch, metrics go to a fresh registry
+// unless set
+func newTestNode(nOpts *NodeOptions) (*Node, *testClock) {
+	clock := &testClock{now: time.Unix(0, 0)}
+	nOpts.Clock = clock
+	if nOpts.EstimationWindowSize == 0 {
+		nOpts.EstimationWindowSize = 100
+	}
+	if nOpts.Metrics == nil {
+		nOpts.Metrics = &MetricsOptions{Registerer: prometheus.NewRegistry()}
+	}
+	return NewFailureDetectorNode(nOpts, &NodeMetadata{
+		HostAddress: "127.0.0.1:52151",
+		AppID:       "test-node",
+	}), clock
+}
+
+// beat - send a heartbeat from clientID to the node after advancing the clock by interval
+func beat(n *Node, clock *testClock, clientID string, interval time.Duration) {
+	clock.Advance(interval)
+	n.ReceiveHeartbeat(context.Background(), clientID, &failproto.Beat{ClientID: "worker"})
+}
+
+func TestReceiveHeartbeat(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{})
+
+	beat(n, clock, "10.0.0.1:40000", 0)
+	status, ok := n.Client("10.0.0.1:40000")
+	require.True(t, ok)
+	assert.Equal(t, "worker", status.AppID)
+	assert.Equal(t, "10.0.0.1:40000", status.Addr)
+	assert.Equal(t, StateUnknown, status.State)
+	assert.Equal(t, 0, status.Samples)
+
+	beat(n, clock, "10.0.0.1:40000", 900*time.Millisecond)
+	beat(n, clock, "10.0.0.1:40000", 1100*time.Millisecond)
+	status, _ = n.Client("10.0.0.1:40000")
+	assert.Equal(t, StateHealthy, status.State)
+	assert.Equal(t, 2, status.Samples)
+	assert.Equal(t, clock.Now(), status.LastHeartbeat)
+
+	_, ok = n.Client("10.0.0.2:40000")
+	assert.False(t, ok)
+}
+
+func TestClientTransitions(t *testing.T) {
+
+	var buf bytes.Buffer
+	n, clock := newTestNode(&NodeOptions{
+		PurgeGracePeriod:   time.Minute,
+		SuspicionThreshold: 4,
+		Recorder:           trace.NewJSONWriter(&buf),
+	})
+
+	for _, interval := range []time.Duration{0, 900, 1100, 1000, 950} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+	}
+
+	// reap shortly after a heartbeat -> still healthy
+	clock.Advance(500 * time.Millisecond)
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+	status, _ := n.Client("10.0.0.1:40000")
+	assert.Equal(t, StateHealthy, status.State)
+
+	// well overdue -> suspected, but within grace period
+	clock.Advance(10 * time.Second)
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+	status, _ = n.Client("10.0.0.1:40000")
+	assert.Equal(t, StateSuspected, status.State)
+
+	// next heartbeat clears suspicion
+	beat(n, clock, "10.0.0.1:40000", 0)
+	status, _ = n.Client("10.0.0.1:40000")
+	assert.Equal(t, StateHealthy, status.State)
+
+	// past the grace period w. infinite phi -> suspected && removed on the same reap
+	clock.Advance(time.Hour)
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+	_, ok := n.Client("10.0.0.1:40000")
+	assert.False(t, ok)
+
+	records, err := trace.ReadAll(trace.NewJSONReader(&buf))
+	require.NoError(t, err)
+
+	var transitions []string
+	for _, rec := range records {
+		if rec.Kind == trace.KindTransition {
+			transitions = append(transitions, rec.From+"->"+rec.To)
+		}
+	}
+	assert.Equal(t, []string{
+		"unknown->healthy", "healthy->suspected", "suspected->healthy", "healthy->suspected", "suspected->removed",
+	}, transitions)
+}
+
+func TestClientsSorted(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{})
+	for _, clientID := range []string{"10.0.0.3:1", "10.0.0.1:1", "10.0.0.2:1"} {
+		beat(n, clock, clientID, time.Millisecond)
+	}
+
+	var ids []string
+	for _, status := range n.Clients() {
+		ids = append(ids, status.ClientID)
+	}
+	assert.Equal(t, []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.3:1"}, ids)
+}
+
+// populatedNode - node w. nClients healthy clients, each w. a full window of intervals
+func populatedNode(nClients int, windowSize int) (*Node, *testClock, []string) {
+
+	n, clock := newTestNode(&NodeOptions{
+		EstimationWindowSize: windowSize,
+		PurgeGracePeriod:     time.Hour,
+	})
+
+	clientIDs := make([]string, nClients)
+	for i := range clientIDs {
+		clientIDs[i] = fmt.Sprintf("10.0.%d.%d:40000", i/256, i%256)
+	}
+	for i := 0; i <= windowSize; i++ {
+		for _, clientID := range clientIDs {
+			beat(n, clock, clientID, time.Duration(900+i%200)*time.Millisecond/time.Duration(nClients))
+		}
+	}
+	return n, clock, clientIDs
+}
+
+func BenchmarkReceiveHeartbeat(b *testing.B) {
+	for _, nClients := range []int{1, 100, 10000} {
+		for _, windowSize := range []int{10, 100} {
+			b.Run(fmt.Sprintf("clients=%d/window=%d", nClients, windowSize), func(b *testing.B) {
+				var (
+					n, clock, clientIDs = populatedNode(nClients, windowSize)
+					ctx                 = context.Background()
+					msg                 = &failproto.Beat{ClientID: "worker"}
+				)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					clock.Advance(time.Millisecond)
+					n.ReceiveHeartbeat(ctx, clientIDs[i%nClients], msg)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkPurgeInactiveClients(b *testing.B) {
+	for _, nClients := range []int{100, 1000, 10000} {
+		for _, windowSize := range []int{10, 100} {
+			b.Run(fmt.Sprintf("clients=%d/window=%d", nClients, windowSize), func(b *testing.B) {
+				var (
+					n, clock, _ = populatedNode(nClients, windowSize)
+					ctx         = context.Background()
+				)
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					n.PurgeInactiveClients(ctx, clock.Now())
+				}
+			})
+		}
+	}
+}
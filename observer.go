@@ -0,0 +1,46 @@
+package failure
+
+import (
+	"time"
+)
+
+// Observer - receives arrivals && state transitions as the node processes them, e.g. to export
+// them to a telemetry system other than prometheus. Called w. the node's lock held, so
+// implementations must return quickly && must not call back into the node
+type Observer interface {
+	ObserveHeartbeat(ev HeartbeatEvent)
+	ObserveTransition(ev TransitionEvent)
+}
+
+// HeartbeatEvent - a single heartbeat arrival
+type HeartbeatEvent struct {
+	ClientID string
+	AppID    string // app ID the client joined w.
+	Time     time.Time
+	First    bool    // first heartbeat from the client, Interval && Phi are unset
+	Interval float64 // ms since the client's previous heartbeat
+	Phi      float64 // suspicion immediately before the arrival
+}
+
+// TransitionEvent - a client moving between states
+type TransitionEvent struct {
+	ClientID string
+	AppID    string
+	Time     time.Time
+	From     ClientState
+	To       ClientState
+	Reason   TransitionReason // e.g. ReasonLeft for a client removed on a clean shutdown
+	Phi      float64          // suspicion at the time of the transition
+}
+
+// AddObserver - register an observer for every subsequent arrival && transition
+func (n *Node) AddObserver(o Observer) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.observers = append(n.observers, o)
+}
+
+// Metadata - metadata the node was created w.
+func (n *Node) Metadata() NodeMetadata {
+	return *n.metadata
+}
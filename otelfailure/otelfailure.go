@@ -0,0 +1,226 @@
+// Package otelfailure - optional OpenTelemetry instrumentation for a failure.Node. Publishes the
+// same heartbeat interval, suspicion && active client instruments as the node's prometheus
+// collector through a MeterProvider, && traces each client's lifetime on the node as a span w.
+// one event per state transition
+package otelfailure
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	failure "github.com/dmw2151/go-failure"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName - instrumentation scope for the meter && tracer
+const ScopeName string = "github.com/dmw2151/go-failure/otelfailure"
+
+// Options - where the instrumentation publishes to
+type Options struct {
+	MeterProvider  metric.MeterProvider // optional, defaults to otel.GetMeterProvider()
+	TracerProvider trace.TracerProvider // optional, defaults to otel.GetTracerProvider()
+
+	// ClientAddr - put `client_addr` on metrics, w. ephemeral peer ports this means new series
+	// per connection so by default metrics are aggregated by client app ID. Spans always carry it
+	ClientAddr bool
+}
+
+// Instrumentation - failure.Observer publishing a node's events to OpenTelemetry
+type Instrumentation struct {
+	node         *failure.Node
+	opts         Options
+	serverAttrs  []attribute.KeyValue
+	tracer       trace.Tracer
+	interval     metric.Float64Histogram
+	suspicion    metric.Float64Histogram
+	registration metric.Registration
+	spans        map[string]trace.Span // open client spans by client ID, guarded by mu
+	closed       bool
+	mu           sync.Mutex
+}
+
+// Instrument - create the node's instruments && register as an observer on the node. Clients
+// already on the node are counted as active but only get a span if they rejoin
+func Instrument(n *failure.Node, opts *Options) (*Instrumentation, error) {
+
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	var (
+		mp  metric.MeterProvider = opts.MeterProvider
+		tp  trace.TracerProvider = opts.TracerProvider
+		md  failure.NodeMetadata = n.Metadata()
+		err error
+	)
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	inst := &Instrumentation{
+		node: n,
+		opts: *opts,
+		serverAttrs: []attribute.KeyValue{
+			attribute.String("server_app_id", md.AppID),
+			attribute.String("server_addr", md.HostAddress),
+		},
+		tracer: tp.Tracer(ScopeName),
+		spans:  make(map[string]trace.Span),
+	}
+
+	meter := mp.Meter(ScopeName)
+
+	// failure_detector.heartbeat.interval -> agg. heartbeat intervals from clients
+	if inst.interval, err = meter.Float64Histogram("failure_detector.heartbeat.interval",
+		metric.WithDescription("agg. heartbeat intervals from clients"),
+		metric.WithUnit("ms"),
+		metric.WithExplicitBucketBoundaries(failure.HeartbeatIntervalBuckets...),
+	); err != nil {
+		return nil, err
+	}
+
+	// failure_detector.suspicion -> per-connection suspicion
+	if inst.suspicion, err = meter.Float64Histogram("failure_detector.suspicion",
+		metric.WithDescription("per-connection suspicion"),
+		metric.WithUnit("1"),
+		metric.WithExplicitBucketBoundaries(failure.SuspicionBuckets...),
+	); err != nil {
+		return nil, err
+	}
+
+	// failure_detector.active_clients -> the total number of connected clients, read from the
+	// node's table at collection time
+	activeClients, err := meter.Int64ObservableGauge("failure_detector.active_clients",
+		metric.WithDescription("the total number of connected clients"),
+		metric.WithUnit("{client}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if inst.registration, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		var (
+			counts = make(map[attribute.Distinct]int64)
+			sets   = make(map[attribute.Distinct]attribute.Set)
+		)
+		for _, status := range n.Clients() {
+			set := inst.metricAttrs(status.ClientID, status.AppID)
+			counts[set.Equivalent()]++
+			sets[set.Equivalent()] = set
+		}
+		for key, count := range counts {
+			o.ObserveInt64(activeClients, count, metric.WithAttributeSet(sets[key]))
+		}
+		return nil
+	}, activeClients); err != nil {
+		return nil, err
+	}
+
+	n.AddObserver(inst)
+	return inst, nil
+}
+
+// metricAttrs - attributes for a client's measurements
+func (inst *Instrumentation) metricAttrs(clientID string, appID string) attribute.Set {
+	attrs := append([]attribute.KeyValue{attribute.String("client_app_id", appID)}, inst.serverAttrs...)
+	if inst.opts.ClientAddr {
+		attrs = append(attrs, attribute.String("client_addr", clientID))
+	}
+	return attribute.NewSet(attrs...)
+}
+
+// ObserveHeartbeat - record interval && suspicion, start the client's span on its first heartbeat
+func (inst *Instrumentation) ObserveHeartbeat(ev failure.HeartbeatEvent) {
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.closed {
+		return
+	}
+
+	if ev.First {
+		_, span := inst.tracer.Start(context.Background(), "failure_detector.client",
+			trace.WithTimestamp(ev.Time),
+			trace.WithSpanKind(trace.SpanKindInternal),
+			trace.WithNewRoot(),
+			trace.WithAttributes(
+				attribute.String("client_app_id", ev.AppID),
+				attribute.String("client_addr", ev.ClientID),
+			),
+			trace.WithAttributes(inst.serverAttrs...),
+		)
+		inst.spans[ev.ClientID] = span
+		return
+	}
+
+	// same measurements as the prometheus histograms, NaN && Inf phi would ruin the distribution
+	ctx, attrs := context.Background(), metric.WithAttributeSet(inst.metricAttrs(ev.ClientID, ev.AppID))
+	if !(math.IsNaN(ev.Phi) || math.IsInf(ev.Phi, 0)) {
+		inst.suspicion.Record(ctx, ev.Phi, attrs)
+	}
+	inst.interval.Record(ctx, ev.Interval, attrs)
+}
+
+// ObserveTransition - add a state change event to the client's span, ending it on removal
+func (inst *Instrumentation) ObserveTransition(ev failure.TransitionEvent) {
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.closed {
+		return
+	}
+
+	span, ok := inst.spans[ev.ClientID]
+	if !ok {
+		return
+	}
+
+	span.AddEvent("state_change",
+		trace.WithTimestamp(ev.Time),
+		trace.WithAttributes(
+			attribute.String("from", ev.From.String()),
+			attribute.String("to", ev.To.String()),
+			attribute.String("reason", ev.Reason.String()),
+			attribute.Float64("phi", ev.Phi),
+		),
+	)
+
+	// a client that left shut down cleanly, only a purge is a failure
+	if ev.To == failure.StateRemoved {
+		if ev.Reason == failure.ReasonLeft {
+			span.SetStatus(codes.Ok, "")
+		} else {
+			span.SetStatus(codes.Error, "client removed after max suspicion interval")
+		}
+		span.End(trace.WithTimestamp(ev.Time))
+		delete(inst.spans, ev.ClientID)
+	}
+}
+
+// Close - stop reporting active clients && end the spans of clients still on the node, later
+// events from the node are ignored
+func (inst *Instrumentation) Close() error {
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if inst.closed {
+		return nil
+	}
+	inst.closed = true
+
+	t := inst.node.Now()
+	for clientID, span := range inst.spans {
+		span.End(trace.WithTimestamp(t))
+		delete(inst.spans, clientID)
+	}
+	return inst.registration.Unregister()
+}
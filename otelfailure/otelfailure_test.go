@@ -0,0 +1,201 @@
+package otelfailure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	failure "github.com/dmw2151/go-failure"
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// testClock - manually advanced clock
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+// harness - instrumented node w. in-memory metric reader && span recorder
+type harness struct {
+	node   *failure.Node
+	clock  *testClock
+	inst   *Instrumentation
+	reader *sdkmetric.ManualReader
+	spans  *tracetest.SpanRecorder
+}
+
+func newHarness(t *testing.T, opts Options) *harness {
+	h := &harness{
+		clock:  &testClock{now: time.Unix(0, 0)},
+		reader: sdkmetric.NewManualReader(),
+		spans:  tracetest.NewSpanRecorder(),
+	}
+	h.node = failure.NewFailureDetectorNode(&failure.NodeOptions{
+		EstimationWindowSize: 100,
+		PurgeGracePeriod:     time.Minute,
+		Clock:                h.clock,
+		Logger:               failure.NopLogger(),
+		Metrics:              &failure.MetricsOptions{Registerer: prometheus.NewRegistry()},
+	}, &failure.NodeMetadata{HostAddress: "127.0.0.1:52151", AppID: "test-node"})
+
+	opts.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(h.reader))
+	opts.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(h.spans))
+
+	var err error
+	h.inst, err = Instrument(h.node, &opts)
+	require.NoError(t, err)
+	return h
+}
+
+// beat - send a heartbeat from clientID after advancing the clock by interval
+func (h *harness) beat(clientID string, interval time.Duration) {
+	h.clock.now = h.clock.now.Add(interval)
+	h.node.ReceiveHeartbeat(context.Background(), clientID, &failproto.Beat{ClientID: "worker"})
+}
+
+// collect - metrics by instrument name
+func (h *harness) collect(t *testing.T) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, h.reader.Collect(context.Background(), &rm))
+
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+func TestInstruments(t *testing.T) {
+
+	h := newHarness(t, Options{})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000} {
+		h.beat("10.0.0.1:40000", interval*time.Millisecond)
+	}
+	h.beat("10.0.0.2:40000", 0)
+
+	metrics := h.collect(t)
+
+	// both clients of the one app are counted in a single point w/o client_addr
+	active := metrics["failure_detector.active_clients"].(metricdata.Gauge[int64])
+	require.Len(t, active.DataPoints, 1)
+	assert.Equal(t, int64(2), active.DataPoints[0].Value)
+	appID, _ := active.DataPoints[0].Attributes.Value("client_app_id")
+	assert.Equal(t, "worker", appID.AsString())
+	_, ok := active.DataPoints[0].Attributes.Value("client_addr")
+	assert.False(t, ok)
+
+	interval := metrics["failure_detector.heartbeat.interval"].(metricdata.Histogram[float64])
+	require.Len(t, interval.DataPoints, 1)
+	assert.Equal(t, uint64(3), interval.DataPoints[0].Count)
+	assert.Equal(t, 3000.0, interval.DataPoints[0].Sum)
+	assert.Equal(t, failure.HeartbeatIntervalBuckets, interval.DataPoints[0].Bounds)
+
+	// phi is undefined until the detector has samples, so fewer observations than intervals
+	suspicion := metrics["failure_detector.suspicion"].(metricdata.Histogram[float64])
+	require.Len(t, suspicion.DataPoints, 1)
+	assert.Less(t, suspicion.DataPoints[0].Count, uint64(3))
+}
+
+func TestInstrumentsClientAddr(t *testing.T) {
+
+	h := newHarness(t, Options{ClientAddr: true})
+	h.beat("10.0.0.1:40000", 0)
+	h.beat("10.0.0.2:40000", 0)
+
+	active := h.collect(t)["failure_detector.active_clients"].(metricdata.Gauge[int64])
+	require.Len(t, active.DataPoints, 2)
+	for _, dp := range active.DataPoints {
+		assert.Equal(t, int64(1), dp.Value)
+		assert.True(t, dp.Attributes.HasValue("client_addr"))
+	}
+}
+
+func TestClientSpan(t *testing.T) {
+
+	h := newHarness(t, Options{})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000} {
+		h.beat("10.0.0.1:40000", interval*time.Millisecond)
+	}
+	require.Empty(t, h.spans.Ended())
+
+	// silent past the grace period -> suspected && removed in the one purge
+	h.clock.now = h.clock.now.Add(time.Hour)
+	h.node.PurgeInactiveClients(context.Background(), h.clock.Now())
+
+	ended := h.spans.Ended()
+	require.Len(t, ended, 1)
+	span := ended[0]
+
+	assert.Equal(t, "failure_detector.client", span.Name())
+	assert.Equal(t, time.Unix(0, 0), span.StartTime())
+	assert.Equal(t, h.clock.Now(), span.EndTime())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Contains(t, span.Attributes(), attribute.String("client_addr", "10.0.0.1:40000"))
+	assert.Contains(t, span.Attributes(), attribute.String("server_app_id", "test-node"))
+
+	var transitions []string
+	for _, ev := range span.Events() {
+		assert.Equal(t, "state_change", ev.Name)
+		var from, to string
+		for _, kv := range ev.Attributes {
+			switch kv.Key {
+			case "from":
+				from = kv.Value.AsString()
+			case "to":
+				to = kv.Value.AsString()
+			}
+		}
+		transitions = append(transitions, from+"->"+to)
+	}
+	assert.Equal(t, []string{"unknown->healthy", "healthy->suspected", "suspected->removed"}, transitions)
+
+	// removed clients drop out of the active clients gauge
+	_, ok := h.collect(t)["failure_detector.active_clients"]
+	assert.False(t, ok)
+}
+
+func TestClientSpanLeave(t *testing.T) {
+
+	h := newHarness(t, Options{})
+	for _, interval := range []time.Duration{0, 900, 1100} {
+		h.beat("10.0.0.1:40000", interval*time.Millisecond)
+	}
+
+	// a clean shutdown isn't a failure
+	h.node.ReceiveHeartbeat(context.Background(), "10.0.0.1:40000", &failproto.Beat{ClientID: "worker", Leave: true})
+	ended := h.spans.Ended()
+	require.Len(t, ended, 1)
+	assert.Equal(t, codes.Ok, ended[0].Status().Code)
+
+	events := ended[0].Events()
+	assert.Contains(t, events[len(events)-1].Attributes, attribute.String("reason", "left"))
+}
+
+func TestClose(t *testing.T) {
+
+	h := newHarness(t, Options{})
+	h.beat("10.0.0.1:40000", 0)
+	require.NoError(t, h.inst.Close())
+
+	// open spans end on close && the gauge stops reporting
+	require.Len(t, h.spans.Ended(), 1)
+	h.beat("10.0.0.2:40000", 0)
+	assert.Len(t, h.spans.Started(), 1)
+	_, ok := h.collect(t)["failure_detector.active_clients"]
+	assert.False(t, ok)
+}
@@ -0,0 +1,435 @@
+package failure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+	"github.com/dmw2151/go-failure/trace"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Persistence
+//
+// A node w. NodeOptions.Persistence keeps its state in opts.Dir as numbered generations of
+//
+//	snapshot-<gen>.pb   -> NodeSnapshot of the table as of the start of wal-<gen>
+//	wal-<gen>.phtr      -> every arrival && transition since, as a binary trace (see: trace)
+//
+// A checkpoint, under the node's lock, snapshots the table && switches new records to
+// wal-<gen+1>; the snapshot is then written to a temp file, synced && renamed into place as
+// snapshot-<gen+1>, && only then are older generations removed. Recovery loads the newest
+// complete snapshot && replays every WAL from its generation on, so a crash at any point
+// leaves either the old snapshot && both WALs or the new snapshot && the new WAL, && a record cut
+// short by a crash mid-write is dropped from the end of the WAL.
+
+// DefaultSnapshotInterval - time between checkpoints when PersistenceOptions.SnapshotInterval
+// is unset
+const DefaultSnapshotInterval time.Duration = time.Minute
+
+var (
+	// ErrNoPersistence - Checkpoint on a node w/o NodeOptions.Persistence
+	ErrNoPersistence = errors.New("node has no persistence configured")
+
+	// errPersistenceClosed - node's persistence already closed
+	errPersistenceClosed = errors.New("persistence closed")
+)
+
+// PersistenceOptions - local directory a node keeps its state in across restarts
+type PersistenceOptions struct {
+	Dir              string
+	SnapshotInterval time.Duration   // optional, defaults to DefaultSnapshotInterval
+	Sync             bool            // fsync the WAL after every record, survives power loss && not just process crashes
+	Restore          *RestoreOptions // optional, how long the node can be down before recovered state is discarded
+}
+
+// persistence - a node's open WAL && checkpoint state
+type persistence struct {
+	opts         *PersistenceOptions
+	gen          uint64              // generation of the open WAL, guarded by the node's lock
+	wal          *os.File            // guarded by the node's lock
+	writer       *trace.BinaryWriter // guarded by the node's lock
+	closed       bool                // guarded by the node's lock
+	checkpointMu sync.Mutex          // one checkpoint at a time
+}
+
+// snapshotFile - path of a generation's snapshot
+func (p *persistence) snapshotFile(gen uint64) string {
+	return filepath.Join(p.opts.Dir, fmt.Sprintf("snapshot-%020d.pb", gen))
+}
+
+// walFile - path of a generation's WAL
+func (p *persistence) walFile(gen uint64) string {
+	return filepath.Join(p.opts.Dir, fmt.Sprintf("wal-%020d.phtr", gen))
+}
+
+// generations - generations of the files in dir w. prefix && ext, ascending
+func (p *persistence) generations(prefix string, ext string) ([]uint64, error) {
+
+	entries, err := os.ReadDir(p.opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var gens []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		gen, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		gens = append(gens, gen)
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i] < gens[j] })
+	return gens, nil
+}
+
+// append - write a record to the open WAL, caller must hold the node's lock
+func (p *persistence) append(rec *trace.Record) error {
+	if p.writer == nil {
+		return errPersistenceClosed
+	}
+	if err := p.writer.Record(rec); err != nil {
+		return err
+	}
+	if p.opts.Sync {
+		return p.wal.Sync()
+	}
+	return nil
+}
+
+// recover - load the node's table from opts.Dir && start persisting to it, called once from
+// NewFailureDetectorNode before the node is shared
+func (n *Node) recover(opts *PersistenceOptions) error {
+
+	p := &persistence{opts: opts}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return err
+	}
+
+	// temp files are snapshots that never made it into place
+	if tmps, err := filepath.Glob(filepath.Join(opts.Dir, "*.tmp")); err == nil {
+		for _, tmp := range tmps {
+			os.Remove(tmp)
+		}
+	}
+
+	snapshots, err := p.generations("snapshot-", ".pb")
+	if err != nil {
+		return err
+	}
+	wals, err := p.generations("wal-", ".phtr")
+	if err != nil {
+		return err
+	}
+
+	// down since the last thing the node persisted
+	var downAt time.Time
+	if len(snapshots) > 0 {
+		p.gen = snapshots[len(snapshots)-1]
+		if downAt, err = n.loadSnapshot(p.snapshotFile(p.gen)); err != nil {
+			return err
+		}
+	}
+
+	var replayed int
+	for _, gen := range wals {
+		if gen < p.gen {
+			continue
+		}
+		last, count, err := n.replayWAL(p.walFile(gen))
+		if err != nil {
+			return err
+		}
+		if last.After(downAt) {
+			downAt = last
+		}
+		replayed += count
+		p.gen = gen
+	}
+
+	var (
+		now    time.Time     = n.clock.Now()
+		age    time.Duration = now.Sub(downAt)
+		maxAge time.Duration = DefaultSnapshotMaxAge
+	)
+	if opts.Restore != nil && opts.Restore.MaxAge != 0 {
+		maxAge = opts.Restore.MaxAge
+	}
+	if age < 0 || downAt.IsZero() {
+		age = 0 // clock skew between the writer && this node, or nothing persisted yet
+	}
+
+	if maxAge > 0 && age > maxAge && len(n.RecentClients) > 0 {
+		n.logger.Warn("discarding recovered clients, node down longer than max age",
+			"server_app_id", n.metadata.AppID,
+			"server_addr", n.metadata.HostAddress,
+			"clients", len(n.RecentClients),
+			"down_for", age.String(),
+		)
+		n.RecentClients = make(map[string]*PhiAccrualDetector)
+	}
+
+	// same age adjustment as Restore, the node's downtime isn't held against its clients
+	for clientID, detector := range n.RecentClients {
+		detector.lastHeartbeat = detector.lastHeartbeat.Add(age)
+		detector.resumed = true
+		n.metrics.track(clientID, detector.metadata.AppID)
+	}
+
+	n.logger.Info("recovered clients from persisted state",
+		"server_app_id", n.metadata.AppID,
+		"server_addr", n.metadata.HostAddress,
+		"dir", opts.Dir,
+		"clients", len(n.RecentClients),
+		"wal_records", replayed,
+		"down_for", age.String(),
+	)
+
+	// start a fresh generation from the recovered table, also drops any torn WAL tail
+	n.persist = p
+	return n.Checkpoint()
+}
+
+// loadSnapshot - add a snapshot file's clients to the table as they were when it was taken,
+// returns the time it was taken
+func (n *Node) loadSnapshot(path string) (time.Time, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var snapshot failproto.NodeSnapshot
+	if err := proto.Unmarshal(data, &snapshot); err != nil {
+		return time.Time{}, fmt.Errorf("failed to decode snapshot %s: %w", path, err)
+	}
+	if snapshot.Version == 0 || snapshot.Version > SnapshotVersion {
+		return time.Time{}, fmt.Errorf("%w: %d", ErrSnapshotVersion, snapshot.Version)
+	}
+
+	for _, client := range snapshot.Clients {
+		n.RecentClients[client.ClientAddr] = n.restoreDetector(client, 0)
+	}
+	return time.Unix(0, snapshot.TakenAtUnixNano), nil
+}
+
+// replayWAL - apply a WAL's records to the table, returns the time of the latest record && the
+// number of records applied. Reading stops at the first record that can't be read, i.e. one
+// cut short by a crash
+func (n *Node) replayWAL(path string) (time.Time, int, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	defer f.Close()
+
+	var (
+		reader *trace.BinaryReader = trace.NewBinaryReader(f)
+		last   time.Time
+		count  int
+	)
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			return last, count, nil
+		}
+		if err != nil {
+			n.logger.Warn("dropping unreadable WAL tail",
+				"server_app_id", n.metadata.AppID,
+				"server_addr", n.metadata.HostAddress,
+				"wal", path,
+				"records", count,
+				"err", err,
+			)
+			return last, count, nil
+		}
+		n.replay(rec)
+		if rec.Time.After(last) {
+			last = rec.Time // pooled heartbeats from different clients can be recorded out of order
+		}
+		count++
+	}
+}
+
+// replay - apply a single WAL record, mirrors ReceiveHeartbeat && transition w/o logging,
+// metrics or observers
+func (n *Node) replay(rec *trace.Record) {
+
+	detector, ok := n.RecentClients[rec.ClientID]
+
+	switch rec.Kind {
+	case trace.KindArrival:
+		if !ok {
+			hostAddress := rec.ClientID
+			if rec.Addr != "" {
+				hostAddress = rec.Addr
+			}
+			n.RecentClients[rec.ClientID] = NewPhiAccrualDetector(rec.Time, n.opts, &NodeMetadata{
+				HostAddress: hostAddress,
+				AppID:       rec.AppID,
+			})
+			return
+		}
+		if rec.Addr != "" {
+			detector.metadata.HostAddress = rec.Addr
+		}
+		if detector.resumed {
+			detector.resumed = false
+			detector.lastHeartbeat = rec.Time
+			return
+		}
+		detector.AddValue(context.Background(), rec.Time)
+
+	case trace.KindTransition:
+		if !ok {
+			return
+		}
+		to, err := ParseClientState(rec.To)
+		if err != nil {
+			return
+		}
+		if to == StateRemoved {
+			delete(n.RecentClients, rec.ClientID)
+			return
+		}
+		detector.state = to
+	}
+}
+
+// Checkpoint - snapshot the node to its persistence directory && start a new WAL, dropping
+// older generations. Runs every SnapshotInterval from WatchConnectedNodes, returns
+// ErrNoPersistence if the node was created w/o NodeOptions.Persistence
+func (n *Node) Checkpoint() error {
+
+	p := n.persist
+	if p == nil {
+		return ErrNoPersistence
+	}
+
+	p.checkpointMu.Lock()
+	defer p.checkpointMu.Unlock()
+
+	// snapshot && switch WALs atomically w.r.t. arrivals, every record after the snapshot goes
+	// to the new generation
+	n.mu.Lock()
+	if p.closed {
+		n.mu.Unlock()
+		return errPersistenceClosed
+	}
+
+	var (
+		snapshot *failproto.NodeSnapshot = n.snapshot()
+		gen      uint64                  = p.gen + 1
+		prev     *os.File                = p.wal
+	)
+	wal, err := os.OpenFile(p.walFile(gen), os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_EXCL, 0o644)
+	if err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	p.gen, p.wal, p.writer = gen, wal, trace.NewBinaryWriter(wal)
+	n.mu.Unlock()
+
+	if prev != nil {
+		prev.Close()
+	}
+
+	data, err := proto.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(p.snapshotFile(gen), data); err != nil {
+		return err
+	}
+
+	// new snapshot in place, everything before it is redundant
+	for _, kind := range [][2]string{{"snapshot-", ".pb"}, {"wal-", ".phtr"}} {
+		gens, err := p.generations(kind[0], kind[1])
+		if err != nil {
+			return err
+		}
+		for _, old := range gens {
+			if old >= gen {
+				continue
+			}
+			os.Remove(filepath.Join(p.opts.Dir, fmt.Sprintf("%s%020d%s", kind[0], old, kind[1])))
+		}
+	}
+	return nil
+}
+
+// closePersistence - checkpoint && close the node's WAL, see: Close
+func (n *Node) closePersistence() error {
+
+	p := n.persist
+	if p == nil {
+		return nil
+	}
+	err := n.Checkpoint()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if p.wal != nil {
+		if closeErr := p.wal.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	p.wal, p.writer, p.closed = nil, nil, true
+	return err
+}
+
+// snapshotInterval - time between checkpoints
+func (p *persistence) snapshotInterval() time.Duration {
+	if p.opts.SnapshotInterval > 0 {
+		return p.opts.SnapshotInterval
+	}
+	return DefaultSnapshotInterval
+}
+
+// writeFileAtomic - write data to path via a synced temp file && rename, so path only ever
+// holds a complete file
+func writeFileAtomic(path string, data []byte) error {
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// sync the directory so the rename itself is durable
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
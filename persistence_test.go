@@ -0,0 +1,290 @@
+package failure
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crashDirEnv - set in the subprocess started by TestPersistenceCrashConsistency
+const crashDirEnv string = "FAILURE_PERSIST_CRASH_DIR"
+
+// newPersistentNode - test node persisting to dir w. its clock at now, trusting recovered state
+// of any age
+func newPersistentNode(dir string, now time.Time) (*Node, *testClock) {
+	clock := &testClock{now: now}
+	return NewFailureDetectorNode(&NodeOptions{
+		EstimationWindowSize: 100,
+		PurgeGracePeriod:     2 * time.Second,
+		Clock:                clock,
+		Logger:               NopLogger(),
+		Metrics:              &MetricsOptions{Registerer: prometheus.NewRegistry()},
+		Persistence:          &PersistenceOptions{Dir: dir, Restore: &RestoreOptions{MaxAge: -1}},
+	}, &NodeMetadata{
+		HostAddress: "127.0.0.1:52151",
+		AppID:       "test-node",
+	}), clock
+}
+
+// crashWorkloadStep - step i of a deterministic workload: five clients heartbeating at uneven
+// intervals, the last of which stops at step 100 && is eventually removed. The first two
+// advertise the address they serve on, the first only from step 60 on. Every tenth step is
+// a reap rather than an arrival so a step is never half an arrival && half a purge
+func crashWorkloadStep(n *Node, clock *testClock, i int) {
+
+	clock.Advance(time.Duration(150+(i*37)%100) * time.Millisecond)
+	switch client := i % 5; {
+	case i%10 == 9:
+		n.PurgeInactiveClients(context.Background(), clock.Now())
+	case client == 4 && i >= 100:
+	default:
+		beat := &failproto.Beat{ClientID: "worker"}
+		if client == 1 || (client == 0 && i >= 60) {
+			beat.Addr = fmt.Sprintf("10.0.0.%d:8080", client)
+		}
+		n.ReceiveHeartbeat(context.Background(), fmt.Sprintf("10.0.0.%d:40000", client), beat)
+	}
+	if i%25 == 24 {
+		n.Checkpoint()
+	}
+}
+
+// tableSignature - every client's addresses, sample count && window, i.e. everything recovery
+// rebuilds from arrivals
+func tableSignature(n *Node) string {
+	var sig strings.Builder
+	for _, status := range n.Clients() {
+		window, _ := n.ClientIntervals(status.ClientID)
+		fmt.Fprintf(&sig, "%s %s %d %v\n", status.ClientID, status.Addr, status.Samples, window)
+	}
+	return sig.String()
+}
+
+// assertSameTable - recovered has the same clients, states && windows as want
+func assertSameTable(t *testing.T, want *Node, recovered *Node) {
+	assert.Equal(t, tableSignature(want), tableSignature(recovered))
+	wantClients, gotClients := want.Clients(), recovered.Clients()
+	require.Equal(t, len(wantClients), len(gotClients))
+	for i := range wantClients {
+		assert.Equal(t, wantClients[i].State, gotClients[i].State, wantClients[i].ClientID)
+		assert.Equal(t, wantClients[i].AppID, gotClients[i].AppID)
+	}
+}
+
+func TestPersistenceRecover(t *testing.T) {
+
+	dir := t.TempDir()
+	n, clock := newPersistentNode(dir, time.Unix(0, 0))
+	for i := 0; i < 300; i++ {
+		crashWorkloadStep(n, clock, i)
+	}
+	_, ok := n.Client("10.0.0.4:40000")
+	require.False(t, ok, "stopped client should have been removed")
+	status, _ := n.Client("10.0.0.0:40000")
+	require.Equal(t, "10.0.0.0:8080", status.Addr)
+
+	// abandoned w/o Close, i.e. crashed w. everything since the last checkpoint in the WAL
+	recovered, _ := newPersistentNode(dir, clock.Now())
+	assertSameTable(t, n, recovered)
+
+	// recovery starts a new generation, leaving one snapshot && one WAL
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Len(t, files, 2)
+}
+
+func TestPersistenceRecoveredClientResumes(t *testing.T) {
+
+	dir := t.TempDir()
+	n, clock := newPersistentNode(dir, time.Unix(0, 0))
+	for i := 0; i < 50; i++ {
+		crashWorkloadStep(n, clock, i)
+	}
+	require.NoError(t, n.Close())
+	assert.ErrorIs(t, n.Checkpoint(), errPersistenceClosed)
+
+	// a node w/o persistence has nothing to checkpoint
+	plain, _ := newTestNode(&NodeOptions{})
+	assert.ErrorIs(t, plain.Checkpoint(), ErrNoPersistence)
+
+	// down for a minute, phi && windows carry on w/o the downtime
+	recovered, recoveredClock := newPersistentNode(dir, clock.Now().Add(time.Minute))
+	before, _ := n.Client("10.0.0.1:40000")
+	after, _ := recovered.Client("10.0.0.1:40000")
+	assert.InDelta(t, before.Phi, after.Phi, 1e-9)
+
+	window, _ := recovered.ClientIntervals("10.0.0.1:40000")
+	beat(recovered, recoveredClock, "10.0.0.1:40000", time.Second)
+	resumedWindow, _ := recovered.ClientIntervals("10.0.0.1:40000")
+	assert.Equal(t, window, resumedWindow)
+
+	// ...&& the re-anchoring arrival is itself replayed as one
+	again, _ := newPersistentNode(dir, recoveredClock.Now())
+	assert.Equal(t, tableSignature(recovered), tableSignature(again))
+}
+
+func TestPersistenceTornWAL(t *testing.T) {
+
+	dir := t.TempDir()
+	n, clock := newPersistentNode(dir, time.Unix(0, 0))
+	for i := 0; i < 40; i++ {
+		crashWorkloadStep(n, clock, i)
+	}
+
+	// a record cut short mid-write, framed as 100 bytes w. only a few present
+	wals, _ := filepath.Glob(filepath.Join(dir, "wal-*.phtr"))
+	require.Len(t, wals, 1)
+	f, err := os.OpenFile(wals[0], os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	f.Write([]byte{100, 1, 2, 3})
+	f.Close()
+
+	recovered, recoveredClock := newPersistentNode(dir, clock.Now())
+	assertSameTable(t, n, recovered)
+
+	// the torn tail is gone after recovery, further records aren't appended behind it
+	for i := 40; i < 60; i++ {
+		crashWorkloadStep(recovered, recoveredClock, i)
+	}
+	again, _ := newPersistentNode(dir, recoveredClock.Now())
+	assert.Equal(t, tableSignature(recovered), tableSignature(again))
+}
+
+// copyDir - copy the regular files in src to dst
+func copyDir(t *testing.T, src string, dst string) {
+	entries, err := os.ReadDir(src)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(src, entry.Name()))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dst, entry.Name()), data, 0o644))
+	}
+}
+
+func TestPersistenceCrashDuringCheckpoint(t *testing.T) {
+
+	var (
+		dir, before = t.TempDir(), t.TempDir()
+		n, clock    = newPersistentNode(dir, time.Unix(0, 0))
+	)
+	for i := 0; i < 24; i++ {
+		crashWorkloadStep(n, clock, i)
+	}
+	copyDir(t, dir, before)
+
+	// checkpoint && carry on, then rebuild the directory as if the process died after the new
+	// WAL was created but before the new snapshot was renamed into place
+	require.NoError(t, n.Checkpoint())
+	for i := 25; i < 40; i++ {
+		crashWorkloadStep(n, clock, i)
+	}
+	snapshots, _ := filepath.Glob(filepath.Join(dir, "snapshot-*.pb"))
+	wals, _ := filepath.Glob(filepath.Join(dir, "wal-*.phtr"))
+	require.Len(t, snapshots, 1)
+	require.Len(t, wals, 1)
+
+	crashed := t.TempDir()
+	copyDir(t, before, crashed)
+	data, _ := os.ReadFile(wals[0])
+	require.NoError(t, os.WriteFile(filepath.Join(crashed, filepath.Base(wals[0])), data, 0o644))
+	snapshot, _ := os.ReadFile(snapshots[0])
+	require.NoError(t, os.WriteFile(filepath.Join(crashed, filepath.Base(snapshots[0])+".tmp"), snapshot[:len(snapshot)/2], 0o644))
+
+	recovered, _ := newPersistentNode(crashed, clock.Now())
+	assertSameTable(t, n, recovered)
+}
+
+func TestPersistenceDiscardsStaleState(t *testing.T) {
+
+	dir := t.TempDir()
+	n, clock := newTestNode(&NodeOptions{Logger: NopLogger(), Persistence: &PersistenceOptions{Dir: dir}})
+	for i := 0; i < 20; i++ {
+		crashWorkloadStep(n, clock, i)
+	}
+	require.NotEmpty(t, n.Clients())
+
+	recovered, recoveredClock := newTestNode(&NodeOptions{Logger: NopLogger()})
+	recoveredClock.now = clock.Now().Add(DefaultSnapshotMaxAge + time.Minute)
+	recovered.opts.Persistence = &PersistenceOptions{Dir: dir}
+	require.NoError(t, recovered.recover(recovered.opts.Persistence))
+	assert.Empty(t, recovered.Clients())
+}
+
+// TestPersistenceCrashHelper - workload run in a subprocess by TestPersistenceCrashConsistency,
+// acks each completed step on stdout && runs until killed
+func TestPersistenceCrashHelper(t *testing.T) {
+
+	dir := os.Getenv(crashDirEnv)
+	if dir == "" {
+		t.Skip("only run as a subprocess of TestPersistenceCrashConsistency")
+	}
+
+	n, clock := newPersistentNode(dir, time.Unix(0, 0))
+	for i := 0; ; i++ {
+		crashWorkloadStep(n, clock, i)
+		fmt.Printf("ack %d\n", i)
+	}
+}
+
+func TestPersistenceCrashConsistency(t *testing.T) {
+
+	if testing.Short() {
+		t.Skip("starts subprocesses")
+	}
+
+	// last step after which the in-memory model is in each state, reaps that change nothing leave
+	// the same state over several steps
+	var (
+		maxSteps    = 20000
+		model, mClk = newTestNode(&NodeOptions{PurgeGracePeriod: 2 * time.Second, Logger: NopLogger()})
+		signatures  = make(map[string]int, maxSteps)
+	)
+	for i := 0; i < maxSteps; i++ {
+		crashWorkloadStep(model, mClk, i)
+		signatures[tableSignature(model)] = i
+	}
+
+	for run := 0; run < 5; run++ {
+
+		var (
+			dir    = t.TempDir()
+			killAt = 50 + rand.Intn(1000)
+			cmd    = exec.Command(os.Args[0], "-test.run=^TestPersistenceCrashHelper$")
+		)
+		cmd.Env = append(os.Environ(), crashDirEnv+"="+dir)
+		stdout, err := cmd.StdoutPipe()
+		require.NoError(t, err)
+		require.NoError(t, cmd.Start())
+
+		// kill it w/o warning once killAt steps are acked, whatever it's in the middle of
+		var acked int = -1
+		scanner := bufio.NewScanner(stdout)
+		for acked < killAt && scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "ack ") {
+				acked, _ = strconv.Atoi(strings.TrimPrefix(line, "ack "))
+			}
+		}
+		require.NoError(t, cmd.Process.Kill())
+		cmd.Wait()
+		require.Equal(t, killAt, acked, "subprocess exited early")
+
+		// recovered state is the model's after some step at or past the last ack
+		recovered, _ := newPersistentNode(dir, time.Unix(0, 0))
+		step, ok := signatures[tableSignature(recovered)]
+		require.True(t, ok, "run %d: recovered table matches no step of the workload", run)
+		assert.GreaterOrEqual(t, step, acked, "run %d: recovered table lost acked steps", run)
+	}
+}
@@ -15,6 +15,10 @@ type PhiAccrualDetector struct {
 	expiringSample *windowElement
 	lastHeartbeat  time.Time
 	lastPhi        float64
+	state          ClientState
+	history        *phiHistory    // guarded by the node's lock
+	resumed        bool           // restored from a snapshot && no heartbeat since, see: Node.Restore
+	latency        *latencyWindow // response latencies, only for servers, see: Node.FailureDetectorClientInterceptor
 	mu             sync.Mutex
 }
 
@@ -27,7 +31,13 @@ type windowElement struct {
 // NewPhiAccrualDetector -
 func NewPhiAccrualDetector(hbTime time.Time, nOpts *NodeOptions, metadata *NodeMetadata) *PhiAccrualDetector {
 
-	var windowSize int = nOpts.EstimationWindowSize
+	var (
+		windowSize  int = nOpts.EstimationWindowSize
+		historySize int = nOpts.HistorySize
+	)
+	if historySize == 0 {
+		historySize = DefaultHistorySize
+	}
 
 	// init phi-acc detector - create a very simple ring to iterate through
 	window := make([]windowElement, windowSize)
@@ -47,6 +57,7 @@ func NewPhiAccrualDetector(hbTime time.Time, nOpts *NodeOptions, metadata *NodeM
 		window:         window,
 		expiringSample: &window[0],
 		metadata:       metadata,
+		history:        newPhiHistory(historySize),
 	}
 }
 
@@ -59,25 +70,69 @@ func (phiD *PhiAccrualDetector) AddValue(ctx context.Context, arrivalTime time.T
 	defer phiD.mu.Unlock()
 
 	timeDelta := float64(arrivalTime.Sub(phiD.lastHeartbeat) / time.Millisecond)
-	var expTimeDelta float64 = phiD.expiringSample.value
-
 	phiD.lastHeartbeat = arrivalTime
+	phiD.addInterval(timeDelta)
+	return nil
+}
+
+// addInterval - push an interval (ms) into the window, expiring the oldest; caller must hold
+// phiD.mu
+func (phiD *PhiAccrualDetector) addInterval(timeDelta float64) {
+
+	var expTimeDelta float64 = phiD.expiringSample.value
 
 	// update value at the current ptr
 	phiD.expiringSample.value = timeDelta
 	phiD.expiringSample = phiD.expiringSample.next
 
-	// note: there is an argument here about if this is numerically stable (i.e. we don't want to subtract two large 
+	// note: there is an argument here about if this is numerically stable (i.e. we don't want to subtract two large
 	// nums to get a small number...)
 	//
 	// upate the nTotalSamples, rSum, and rSumSquares for current collection
 	phiD.stats.rSum += (timeDelta - expTimeDelta)
 	phiD.stats.rSumSquares += (math.Pow(timeDelta, 2) - math.Pow(expTimeDelta, 2))
 	phiD.stats.nTotalSamples++
-	return nil
 }
 
 // Suspicion - calculates suspicion given the current detector state and a given time
 func (phiD *PhiAccrualDetector) Suspicion(ctime time.Time) float64 {
 	return phiD.stats.Phi(phiD.lastHeartbeat, ctime)
 }
+
+// Samples - total number of intervals observed by the detector, incl. those since expired from
+// the window
+func (phiD *PhiAccrualDetector) Samples() int {
+	return phiD.stats.nTotalSamples
+}
+
+// State - node's current view of the client
+func (phiD *PhiAccrualDetector) State() ClientState {
+	return phiD.state
+}
+
+// Intervals - intervals (ms) currently in the estimation window, oldest first
+func (phiD *PhiAccrualDetector) Intervals() []float64 {
+
+	phiD.mu.Lock()
+	defer phiD.mu.Unlock()
+
+	// until the ring wraps the window fills from the first element, after that the expiring
+	// sample is always the oldest
+	var (
+		n         int            = phiD.stats.nTotalSamples
+		element   *windowElement = phiD.expiringSample
+		intervals []float64
+	)
+	if n < len(phiD.window) {
+		element = &phiD.window[0]
+	} else {
+		n = len(phiD.window)
+	}
+
+	intervals = make([]float64, n)
+	for i := range intervals {
+		intervals[i] = element.value
+		element = element.next
+	}
+	return intervals
+}
@@ -0,0 +1,106 @@
+package failure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestDetector - detector w. its first heartbeat at the unix epoch
+func newTestDetector(windowSize int) *PhiAccrualDetector {
+	return NewPhiAccrualDetector(time.Unix(0, 0), &NodeOptions{
+		EstimationWindowSize: windowSize,
+	}, &NodeMetadata{
+		HostAddress: "127.0.0.1:50000",
+		AppID:       "test",
+	})
+}
+
+func TestAddValue(t *testing.T) {
+
+	var (
+		detector *PhiAccrualDetector = newTestDetector(3)
+		ctx                          = context.Background()
+		arrival  time.Time           = time.Unix(0, 0)
+	)
+
+	for _, interval := range []time.Duration{100, 200, 300} {
+		arrival = arrival.Add(interval * time.Millisecond)
+		assert.NoError(t, detector.AddValue(ctx, arrival))
+	}
+	assert.Equal(t, 3, detector.Samples())
+	assert.Equal(t, 600.0, detector.stats.rSum)
+	assert.Equal(t, 140000.0, detector.stats.rSumSquares)
+	assert.Equal(t, arrival, detector.lastHeartbeat)
+
+	// window is full, the next two samples expire the 100ms && 200ms intervals
+	for _, interval := range []time.Duration{400, 500} {
+		arrival = arrival.Add(interval * time.Millisecond)
+		assert.NoError(t, detector.AddValue(ctx, arrival))
+	}
+	assert.Equal(t, 5, detector.Samples())
+	assert.Equal(t, 1200.0, detector.stats.rSum)
+	assert.Equal(t, 500000.0, detector.stats.rSumSquares)
+}
+
+func TestSuspicion(t *testing.T) {
+
+	var (
+		detector *PhiAccrualDetector = newTestDetector(10)
+		ctx                          = context.Background()
+		arrival  time.Time           = time.Unix(0, 0)
+	)
+
+	for _, interval := range []time.Duration{900, 1100, 900, 1100} {
+		arrival = arrival.Add(interval * time.Millisecond)
+		detector.AddValue(ctx, arrival)
+	}
+
+	// suspicion is measured from the last heartbeat
+	assert.Equal(t, detector.stats.Phi(arrival, arrival.Add(time.Second)), detector.Suspicion(arrival.Add(time.Second)))
+	assert.Less(t, detector.Suspicion(arrival.Add(time.Second)), detector.Suspicion(arrival.Add(2*time.Second)))
+}
+
+func BenchmarkAddValue(b *testing.B) {
+	for _, windowSize := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("window=%d", windowSize), func(b *testing.B) {
+			var (
+				detector *PhiAccrualDetector = newTestDetector(windowSize)
+				ctx                          = context.Background()
+				arrival  time.Time           = time.Unix(0, 0)
+			)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				arrival = arrival.Add(time.Duration(900+i%200) * time.Millisecond)
+				detector.AddValue(ctx, arrival)
+			}
+		})
+	}
+}
+
+func BenchmarkSuspicion(b *testing.B) {
+	for _, windowSize := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("window=%d", windowSize), func(b *testing.B) {
+			var (
+				detector *PhiAccrualDetector = newTestDetector(windowSize)
+				ctx                          = context.Background()
+				arrival  time.Time           = time.Unix(0, 0)
+			)
+			for i := 0; i < windowSize; i++ {
+				arrival = arrival.Add(time.Duration(900+i%200) * time.Millisecond)
+				detector.AddValue(ctx, arrival)
+			}
+			now := arrival.Add(time.Second)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				detector.Suspicion(now)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+// Package phibalancer - grpc-go load balancing policy that keeps a subconn to every resolved
+// backend && picks among the ready ones by their current phi, as seen by a local or remote
+// failure.Node (see: Source). Register a source once && dial w. a service config naming the
+// policy:
+//
+//	phibalancer.Register(phibalancer.NodeSource(node))
+//	conn, err := grpc.Dial(target,
+//		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"phi_aware": {"threshold": 4}}]}`),
+//		...
+//	)
+//
+// The package's resolver (see: RegisterResolver) resolves a service's healthy backends from a
+// remote node instead, e.g. the look-aside balancer, w. their phi attached for the policy
+package phibalancer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	failure "github.com/dmw2151/go-failure"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// Name - name of the policy registered by Register, used in the service config
+const Name string = "phi_aware"
+
+// DefaultRefreshInterval - longest a picker goes w/o re-reading phi from its source
+const DefaultRefreshInterval time.Duration = 100 * time.Millisecond
+
+// Mode - how phi under the threshold affects a backend's share of picks
+type Mode string
+
+const (
+	// ModeSkip - every backend under the threshold is picked equally often
+	ModeSkip Mode = "skip"
+
+	// ModeWeight - a backend's share of picks falls linearly from full at phi 0 to none at the
+	// threshold
+	ModeWeight Mode = "weight"
+)
+
+// Config - policy config from the service config, e.g. {"threshold": 4, "mode": "weight"}
+type Config struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	Threshold float64 `json:"threshold,omitempty"` // optional, phi at which a backend gets no picks, defaults to failure.DefaultSuspicionThreshold
+	Mode      Mode    `json:"mode,omitempty"`      // optional, defaults to ModeSkip
+}
+
+// Register - register the policy under Name w. src as its source of phi, call once at init. A
+// nil src relies only on the phi attached to addresses by the resolver, see: RegisterResolver
+func Register(src Source) {
+	balancer.Register(NewBuilder(Name, src))
+}
+
+// NewBuilder - builder for the policy under name, for registering more than one source
+func NewBuilder(name string, src Source) balancer.Builder {
+	return &builder{name: name, source: src}
+}
+
+// builder - balancer.Builder && balancer.ConfigParser for the policy
+type builder struct {
+	name   string
+	source Source
+}
+
+func (b *builder) Name() string {
+	return b.name
+}
+
+// Build - base balancer managing a subconn per address, w. a picker reading the config the
+// balancer was last updated w.
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &pickerBuilder{source: b.source}
+	pb.config.Store(&Config{})
+	return &phiBalancer{
+		Balancer: base.NewBalancerBuilder(b.name, pb, base.Config{}).Build(cc, opts),
+		picker:   pb,
+	}
+}
+
+// ParseConfig - implements balancer.ConfigParser
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+
+	cfg := &Config{}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("phibalancer: invalid config: %w", err)
+	}
+	if cfg.Threshold < 0 {
+		return nil, fmt.Errorf("phibalancer: invalid threshold %v", cfg.Threshold)
+	}
+	switch cfg.Mode {
+	case "", ModeSkip, ModeWeight:
+	default:
+		return nil, fmt.Errorf("phibalancer: invalid mode %q", cfg.Mode)
+	}
+	return cfg, nil
+}
+
+// phiBalancer - base balancer that hands its config on to its pickers
+type phiBalancer struct {
+	balancer.Balancer
+	picker *pickerBuilder
+}
+
+func (b *phiBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	if cfg, ok := s.BalancerConfig.(*Config); ok {
+		b.picker.config.Store(cfg)
+	}
+	attrs := phiAttributes(s.ResolverState.Addresses)
+	b.picker.attrs.Store(&attrs)
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+// pickerBuilder - builds a picker over the ready subconns each time they change, attrs is the
+// phi attached to the last resolved addresses, the subconns keep the attributes they were
+// created w.
+type pickerBuilder struct {
+	source Source
+	config atomic.Pointer[Config]
+	attrs  atomic.Pointer[map[string]float64]
+}
+
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	p := &picker{builder: pb}
+	for sc, scInfo := range info.ReadySCs {
+		p.backends = append(p.backends, sc)
+		p.addrs = append(p.addrs, scInfo.Address.Addr)
+	}
+	p.weights = make([]float64, len(p.backends))
+	return p
+}
+
+// picker - weighted random pick over the ready subconns, weights are re-read from the source
+// at most every DefaultRefreshInterval
+type picker struct {
+	builder   *pickerBuilder
+	backends  []balancer.SubConn
+	addrs     []string
+	weights   []float64 // guarded by mu
+	total     float64   // guarded by mu
+	refreshed time.Time // guarded by mu
+	mu        sync.Mutex
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if time.Since(p.refreshed) >= DefaultRefreshInterval {
+		p.refresh()
+	}
+
+	r := rand.Float64() * p.total
+	for i, weight := range p.weights {
+		if r < weight {
+			return balancer.PickResult{SubConn: p.backends[i]}, nil
+		}
+		r -= weight
+	}
+	return balancer.PickResult{SubConn: p.backends[len(p.backends)-1]}, nil
+}
+
+// refresh - recompute weights from the source's && the resolver's current phi, caller must
+// hold p.mu
+func (p *picker) refresh() {
+
+	var (
+		cfg       *Config            = p.builder.config.Load()
+		phis      map[string]float64 = make(map[string]float64)
+		threshold float64            = cfg.Threshold
+	)
+	if threshold <= 0 {
+		threshold = failure.DefaultSuspicionThreshold
+	}
+
+	// the source is fresher than the resolver's last update, its phi wins
+	if attrs := p.builder.attrs.Load(); attrs != nil {
+		for addr, phi := range *attrs {
+			phis[addr] = phi
+		}
+	}
+	if p.builder.source != nil {
+		for addr, phi := range p.builder.source.Phi() {
+			phis[addr] = phi
+		}
+	}
+
+	p.total = 0
+	for i, addr := range p.addrs {
+		p.weights[i] = weight(phis, addr, threshold, cfg.Mode)
+		p.total += p.weights[i]
+	}
+
+	// every backend is suspected, spreading calls over all of them beats failing every call
+	if p.total == 0 {
+		for i := range p.weights {
+			p.weights[i] = 1
+		}
+		p.total = float64(len(p.weights))
+	}
+	p.refreshed = time.Now()
+}
+
+// weight - backend's share of picks, a backend the source doesn't know of (or w/o enough
+// samples for phi) gets a full share so new backends aren't starved
+func weight(phis map[string]float64, addr string, threshold float64, mode Mode) float64 {
+
+	phi, ok := phis[addr]
+	switch {
+	case !ok || math.IsNaN(phi):
+		return 1
+	case phi >= threshold:
+		return 0
+	case mode == ModeWeight:
+		return 1 - math.Max(phi, 0)/threshold
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,238 @@
+package phibalancer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	failure "github.com/dmw2151/go-failure"
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+// staticSource - Source w. fixed phi
+type staticSource map[string]float64
+
+func (s staticSource) Phi() map[string]float64 {
+	return s
+}
+
+// fixedClock - clock stopped at now
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+// backends - health servers on loopback ports counting the calls each serves
+type backends struct {
+	addrs []string
+	calls map[string]int // guarded by mu
+	mu    sync.Mutex
+}
+
+// newBackends - start count backends, stopped at the end of the test
+func newBackends(t *testing.T, count int) *backends {
+
+	b := &backends{calls: make(map[string]int)}
+	for i := 0; i < count; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		addr := lis.Addr().String()
+		srv := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			b.mu.Lock()
+			b.calls[addr]++
+			b.mu.Unlock()
+			return handler(ctx, req)
+		}))
+		healthpb.RegisterHealthServer(srv, health.NewServer())
+		go srv.Serve(lis)
+		t.Cleanup(srv.Stop)
+		b.addrs = append(b.addrs, addr)
+	}
+	return b
+}
+
+// call - make count calls through conn, counts are reset first
+func (b *backends) call(t *testing.T, conn *grpc.ClientConn, count int) map[string]int {
+
+	b.mu.Lock()
+	b.calls = make(map[string]int)
+	b.mu.Unlock()
+
+	client := healthpb.NewHealthClient(conn)
+	for i := 0; i < count; i++ {
+		_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.calls
+}
+
+// dial - connection to every backend through a policy registered under the test's name w. src
+// && config as its service config
+func dial(t *testing.T, b *backends, src Source, config string) *grpc.ClientConn {
+
+	name := "phi_aware_" + t.Name()
+	balancer.Register(NewBuilder(name, src))
+
+	r := manual.NewBuilderWithScheme("phitest")
+	state := resolver.State{}
+	for _, addr := range b.addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r.InitialState(state)
+
+	conn, err := grpc.Dial(r.Scheme()+":///backends",
+		grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q: %s}]}`, name, config)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	// wait for every subconn to be ready before counting
+	require.Eventually(t, func() bool {
+		return len(b.call(t, conn, 20)) == len(b.addrs)
+	}, 5*time.Second, 10*time.Millisecond)
+	return conn
+}
+
+func TestPickerSkip(t *testing.T) {
+
+	b := newBackends(t, 4)
+	src := staticSource{b.addrs[0]: 0.5, b.addrs[1]: 2}
+	conn := dial(t, b, src, `{}`)
+
+	// unknown backends count as healthy, suspected ones get nothing
+	src[b.addrs[2]] = math.NaN()
+	src[b.addrs[3]] = 9
+	time.Sleep(2 * DefaultRefreshInterval)
+
+	calls := b.call(t, conn, 400)
+	assert.Zero(t, calls[b.addrs[3]])
+	for _, addr := range b.addrs[:3] {
+		assert.Greater(t, calls[addr], 60, addr)
+	}
+}
+
+func TestPickerWeight(t *testing.T) {
+
+	b := newBackends(t, 2)
+	src := staticSource{b.addrs[0]: 0, b.addrs[1]: 0}
+	conn := dial(t, b, src, `{"threshold": 4, "mode": "weight"}`)
+
+	// 3/4 of the way to the threshold -> 1/4 of the weight
+	src[b.addrs[1]] = 3
+	time.Sleep(2 * DefaultRefreshInterval)
+
+	calls := b.call(t, conn, 1000)
+	assert.Greater(t, calls[b.addrs[1]], 100)
+	assert.Less(t, calls[b.addrs[1]], 300)
+}
+
+func TestPickerAllSuspected(t *testing.T) {
+
+	b := newBackends(t, 2)
+	src := staticSource{b.addrs[0]: 0, b.addrs[1]: 0}
+	conn := dial(t, b, src, `{"threshold": 4}`)
+
+	src[b.addrs[0]], src[b.addrs[1]] = math.Inf(1), 20
+	time.Sleep(2 * DefaultRefreshInterval)
+
+	calls := b.call(t, conn, 200)
+	assert.Greater(t, calls[b.addrs[0]], 40)
+	assert.Greater(t, calls[b.addrs[1]], 40)
+}
+
+func TestParseConfig(t *testing.T) {
+
+	bb := NewBuilder(Name, staticSource{}).(balancer.ConfigParser)
+
+	cfg, err := bb.ParseConfig([]byte(`{"threshold": 4, "mode": "weight", "unknown": 1}`))
+	require.NoError(t, err)
+	assert.Equal(t, &Config{Threshold: 4, Mode: ModeWeight}, cfg)
+
+	for _, invalid := range []string{`{"threshold": -1}`, `{"mode": "random"}`, `[]`} {
+		_, err := bb.ParseConfig([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+// newSourceNode - node at a fixed time w. a backend publishing from two connections (the old
+// one w. too few samples for phi) && a client watched by its peer address
+func newSourceNode() *failure.Node {
+
+	clock := &fixedClock{now: time.Unix(0, 0)}
+	n := failure.NewFailureDetectorNode(&failure.NodeOptions{
+		EstimationWindowSize: 10,
+		Clock:                clock,
+		Logger:               failure.NopLogger(),
+		Metrics:              &failure.MetricsOptions{Registerer: prometheus.NewRegistry()},
+	}, &failure.NodeMetadata{AppID: "look-aside-load-balancer"})
+
+	beat := func(clientID, addr string) {
+		n.ReceiveHeartbeat(context.Background(), clientID, &failproto.Beat{ClientID: "worker", Addr: addr})
+	}
+	beat("10.0.0.1:40001", "10.0.0.1:8080")
+	for _, interval := range []time.Duration{0, 900 * time.Millisecond, 1100 * time.Millisecond} {
+		clock.now = clock.now.Add(interval)
+		beat("10.0.0.1:40000", "10.0.0.1:8080")
+		beat("10.0.0.2:40000", "")
+	}
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	return n
+}
+
+func TestNodeSource(t *testing.T) {
+
+	n := newSourceNode()
+	phis := NodeSource(n).Phi()
+	require.Len(t, phis, 2)
+
+	backend, _ := n.Client("10.0.0.1:40000")
+	assert.Equal(t, backend.Phi, phis["10.0.0.1:8080"])
+	assert.False(t, math.IsNaN(phis["10.0.0.2:40000"]))
+}
+
+func TestRemoteSource(t *testing.T) {
+
+	n := newSourceNode()
+	srv := httptest.NewServer(n.AdminHandler())
+	defer srv.Close()
+
+	src, err := NewRemoteSource(&RemoteSourceOptions{URL: srv.URL, AppID: "worker", Logger: failure.NopLogger()})
+	require.NoError(t, err)
+	assert.Empty(t, src.Phi())
+
+	require.NoError(t, src.Refresh(context.Background()))
+	assert.Equal(t, NodeSource(n).Phi(), src.Phi())
+
+	// keeps the last table it got
+	srv.Close()
+	assert.Error(t, src.Refresh(context.Background()))
+	assert.Len(t, src.Phi(), 2)
+
+	_, err = NewRemoteSource(&RemoteSourceOptions{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,287 @@
+package phibalancer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	failure "github.com/dmw2151/go-failure"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// Scheme - scheme of the targets resolved by the builder from RegisterResolver, e.g.
+// phi:///worker?threshold=0.8&limit=10
+const Scheme string = "phi"
+
+// minResolverInterval - floor on ResolverOptions.Interval, the admin endpoint refuses faster
+const minResolverInterval time.Duration = 100 * time.Millisecond
+
+// ResolverOptions - which node a resolver subscribes to && how often it wants updates
+type ResolverOptions struct {
+	URL      string         // where the look-aside balancer's failure.Node.AdminHandler is mounted, e.g. http://localhost:52150/admin
+	Interval time.Duration  // optional, time between updates, defaults to DefaultRemoteInterval
+	Client   *http.Client   // optional, defaults to http.DefaultClient
+	Logger   failure.Logger // optional, defaults to the global logrus instance
+}
+
+// phiKey - key of a resolved address' phi in its balancer attributes
+type phiKey struct{}
+
+// AddressPhi - phi the resolver saw for addr when it last resolved it, see: RegisterResolver
+func AddressPhi(addr resolver.Address) (float64, bool) {
+	phi, ok := addr.BalancerAttributes.Value(phiKey{}).(float64)
+	return phi, ok
+}
+
+// RegisterResolver - register a resolver for Scheme subscribing to a node's healthy clients.
+// The target's path is the service label (i.e. client app ID) && its query params are:
+//
+//	threshold=0.8 -> only clients w. phi under threshold, defaults to failure.DefaultSuspicionThreshold
+//	limit=10      -> at most limit clients, lowest phi first
+//
+// Each address is a client's ClientStatus.Addr w. its phi attached (see: AddressPhi), which
+// the phi_aware policy uses for backends its Source doesn't know
+func RegisterResolver(opts *ResolverOptions) error {
+	b, err := NewResolverBuilder(Scheme, opts)
+	if err != nil {
+		return err
+	}
+	resolver.Register(b)
+	return nil
+}
+
+// NewResolverBuilder - resolver builder for scheme, for subscribing to more than one node
+func NewResolverBuilder(scheme string, opts *ResolverOptions) (resolver.Builder, error) {
+
+	if _, err := url.Parse(opts.URL); err != nil || opts.URL == "" {
+		return nil, fmt.Errorf("phibalancer: invalid resolver URL %q", opts.URL)
+	}
+
+	var logger failure.Logger = opts.Logger
+	if logger == nil {
+		logger = failure.LogrusLogger(nil)
+	}
+	return &resolverBuilder{scheme: scheme, opts: opts, logger: logger}, nil
+}
+
+// resolverBuilder - resolver.Builder for the scheme
+type resolverBuilder struct {
+	scheme string
+	opts   *ResolverOptions
+	logger failure.Logger
+}
+
+func (b *resolverBuilder) Scheme() string {
+	return b.scheme
+}
+
+// Build - parse the target && start subscribing, the first update comes w. the first event
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+
+	r := &phiResolver{
+		opts:      b.opts,
+		logger:    b.logger,
+		cc:        cc,
+		service:   strings.TrimPrefix(target.URL.Path, "/"),
+		threshold: failure.DefaultSuspicionThreshold,
+		done:      make(chan struct{}),
+	}
+	if r.service == "" {
+		return nil, fmt.Errorf("phibalancer: target %q has no service label", target.URL.String())
+	}
+
+	q := target.URL.Query()
+	if param := q.Get("threshold"); param != "" {
+		threshold, err := strconv.ParseFloat(param, 64)
+		if err != nil || threshold <= 0 {
+			return nil, fmt.Errorf("phibalancer: invalid threshold %q", param)
+		}
+		r.threshold = threshold
+	}
+	if param := q.Get("limit"); param != "" {
+		limit, err := strconv.Atoi(param)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("phibalancer: invalid limit %q", param)
+		}
+		r.limit = limit
+	}
+
+	var ctx context.Context
+	ctx, r.cancel = context.WithCancel(context.Background())
+	go r.run(ctx)
+	return r, nil
+}
+
+// phiResolver - resolver pushing a service's healthy clients from a node's /events stream
+type phiResolver struct {
+	opts      *ResolverOptions
+	logger    failure.Logger
+	cc        resolver.ClientConn
+	service   string
+	threshold float64
+	limit     int
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ResolveNow - implements resolver.Resolver, a no-op as updates are pushed by the node
+func (r *phiResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+// Close - implements resolver.Resolver, stop subscribing
+func (r *phiResolver) Close() {
+	r.closeOnce.Do(func() {
+		r.cancel()
+		<-r.done
+	})
+}
+
+// run - subscribe until ctx is done, re-subscribing every Interval after the stream fails. The
+// ClientConn keeps the last addresses it got while the stream is down
+func (r *phiResolver) run(ctx context.Context) {
+
+	defer close(r.done)
+
+	interval := r.opts.Interval
+	if interval < minResolverInterval {
+		interval = DefaultRemoteInterval
+	}
+
+	for {
+		err := r.subscribe(ctx, interval)
+		if ctx.Err() != nil {
+			return
+		}
+		r.logger.Warn("subscription to healthy clients failed, resubscribing",
+			"url", r.opts.URL,
+			"client_app_id", r.service,
+			"err", err,
+		)
+		r.cc.ReportError(err)
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// subscribe - read client tables off the node's /events stream, pushing each to the ClientConn
+func (r *phiResolver) subscribe(ctx context.Context, interval time.Duration) error {
+
+	endpoint := fmt.Sprintf("%s/events?client_app_id=%s&interval=%s",
+		strings.TrimSuffix(r.opts.URL, "/"), url.QueryEscape(r.service), interval,
+	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	client := r.opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	events := bufio.NewReader(resp.Body)
+	for {
+		line, err := events.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return errors.New("event stream ended by the node")
+		} else if err != nil {
+			return err
+		}
+
+		data, ok := strings.CutPrefix(strings.TrimSuffix(line, "\n"), "data: ")
+		if !ok {
+			continue
+		}
+		var table struct {
+			Clients []remoteClient `json:"clients"`
+		}
+		if err := json.Unmarshal([]byte(data), &table); err != nil {
+			return err
+		}
+		r.update(table.Clients)
+	}
+}
+
+// update - push the healthy clients in a table to the ClientConn, an empty list is reported as
+// an error so the ClientConn keeps the addresses it has
+func (r *phiResolver) update(clients []remoteClient) {
+
+	healthy := make([]remoteClient, 0, len(clients))
+	for _, client := range clients {
+		// NaN phi never counts as healthy, i.e. clients wait for enough samples to be picked
+		if client.State != failure.StateSuspected.String() && float64(client.Phi) < r.threshold {
+			healthy = append(healthy, client)
+		}
+	}
+	sort.SliceStable(healthy, func(i, j int) bool { return healthy[i].Phi < healthy[j].Phi })
+
+	var (
+		state resolver.State
+		seen  = make(map[string]bool, len(healthy))
+	)
+	for _, client := range healthy {
+		addr := client.Addr
+		if addr == "" {
+			addr = client.ClientID
+		}
+		// sorted by phi, so the first of a backend's clients has its lowest phi
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		state.Addresses = append(state.Addresses, resolver.Address{
+			Addr:               addr,
+			BalancerAttributes: attributes.New(phiKey{}, float64(client.Phi)),
+		})
+		if r.limit > 0 && len(state.Addresses) == r.limit {
+			break
+		}
+	}
+
+	if len(state.Addresses) == 0 {
+		r.cc.ReportError(fmt.Errorf("no %s clients w. phi under %v", r.service, r.threshold))
+		return
+	}
+	if err := r.cc.UpdateState(state); err != nil {
+		r.logger.Debug("client conn rejected resolver update",
+			"client_app_id", r.service,
+			"err", err,
+		)
+	}
+}
+
+// phiAttributes - phi of each address the resolver attached one to
+func phiAttributes(addrs []resolver.Address) map[string]float64 {
+	phis := make(map[string]float64, len(addrs))
+	for _, addr := range addrs {
+		if phi, ok := AddressPhi(addr); ok && !math.IsNaN(phi) {
+			phis[addr.Addr] = phi
+		}
+	}
+	return phis
+}
@@ -0,0 +1,169 @@
+package phibalancer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	failure "github.com/dmw2151/go-failure"
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+)
+
+// recordingClientConn - resolver.ClientConn keeping the last state && error it got
+type recordingClientConn struct {
+	resolver.ClientConn
+	state resolver.State
+	err   error
+	mu    sync.Mutex
+}
+
+func (cc *recordingClientConn) UpdateState(state resolver.State) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.state, cc.err = state, nil
+	return nil
+}
+
+func (cc *recordingClientConn) ReportError(err error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.err = err
+}
+
+// newWorkerNode - node at a fixed time w. a healthy "worker" client serving on each of healthy
+// && a client w. a single beat serving on each of unknown
+func newWorkerNode(healthy []string, unknown []string) *failure.Node {
+
+	clock := &fixedClock{now: time.Unix(0, 0)}
+	n := failure.NewFailureDetectorNode(&failure.NodeOptions{
+		EstimationWindowSize: 10,
+		Clock:                clock,
+		Logger:               failure.NopLogger(),
+		Metrics:              &failure.MetricsOptions{Registerer: prometheus.NewRegistry()},
+	}, &failure.NodeMetadata{AppID: "look-aside-load-balancer"})
+
+	for _, interval := range []time.Duration{0, 900 * time.Millisecond, 1100 * time.Millisecond} {
+		clock.now = clock.now.Add(interval)
+		for _, addr := range healthy {
+			n.ReceiveHeartbeat(context.Background(), "peer-"+addr, &failproto.Beat{ClientID: "worker", Addr: addr})
+		}
+	}
+	for _, addr := range unknown {
+		n.ReceiveHeartbeat(context.Background(), "peer-"+addr, &failproto.Beat{ClientID: "worker", Addr: addr})
+	}
+	clock.now = clock.now.Add(500 * time.Millisecond)
+	return n
+}
+
+func TestResolverUpdate(t *testing.T) {
+
+	var (
+		cc = &recordingClientConn{}
+		r  = &phiResolver{cc: cc, service: "worker", threshold: 4, logger: failure.NopLogger()}
+	)
+	r.update([]remoteClient{
+		{ClientID: "10.0.0.1:40000", Addr: "10.0.0.1:8080", State: "healthy", Phi: 2},
+		{ClientID: "10.0.0.1:40001", Addr: "10.0.0.1:8080", State: "healthy", Phi: 0.5},
+		{ClientID: "10.0.0.2:40000", State: "healthy", Phi: 1},
+		{ClientID: "10.0.0.3:40000", Addr: "10.0.0.3:8080", State: "unknown", Phi: remoteFloat(math.NaN())},
+		{ClientID: "10.0.0.4:40000", Addr: "10.0.0.4:8080", State: "healthy", Phi: 5},
+		{ClientID: "10.0.0.5:40000", Addr: "10.0.0.5:8080", State: "suspected", Phi: 0.1},
+	})
+
+	// lowest phi first, each backend once, w/o the unknown, over-threshold && suspected clients
+	require.Len(t, cc.state.Addresses, 2)
+	for i, want := range []struct {
+		addr string
+		phi  float64
+	}{{"10.0.0.1:8080", 0.5}, {"10.0.0.2:40000", 1}} {
+		assert.Equal(t, want.addr, cc.state.Addresses[i].Addr)
+		phi, ok := AddressPhi(cc.state.Addresses[i])
+		require.True(t, ok)
+		assert.Equal(t, want.phi, phi)
+	}
+
+	r.limit = 1
+	r.update([]remoteClient{
+		{ClientID: "10.0.0.1:40000", State: "healthy", Phi: 3},
+		{ClientID: "10.0.0.2:40000", State: "healthy", Phi: 1},
+	})
+	require.Len(t, cc.state.Addresses, 1)
+	assert.Equal(t, "10.0.0.2:40000", cc.state.Addresses[0].Addr)
+
+	// nothing healthy -> an error, the ClientConn keeps what it has
+	r.update([]remoteClient{{ClientID: "10.0.0.1:40000", State: "healthy", Phi: 6}})
+	assert.Error(t, cc.err)
+	assert.Len(t, cc.state.Addresses, 1)
+
+	_, ok := AddressPhi(resolver.Address{Addr: "10.0.0.1:8080"})
+	assert.False(t, ok)
+}
+
+func TestResolverBuildInvalid(t *testing.T) {
+
+	b, err := NewResolverBuilder("phitest", &ResolverOptions{URL: "http://127.0.0.1:52150/admin"})
+	require.NoError(t, err)
+
+	for _, target := range []string{"phitest:///", "phitest:///worker?threshold=x", "phitest:///worker?threshold=-1", "phitest:///worker?limit=-1"} {
+		u, err := url.Parse(target)
+		require.NoError(t, err)
+		_, err = b.Build(resolver.Target{URL: *u}, &recordingClientConn{}, resolver.BuildOptions{})
+		assert.Error(t, err, target)
+	}
+
+	_, err = NewResolverBuilder("phitest", &ResolverOptions{})
+	assert.Error(t, err)
+}
+
+func TestResolver(t *testing.T) {
+
+	// the node knows 2 healthy backends && one it's only heard from once
+	b := newBackends(t, 3)
+	n := newWorkerNode(b.addrs[:2], b.addrs[2:])
+	srv := httptest.NewServer(n.AdminHandler())
+	defer srv.Close()
+
+	scheme := "phiresolver"
+	rb, err := NewResolverBuilder(scheme, &ResolverOptions{
+		URL:      srv.URL,
+		Interval: minResolverInterval,
+		Logger:   failure.NopLogger(),
+	})
+	require.NoError(t, err)
+
+	// phi only from the resolver's attributes
+	name := "phi_aware_" + t.Name()
+	balancer.Register(NewBuilder(name, nil))
+	conn, err := grpc.Dial(scheme+":///worker?threshold=4",
+		grpc.WithResolvers(rb),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig": [{%q: {}}]}`, name)),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Eventually(t, func() bool {
+		return len(b.call(t, conn, 20)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, b.call(t, conn, 100)[b.addrs[2]])
+
+	// a backend leaving drops out w. the next event
+	n.ReceiveHeartbeat(context.Background(), "peer-"+b.addrs[1], &failproto.Beat{ClientID: "worker", Leave: true})
+	require.Eventually(t, func() bool {
+		calls := b.call(t, conn, 20)
+		return len(calls) == 1 && calls[b.addrs[0]] == 20
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,191 @@
+package phibalancer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	failure "github.com/dmw2151/go-failure"
+)
+
+// DefaultRemoteInterval - time between fetches of a remote node's client table when
+// RemoteSourceOptions.Interval is unset
+const DefaultRemoteInterval time.Duration = time.Second
+
+// Source - current phi of backends, keyed by the address they serve on. Backends a source
+// doesn't know fall back on the phi attached by the resolver (see: AddressPhi), if any
+type Source interface {
+	Phi() map[string]float64
+}
+
+// nodeSource - Source reading a node in the same process
+type nodeSource struct {
+	node *failure.Node
+}
+
+// NodeSource - Source reading n's clients by ClientStatus.Addr, i.e. a node the backends publish
+// to w. PublisherOptions.Addr set, or one watching them w. its FailureDetectorClientInterceptor
+func NodeSource(n *failure.Node) Source {
+	return nodeSource{node: n}
+}
+
+// Phi - implements Source, a backend w. more than one client on the node (e.g. a reconnected
+// publisher whose old connection hasn't been reaped) gets the lowest phi among them
+func (s nodeSource) Phi() map[string]float64 {
+	phis := make(map[string]float64)
+	for _, client := range s.node.Clients() {
+		addPhi(phis, client.Addr, client.Phi)
+	}
+	return phis
+}
+
+// addPhi - keep the lowest phi seen for addr, NaN (too few samples) only if there's nothing else
+func addPhi(phis map[string]float64, addr string, phi float64) {
+	if current, ok := phis[addr]; ok && !(phi < current) && !math.IsNaN(current) {
+		return
+	}
+	phis[addr] = phi
+}
+
+// RemoteSourceOptions - which node a RemoteSource reads && how often
+type RemoteSourceOptions struct {
+	URL      string         // where the node's failure.Node.AdminHandler is mounted, e.g. http://localhost:52150/admin
+	AppID    string         // optional, only clients w. this app ID
+	Interval time.Duration  // optional, defaults to DefaultRemoteInterval
+	Client   *http.Client   // optional, defaults to http.DefaultClient
+	Logger   failure.Logger // optional, defaults to the global logrus instance
+}
+
+// RemoteSource - Source reading a node in another process (e.g. the look-aside balancer)
+// through its admin endpoint, the table is fetched every Interval by Run. Until the first fetch
+// succeeds it knows no backends, && after a failed fetch it keeps the last table it got
+type RemoteSource struct {
+	opts   *RemoteSourceOptions
+	logger failure.Logger
+	phis   map[string]float64 // guarded by mu
+	mu     sync.RWMutex
+}
+
+// NewRemoteSource - new remote source, empty until Run is called
+func NewRemoteSource(opts *RemoteSourceOptions) (*RemoteSource, error) {
+
+	if _, err := url.Parse(opts.URL); err != nil || opts.URL == "" {
+		return nil, fmt.Errorf("phibalancer: invalid remote source URL %q", opts.URL)
+	}
+
+	var logger failure.Logger = opts.Logger
+	if logger == nil {
+		logger = failure.LogrusLogger(nil)
+	}
+	return &RemoteSource{opts: opts, logger: logger, phis: make(map[string]float64)}, nil
+}
+
+// Phi - implements Source
+func (s *RemoteSource) Phi() map[string]float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.phis
+}
+
+// Run - fetch the remote table every Interval until ctx is done, returns ctx.Err()
+func (s *RemoteSource) Run(ctx context.Context) error {
+
+	interval := s.opts.Interval
+	if interval <= 0 {
+		interval = DefaultRemoteInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Refresh(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Warn("failed to fetch remote client table, keeping the last one",
+				"url", s.opts.URL,
+				"err", err,
+			)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// remoteClient - the fields of the admin endpoint's client JSON a RemoteSource needs
+type remoteClient struct {
+	ClientID string      `json:"client_addr"`
+	Addr     string      `json:"client_serving_addr"`
+	State    string      `json:"state"`
+	Phi      remoteFloat `json:"phi"`
+}
+
+// remoteFloat - float64 decoded from a number or the admin endpoint's "NaN", "+Inf" && "-Inf"
+type remoteFloat float64
+
+func (f *remoteFloat) UnmarshalJSON(b []byte) error {
+	switch string(b) {
+	case `"NaN"`:
+		*f = remoteFloat(math.NaN())
+	case `"+Inf"`:
+		*f = remoteFloat(math.Inf(1))
+	case `"-Inf"`:
+		*f = remoteFloat(math.Inf(-1))
+	default:
+		return json.Unmarshal(b, (*float64)(f))
+	}
+	return nil
+}
+
+// Refresh - fetch the remote table once, Run calls it every Interval
+func (s *RemoteSource) Refresh(ctx context.Context) error {
+
+	endpoint := strings.TrimSuffix(s.opts.URL, "/") + "/clients"
+	if s.opts.AppID != "" {
+		endpoint += "?client_app_id=" + url.QueryEscape(s.opts.AppID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	client := s.opts.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var table struct {
+		Clients []remoteClient `json:"clients"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&table); err != nil {
+		return err
+	}
+
+	phis := make(map[string]float64, len(table.Clients))
+	for _, client := range table.Clients {
+		addr := client.Addr
+		if addr == "" {
+			addr = client.ClientID
+		}
+		addPhi(phis, addr, float64(client.Phi))
+	}
+
+	s.mu.Lock()
+	s.phis = phis
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,298 @@
+package failure
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"runtime"
+	"sync"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+)
+
+// DefaultProcessingQueueSize - heartbeats each pool worker holds when ProcessingOptions.QueueSize
+// is unset
+const DefaultProcessingQueueSize int = 256
+
+// ProcessingMode - how FailureDetectorInterceptor hands heartbeats to the node
+type ProcessingMode int
+
+const (
+	// ProcessSync - process the heartbeat in the RPC's goroutine before calling the handler
+	ProcessSync ProcessingMode = iota
+
+	// ProcessPool - queue the heartbeat to a fixed pool of workers && call the handler at once,
+	// a client's heartbeats always go to the same worker so they're processed in order
+	ProcessPool
+)
+
+// DropPolicy - what the pool does w. a heartbeat when its worker's queue is full. A dropped
+// heartbeat is just a missed one to the detector, phi already allows for those
+type DropPolicy int
+
+const (
+	// DropNewest - drop the incoming heartbeat
+	DropNewest DropPolicy = iota
+
+	// DropOldest - drop the oldest queued heartbeat to make room, the detector sees the most
+	// recent arrivals
+	DropOldest
+
+	// Block - wait for room, holding up the RPC until its context is done
+	Block
+)
+
+// ProcessingOptions - how heartbeats from the interceptor are processed
+type ProcessingOptions struct {
+	Mode       ProcessingMode // optional, defaults to ProcessSync
+	Workers    int            // optional, defaults to GOMAXPROCS
+	QueueSize  int            // optional, defaults to DefaultProcessingQueueSize per worker
+	DropPolicy DropPolicy     // optional, defaults to DropNewest
+}
+
+// heartbeatTask - a heartbeat waiting for a pool worker, timed on arrival at the interceptor so
+// time spent queued doesn't stretch the client's intervals. W/o a beat, the client's heartbeat
+// stream broke at arrivalTime w. err
+type heartbeatTask struct {
+	ctx         context.Context
+	clientID    string
+	beat        *failproto.Beat
+	arrivalTime time.Time
+	err         error
+}
+
+// errPoolClosed - pool stopped taking heartbeats while a submitter waited for room
+var errPoolClosed = errors.New("processing pool closed")
+
+// heartbeatPool - workers processing heartbeats for the node, each w. its own bounded queue
+type heartbeatPool struct {
+	node   *Node
+	policy DropPolicy
+	queues []chan heartbeatTask
+	freed  []chan struct{} // per queue, signalled when its worker takes a heartbeat off it
+	done   chan struct{}   // closed w. the pool
+	wg     sync.WaitGroup
+	mu     sync.RWMutex // guards closed, held for reading while sending so queues aren't closed mid-send
+	closed bool
+}
+
+// newHeartbeatPool - start the node's workers
+func newHeartbeatPool(n *Node, opts *ProcessingOptions) *heartbeatPool {
+
+	var (
+		workers   int = opts.Workers
+		queueSize int = opts.QueueSize
+	)
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultProcessingQueueSize
+	}
+
+	p := &heartbeatPool{
+		node:   n,
+		policy: opts.DropPolicy,
+		queues: make([]chan heartbeatTask, workers),
+		freed:  make([]chan struct{}, workers),
+		done:   make(chan struct{}),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan heartbeatTask, queueSize)
+		p.freed[i] = make(chan struct{}, 1)
+		p.wg.Add(1)
+		go p.work(i)
+	}
+	return p
+}
+
+// work - process a single worker's queue until it's closed
+func (p *heartbeatPool) work(i int) {
+	defer p.wg.Done()
+	for task := range p.queues[i] {
+		select {
+		case p.freed[i] <- struct{}{}:
+		default:
+		}
+		p.process(task)
+	}
+}
+
+// process - apply a single task to the node
+func (p *heartbeatPool) process(task heartbeatTask) {
+	if task.beat == nil {
+		p.node.streamBroken(task.clientID, task.err, task.arrivalTime)
+		return
+	}
+	p.node.receiveHeartbeat(task.ctx, task.clientID, task.beat, task.arrivalTime)
+}
+
+// shard - index of the worker responsible for a client
+func (p *heartbeatPool) shard(clientID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(clientID))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+// queue - queue of the worker responsible for a client
+func (p *heartbeatPool) queue(clientID string) chan heartbeatTask {
+	return p.queues[p.shard(clientID)]
+}
+
+// enqueue - queue a heartbeat, waiting for room until ctx is done. p.mu is only held while
+// trying to send, never while waiting, so a full queue doesn't hold up close. Returns
+// errPoolClosed if the pool closed first
+func (p *heartbeatPool) enqueue(ctx context.Context, task heartbeatTask) error {
+
+	i := p.shard(task.clientID)
+	for {
+		p.mu.RLock()
+		if p.closed {
+			p.mu.RUnlock()
+			return errPoolClosed
+		}
+		select {
+		case p.queues[i] <- task:
+			p.mu.RUnlock()
+			return nil
+		default:
+		}
+		p.mu.RUnlock()
+
+		select {
+		case <-p.freed[i]:
+		case <-p.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// submit - queue a heartbeat according to the drop policy, ctx is the RPC's context && only
+// bounds how long Block waits. Once the pool is closed heartbeats are processed synchronously
+func (p *heartbeatPool) submit(ctx context.Context, task heartbeatTask) {
+
+	if p.policy == Block {
+		switch err := p.enqueue(ctx, task); {
+		case errors.Is(err, errPoolClosed):
+			p.process(task)
+		case err != nil:
+			p.drop(task)
+		}
+		return
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		p.process(task)
+		return
+	}
+
+	queue := p.queue(task.clientID)
+	switch p.policy {
+	case DropOldest:
+		p.submitDropOldest(queue, task)
+	default:
+		select {
+		case queue <- task:
+		default:
+			p.drop(task)
+		}
+	}
+}
+
+// submitDropOldest - queue a heartbeat, dropping the oldest queued ones to make room. Broken
+// streams are never dropped, nor processed here while the worker may be processing the same
+// client: they're requeued ahead of the heartbeat, behind all of their client's beats incl.
+// any that arrived after the break (see: Node.suspect, which ignores such a stale break).
+// Once a queue of nothing but breaks has gone round w/o room, the heartbeat is dropped instead
+func (p *heartbeatPool) submitDropOldest(queue chan heartbeatTask, task heartbeatTask) {
+
+	var (
+		breaks  []heartbeatTask
+		rotated int
+	)
+	for {
+		next := task
+		if len(breaks) > 0 {
+			next = breaks[0]
+		}
+		select {
+		case queue <- next:
+			if len(breaks) == 0 {
+				return
+			}
+			breaks = breaks[1:]
+			continue
+		default:
+		}
+
+		if rotated > cap(queue) {
+			for _, b := range breaks {
+				queue <- b
+			}
+			p.drop(task)
+			return
+		}
+
+		select {
+		case oldest := <-queue:
+			if oldest.beat == nil {
+				breaks = append(breaks, oldest)
+				rotated++
+				continue
+			}
+			p.drop(oldest)
+		default:
+		}
+	}
+}
+
+// submitBreak - queue a broken stream behind the client's heartbeats, never dropped. Once the
+// pool is closed it's processed after the workers drain, i.e. still behind those heartbeats
+func (p *heartbeatPool) submitBreak(task heartbeatTask) {
+	if err := p.enqueue(context.Background(), task); err != nil {
+		p.wg.Wait()
+		p.process(task)
+	}
+}
+
+// drop - count && log a heartbeat that was never processed
+func (p *heartbeatPool) drop(task heartbeatTask) {
+	p.node.metrics.observeDrop()
+	p.node.logger.Debug("dropped heartbeat, processing queue full",
+		p.node.clientLogArgs(task.clientID, task.beat.ClientID)...,
+	)
+}
+
+// depths - number of heartbeats queued for each worker
+func (p *heartbeatPool) depths() []int {
+	depths := make([]int, len(p.queues))
+	for i, queue := range p.queues {
+		depths[i] = len(queue)
+	}
+	return depths
+}
+
+// close - stop accepting heartbeats && wait for the workers to drain their queues
+func (p *heartbeatPool) close() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,290 @@
+package failure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// blockingObserver - holds up the worker processing the node's first heartbeat until released
+type blockingObserver struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newBlockingObserver() *blockingObserver {
+	return &blockingObserver{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (o *blockingObserver) ObserveHeartbeat(ev HeartbeatEvent) {
+	o.once.Do(func() {
+		close(o.started)
+		<-o.release
+	})
+}
+
+func (o *blockingObserver) ObserveTransition(ev TransitionEvent) {}
+
+// intercept - send a heartbeat from clientID through the node's interceptor after advancing the
+// clock by interval
+func intercept(t *testing.T, n *Node, clock *testClock, clientID string, interval time.Duration) {
+	intercepted(t, context.Background(), n, clock, clientID, interval)
+}
+
+// intercepted - intercept w. the RPC's context
+func intercepted(t *testing.T, ctx context.Context, n *Node, clock *testClock, clientID string, interval time.Duration) {
+	addr, err := net.ResolveTCPAddr("tcp", clientID)
+	require.NoError(t, err)
+
+	clock.Advance(interval)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	_, err = n.FailureDetectorInterceptor()(ctx, &failproto.Beat{ClientID: "worker"}, &grpc.UnaryServerInfo{},
+		func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil },
+	)
+	require.NoError(t, err)
+}
+
+func TestProcessSync(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{})
+	intercept(t, n, clock, "10.0.0.1:40000", 0)
+	intercept(t, n, clock, "10.0.0.1:40000", time.Second)
+
+	// processed before the interceptor returns
+	window, ok := n.ClientIntervals("10.0.0.1:40000")
+	require.True(t, ok)
+	assert.Equal(t, []float64{1000}, window)
+}
+
+func TestProcessPoolOrdering(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{
+		Processing: &ProcessingOptions{Mode: ProcessPool, Workers: 3, QueueSize: 1024},
+	})
+
+	// intervals are taken on arrival at the interceptor, not when a worker gets to them
+	for i := 0; i < 200; i++ {
+		intercept(t, n, clock, fmt.Sprintf("10.0.0.%d:40000", i%5), time.Duration(100+i)*time.Millisecond)
+	}
+	require.NoError(t, n.Close())
+
+	for c := 0; c < 5; c++ {
+		window, ok := n.ClientIntervals(fmt.Sprintf("10.0.0.%d:40000", c))
+		require.True(t, ok)
+		require.Len(t, window, 39)
+		for i, interval := range window {
+			// the beats in between from the other four clients, each a ms longer than the last
+			beat := c + 5*(i+1)
+			assert.Equal(t, float64(5*100+beat*5-10), interval)
+		}
+	}
+}
+
+// saturatedPool - single worker pool w. a queue of one, held up on a heartbeat from another
+// client so the next heartbeat fills the queue
+func saturatedPool(t *testing.T, policy DropPolicy) (*Node, *testClock, *blockingObserver, *prometheus.Registry) {
+
+	reg := prometheus.NewRegistry()
+	n, clock := newTestNode(&NodeOptions{
+		Metrics:    &MetricsOptions{Registerer: reg},
+		Processing: &ProcessingOptions{Mode: ProcessPool, Workers: 1, QueueSize: 1, DropPolicy: policy},
+	})
+	o := newBlockingObserver()
+	n.AddObserver(o)
+
+	intercept(t, n, clock, "10.0.0.9:40000", 0)
+	<-o.started
+	intercept(t, n, clock, "10.0.0.1:40000", 0)
+	assert.Equal(t, []int{1}, n.pool.depths())
+	return n, clock, o, reg
+}
+
+func TestProcessPoolDropNewest(t *testing.T) {
+
+	n, clock, o, _ := saturatedPool(t, DropNewest)
+	intercept(t, n, clock, "10.0.0.1:40000", time.Second)
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.heartbeatsDropped))
+
+	close(o.release)
+	require.NoError(t, n.Close())
+
+	status, ok := n.Client("10.0.0.1:40000")
+	require.True(t, ok)
+	assert.Equal(t, time.Unix(0, 0), status.LastHeartbeat)
+}
+
+func TestProcessPoolDropOldest(t *testing.T) {
+
+	n, clock, o, _ := saturatedPool(t, DropOldest)
+	intercept(t, n, clock, "10.0.0.2:40000", time.Second)
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.heartbeatsDropped))
+
+	close(o.release)
+	require.NoError(t, n.Close())
+
+	_, ok := n.Client("10.0.0.1:40000")
+	assert.False(t, ok)
+	status, ok := n.Client("10.0.0.2:40000")
+	require.True(t, ok)
+	assert.Equal(t, time.Unix(1, 0), status.LastHeartbeat)
+}
+
+func TestProcessPoolDropOldestBreak(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{
+		Logger:     NopLogger(),
+		Processing: &ProcessingOptions{Mode: ProcessPool, Workers: 1, QueueSize: 1, DropPolicy: DropOldest},
+	})
+	o := newBlockingObserver()
+	n.AddObserver(o)
+
+	// the worker is still on the client's heartbeat when its stream breaks
+	intercept(t, n, clock, "10.0.0.9:40000", 0)
+	<-o.started
+	n.dispatchBreak("10.0.0.9:40000", errors.New("stream broke"))
+
+	// the break isn't dropped, nor run ahead of the heartbeat on the submitter's goroutine
+	done := make(chan struct{})
+	go func() {
+		intercept(t, n, clock, "10.0.0.2:40000", time.Second)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("submit blocked on the worker's heartbeat")
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.heartbeatsDropped))
+	assert.Equal(t, []int{1}, n.pool.depths())
+
+	close(o.release)
+	require.NoError(t, n.Close())
+
+	status, ok := n.Client("10.0.0.9:40000")
+	require.True(t, ok)
+	assert.Equal(t, StateSuspected, status.State)
+}
+
+func TestProcessPoolDropOldestStaleBreak(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{
+		Logger:     NopLogger(),
+		Processing: &ProcessingOptions{Mode: ProcessPool, Workers: 1, QueueSize: 3, DropPolicy: DropOldest},
+	})
+	for i := 0; i < 3; i++ {
+		beat(n, clock, "10.0.0.1:40000", time.Second)
+	}
+	o := newBlockingObserver()
+	n.AddObserver(o)
+	intercept(t, n, clock, "10.0.0.9:40000", 0)
+	<-o.started
+
+	// the client's stream breaks && it reconnects, then a full queue requeues the break behind
+	// the reconnected stream's heartbeat
+	n.dispatchBreak("10.0.0.1:40000", errors.New("stream broke"))
+	intercept(t, n, clock, "10.0.0.2:40000", time.Second)
+	intercept(t, n, clock, "10.0.0.1:40000", time.Second)
+	intercept(t, n, clock, "10.0.0.3:40000", time.Second)
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.heartbeatsDropped))
+
+	// the break is processed last, but the client has been heard from since
+	close(o.release)
+	require.NoError(t, n.Close())
+	status, ok := n.Client("10.0.0.1:40000")
+	require.True(t, ok)
+	assert.Equal(t, StateHealthy, status.State)
+	assert.Equal(t, clock.Now().Add(-time.Second), status.LastHeartbeat)
+}
+
+func TestProcessPoolBreakFullQueue(t *testing.T) {
+
+	n, _, o, _ := saturatedPool(t, DropNewest)
+
+	// a break waits for room w/o holding the pool's lock...
+	done := make(chan struct{})
+	go func() {
+		n.dispatchBreak("10.0.0.1:40000", errors.New("stream broke"))
+		close(done)
+	}()
+	require.Eventually(t, func() bool {
+		if !n.pool.mu.TryLock() {
+			return false
+		}
+		n.pool.mu.Unlock()
+		return true
+	}, time.Second, time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("break wasn't held up by the full queue")
+	default:
+	}
+
+	// ...&& is queued once the worker makes room
+	close(o.release)
+	<-done
+	require.NoError(t, n.Close())
+	status, ok := n.Client("10.0.0.1:40000")
+	require.True(t, ok)
+	assert.Equal(t, StateSuspected, status.State)
+}
+
+func TestProcessPoolBlock(t *testing.T) {
+
+	n, clock, o, _ := saturatedPool(t, Block)
+
+	// waits out the RPC's context, then drops
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	intercepted(t, ctx, n, clock, "10.0.0.2:40000", time.Second)
+	assert.Equal(t, 1.0, testutil.ToFloat64(n.metrics.heartbeatsDropped))
+
+	// ...or until there's room
+	done := make(chan struct{})
+	go func() {
+		intercepted(t, context.Background(), n, clock, "10.0.0.3:40000", 0)
+		close(done)
+	}()
+	close(o.release)
+	<-done
+	require.NoError(t, n.Close())
+
+	_, ok := n.Client("10.0.0.3:40000")
+	assert.True(t, ok)
+}
+
+func TestProcessPoolMetrics(t *testing.T) {
+
+	n, _, o, reg := saturatedPool(t, DropNewest)
+	close(o.release)
+	require.NoError(t, n.Close())
+
+	count, err := testutil.GatherAndCount(reg, "failure_detector_heartbeat_queue_depth")
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 0.0, gatherValue(t, reg, "failure_detector_heartbeat_queue_depth"))
+}
+
+func TestProcessPoolClosed(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{Processing: &ProcessingOptions{Mode: ProcessPool}})
+	require.NoError(t, n.Close())
+
+	// synchronous once closed
+	intercept(t, n, clock, "10.0.0.1:40000", 0)
+	_, ok := n.Client("10.0.0.1:40000")
+	assert.True(t, ok)
+}
@@ -31,7 +31,13 @@ type Beat struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	ClientID string `protobuf:"bytes,1,opt,name=clientID,proto3" json:"clientID,omitempty"`
+	ClientID     string `protobuf:"bytes,1,opt,name=clientID,proto3" json:"clientID,omitempty"`
+	Seq          uint64 `protobuf:"varint,2,opt,name=seq,proto3" json:"seq,omitempty"`                   // optional, monotonically increasing per publisher
+	Leave        bool   `protobuf:"varint,3,opt,name=leave,proto3" json:"leave,omitempty"`               // publisher is shutting down, the node removes it rather than waiting on phi
+	Addr         string `protobuf:"bytes,4,opt,name=addr,proto3" json:"addr,omitempty"`                  // optional, address the publisher serves on, see: ClientStatus.Addr
+	SentUnixNano int64  `protobuf:"varint,5,opt,name=sentUnixNano,proto3" json:"sentUnixNano,omitempty"` // optional, when the publisher sent the beat, required for signed beats
+	KeyID        string `protobuf:"bytes,6,opt,name=keyID,proto3" json:"keyID,omitempty"`                // optional, key the beat was signed w., see: AuthOptions.Keys
+	Signature    []byte `protobuf:"bytes,7,opt,name=signature,proto3" json:"signature,omitempty"`        // optional, HMAC-SHA256 over the beat's other fields, see: SignBeat
 }
 
 func (x *Beat) Reset() {
@@ -73,17 +79,121 @@ func (x *Beat) GetClientID() string {
 	return ""
 }
 
+func (x *Beat) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *Beat) GetLeave() bool {
+	if x != nil {
+		return x.Leave
+	}
+	return false
+}
+
+func (x *Beat) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *Beat) GetSentUnixNano() int64 {
+	if x != nil {
+		return x.SentUnixNano
+	}
+	return 0
+}
+
+func (x *Beat) GetKeyID() string {
+	if x != nil {
+		return x.KeyID
+	}
+	return ""
+}
+
+func (x *Beat) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+// BeatAck - acknowledgement of a Beat received on a stream
+type BeatAck struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Seq uint64 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"` // seq of the acknowledged Beat
+}
+
+func (x *BeatAck) Reset() {
+	*x = BeatAck{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_failure_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BeatAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BeatAck) ProtoMessage() {}
+
+func (x *BeatAck) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_failure_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BeatAck.ProtoReflect.Descriptor instead.
+func (*BeatAck) Descriptor() ([]byte, []int) {
+	return file_proto_failure_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *BeatAck) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
 var File_proto_failure_proto protoreflect.FileDescriptor
 
 var file_proto_failure_proto_rawDesc = []byte{
 	0x0a, 0x13, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x2e,
-	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x22, 0x22,
-	0x0a, 0x04, 0x42, 0x65, 0x61, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74,
-	0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74,
-	0x49, 0x44, 0x42, 0x25, 0x5a, 0x23, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d,
-	0x2f, 0x64, 0x6d, 0x77, 0x32, 0x31, 0x35, 0x31, 0x2f, 0x67, 0x6f, 0x2d, 0x66, 0x61, 0x69, 0x6c,
-	0x75, 0x72, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x22, 0xb6,
+	0x01, 0x0a, 0x04, 0x42, 0x65, 0x61, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x49, 0x44, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x63, 0x6c, 0x69, 0x65, 0x6e,
+	0x74, 0x49, 0x44, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04,
+	0x52, 0x03, 0x73, 0x65, 0x71, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x65, 0x61, 0x76, 0x65, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x6c, 0x65, 0x61, 0x76, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x61,
+	0x64, 0x64, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x61, 0x64, 0x64, 0x72, 0x12,
+	0x22, 0x0a, 0x0c, 0x73, 0x65, 0x6e, 0x74, 0x55, 0x6e, 0x69, 0x78, 0x4e, 0x61, 0x6e, 0x6f, 0x18,
+	0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x73, 0x65, 0x6e, 0x74, 0x55, 0x6e, 0x69, 0x78, 0x4e,
+	0x61, 0x6e, 0x6f, 0x12, 0x14, 0x0a, 0x05, 0x6b, 0x65, 0x79, 0x49, 0x44, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x6b, 0x65, 0x79, 0x49, 0x44, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x69, 0x67,
+	0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x09, 0x73, 0x69,
+	0x67, 0x6e, 0x61, 0x74, 0x75, 0x72, 0x65, 0x22, 0x1b, 0x0a, 0x07, 0x42, 0x65, 0x61, 0x74, 0x41,
+	0x63, 0x6b, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x03, 0x73, 0x65, 0x71, 0x32, 0x3a, 0x0a, 0x09, 0x48, 0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61,
+	0x74, 0x12, 0x2d, 0x0a, 0x06, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x12, 0x0d, 0x2e, 0x66, 0x61,
+	0x69, 0x6c, 0x75, 0x72, 0x65, 0x2e, 0x42, 0x65, 0x61, 0x74, 0x1a, 0x10, 0x2e, 0x66, 0x61, 0x69,
+	0x6c, 0x75, 0x72, 0x65, 0x2e, 0x42, 0x65, 0x61, 0x74, 0x41, 0x63, 0x6b, 0x28, 0x01, 0x30, 0x01,
+	0x42, 0x25, 0x5a, 0x23, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x64,
+	0x6d, 0x77, 0x32, 0x31, 0x35, 0x31, 0x2f, 0x67, 0x6f, 0x2d, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72,
+	0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -98,13 +208,16 @@ func file_proto_failure_proto_rawDescGZIP() []byte {
 	return file_proto_failure_proto_rawDescData
 }
 
-var file_proto_failure_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_proto_failure_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
 var file_proto_failure_proto_goTypes = []interface{}{
-	(*Beat)(nil), // 0: failure.Beat
+	(*Beat)(nil),    // 0: failure.Beat
+	(*BeatAck)(nil), // 1: failure.BeatAck
 }
 var file_proto_failure_proto_depIdxs = []int32{
-	0, // [0:0] is the sub-list for method output_type
-	0, // [0:0] is the sub-list for method input_type
+	0, // 0: failure.Heartbeat.Stream:input_type -> failure.Beat
+	1, // 1: failure.Heartbeat.Stream:output_type -> failure.BeatAck
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
 	0, // [0:0] is the sub-list for extension type_name
 	0, // [0:0] is the sub-list for extension extendee
 	0, // [0:0] is the sub-list for field type_name
@@ -128,6 +241,18 @@ func file_proto_failure_proto_init() {
 				return nil
 			}
 		}
+		file_proto_failure_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BeatAck); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -135,9 +260,9 @@ func file_proto_failure_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_proto_failure_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   1,
+			NumMessages:   2,
 			NumExtensions: 0,
-			NumServices:   0,
+			NumServices:   1,
 		},
 		GoTypes:           file_proto_failure_proto_goTypes,
 		DependencyIndexes: file_proto_failure_proto_depIdxs,
@@ -0,0 +1,137 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.21.9
+// source: proto/failure.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// HeartbeatClient is the client API for Heartbeat service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type HeartbeatClient interface {
+	Stream(ctx context.Context, opts ...grpc.CallOption) (Heartbeat_StreamClient, error)
+}
+
+type heartbeatClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewHeartbeatClient(cc grpc.ClientConnInterface) HeartbeatClient {
+	return &heartbeatClient{cc}
+}
+
+func (c *heartbeatClient) Stream(ctx context.Context, opts ...grpc.CallOption) (Heartbeat_StreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Heartbeat_ServiceDesc.Streams[0], "/failure.Heartbeat/Stream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &heartbeatStreamClient{stream}
+	return x, nil
+}
+
+type Heartbeat_StreamClient interface {
+	Send(*Beat) error
+	Recv() (*BeatAck, error)
+	grpc.ClientStream
+}
+
+type heartbeatStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *heartbeatStreamClient) Send(m *Beat) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *heartbeatStreamClient) Recv() (*BeatAck, error) {
+	m := new(BeatAck)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// HeartbeatServer is the server API for Heartbeat service.
+// All implementations must embed UnimplementedHeartbeatServer
+// for forward compatibility
+type HeartbeatServer interface {
+	Stream(Heartbeat_StreamServer) error
+	mustEmbedUnimplementedHeartbeatServer()
+}
+
+// UnimplementedHeartbeatServer must be embedded to have forward compatible implementations.
+type UnimplementedHeartbeatServer struct {
+}
+
+func (UnimplementedHeartbeatServer) Stream(Heartbeat_StreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedHeartbeatServer) mustEmbedUnimplementedHeartbeatServer() {}
+
+// UnsafeHeartbeatServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to HeartbeatServer will
+// result in compilation errors.
+type UnsafeHeartbeatServer interface {
+	mustEmbedUnimplementedHeartbeatServer()
+}
+
+func RegisterHeartbeatServer(s grpc.ServiceRegistrar, srv HeartbeatServer) {
+	s.RegisterService(&Heartbeat_ServiceDesc, srv)
+}
+
+func _Heartbeat_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(HeartbeatServer).Stream(&heartbeatStreamServer{stream})
+}
+
+type Heartbeat_StreamServer interface {
+	Send(*BeatAck) error
+	Recv() (*Beat, error)
+	grpc.ServerStream
+}
+
+type heartbeatStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *heartbeatStreamServer) Send(m *BeatAck) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *heartbeatStreamServer) Recv() (*Beat, error) {
+	m := new(Beat)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Heartbeat_ServiceDesc is the grpc.ServiceDesc for Heartbeat service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Heartbeat_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "failure.Heartbeat",
+	HandlerType: (*HeartbeatServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _Heartbeat_Stream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "proto/failure.proto",
+}
@@ -0,0 +1,336 @@
+//
+//protoc --go_out=. --go_opt=paths=source_relative \
+//./proto/snapshot.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        v3.21.9
+// source: proto/snapshot.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// NodeSnapshot - every detector on a node at a point in time, see: Node.Snapshot
+type NodeSnapshot struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version         uint32            `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	TakenAtUnixNano int64             `protobuf:"varint,2,opt,name=takenAtUnixNano,proto3" json:"takenAtUnixNano,omitempty"`
+	ServerAppID     string            `protobuf:"bytes,3,opt,name=serverAppID,proto3" json:"serverAppID,omitempty"`
+	ServerAddr      string            `protobuf:"bytes,4,opt,name=serverAddr,proto3" json:"serverAddr,omitempty"`
+	Clients         []*ClientSnapshot `protobuf:"bytes,5,rep,name=clients,proto3" json:"clients,omitempty"`
+}
+
+func (x *NodeSnapshot) Reset() {
+	*x = NodeSnapshot{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_snapshot_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NodeSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NodeSnapshot) ProtoMessage() {}
+
+func (x *NodeSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_snapshot_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NodeSnapshot.ProtoReflect.Descriptor instead.
+func (*NodeSnapshot) Descriptor() ([]byte, []int) {
+	return file_proto_snapshot_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *NodeSnapshot) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *NodeSnapshot) GetTakenAtUnixNano() int64 {
+	if x != nil {
+		return x.TakenAtUnixNano
+	}
+	return 0
+}
+
+func (x *NodeSnapshot) GetServerAppID() string {
+	if x != nil {
+		return x.ServerAppID
+	}
+	return ""
+}
+
+func (x *NodeSnapshot) GetServerAddr() string {
+	if x != nil {
+		return x.ServerAddr
+	}
+	return ""
+}
+
+func (x *NodeSnapshot) GetClients() []*ClientSnapshot {
+	if x != nil {
+		return x.Clients
+	}
+	return nil
+}
+
+// ClientSnapshot - a single client's detector
+type ClientSnapshot struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ClientAddr            string    `protobuf:"bytes,1,opt,name=clientAddr,proto3" json:"clientAddr,omitempty"`
+	ClientAppID           string    `protobuf:"bytes,2,opt,name=clientAppID,proto3" json:"clientAppID,omitempty"`
+	LastHeartbeatUnixNano int64     `protobuf:"varint,3,opt,name=lastHeartbeatUnixNano,proto3" json:"lastHeartbeatUnixNano,omitempty"`
+	Window                []float64 `protobuf:"fixed64,4,rep,packed,name=window,proto3" json:"window,omitempty"`     // intervals (ms), oldest first
+	TotalSamples          uint64    `protobuf:"varint,5,opt,name=totalSamples,proto3" json:"totalSamples,omitempty"` // incl. those since expired from the window
+	State                 int32     `protobuf:"varint,6,opt,name=state,proto3" json:"state,omitempty"`
+	LastPhi               float64   `protobuf:"fixed64,7,opt,name=lastPhi,proto3" json:"lastPhi,omitempty"`
+	Resumed               bool      `protobuf:"varint,8,opt,name=resumed,proto3" json:"resumed,omitempty"`    // restored from an earlier snapshot && no heartbeat since
+	ServeAddr             string    `protobuf:"bytes,9,opt,name=serveAddr,proto3" json:"serveAddr,omitempty"` // address the client advertised, if any, see: ClientStatus.Addr
+}
+
+func (x *ClientSnapshot) Reset() {
+	*x = ClientSnapshot{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_proto_snapshot_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ClientSnapshot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientSnapshot) ProtoMessage() {}
+
+func (x *ClientSnapshot) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_snapshot_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientSnapshot.ProtoReflect.Descriptor instead.
+func (*ClientSnapshot) Descriptor() ([]byte, []int) {
+	return file_proto_snapshot_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ClientSnapshot) GetClientAddr() string {
+	if x != nil {
+		return x.ClientAddr
+	}
+	return ""
+}
+
+func (x *ClientSnapshot) GetClientAppID() string {
+	if x != nil {
+		return x.ClientAppID
+	}
+	return ""
+}
+
+func (x *ClientSnapshot) GetLastHeartbeatUnixNano() int64 {
+	if x != nil {
+		return x.LastHeartbeatUnixNano
+	}
+	return 0
+}
+
+func (x *ClientSnapshot) GetWindow() []float64 {
+	if x != nil {
+		return x.Window
+	}
+	return nil
+}
+
+func (x *ClientSnapshot) GetTotalSamples() uint64 {
+	if x != nil {
+		return x.TotalSamples
+	}
+	return 0
+}
+
+func (x *ClientSnapshot) GetState() int32 {
+	if x != nil {
+		return x.State
+	}
+	return 0
+}
+
+func (x *ClientSnapshot) GetLastPhi() float64 {
+	if x != nil {
+		return x.LastPhi
+	}
+	return 0
+}
+
+func (x *ClientSnapshot) GetResumed() bool {
+	if x != nil {
+		return x.Resumed
+	}
+	return false
+}
+
+func (x *ClientSnapshot) GetServeAddr() string {
+	if x != nil {
+		return x.ServeAddr
+	}
+	return ""
+}
+
+var File_proto_snapshot_proto protoreflect.FileDescriptor
+
+var file_proto_snapshot_proto_rawDesc = []byte{
+	0x0a, 0x14, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x73, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74,
+	0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x07, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x22,
+	0xc7, 0x01, 0x0a, 0x0c, 0x4e, 0x6f, 0x64, 0x65, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74,
+	0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x28, 0x0a, 0x0f, 0x74, 0x61,
+	0x6b, 0x65, 0x6e, 0x41, 0x74, 0x55, 0x6e, 0x69, 0x78, 0x4e, 0x61, 0x6e, 0x6f, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x0f, 0x74, 0x61, 0x6b, 0x65, 0x6e, 0x41, 0x74, 0x55, 0x6e, 0x69, 0x78,
+	0x4e, 0x61, 0x6e, 0x6f, 0x12, 0x20, 0x0a, 0x0b, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x41, 0x70,
+	0x70, 0x49, 0x44, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x73, 0x65, 0x72, 0x76, 0x65,
+	0x72, 0x41, 0x70, 0x70, 0x49, 0x44, 0x12, 0x1e, 0x0a, 0x0a, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72,
+	0x41, 0x64, 0x64, 0x72, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x73, 0x65, 0x72, 0x76,
+	0x65, 0x72, 0x41, 0x64, 0x64, 0x72, 0x12, 0x31, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74,
+	0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72,
+	0x65, 0x2e, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74,
+	0x52, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x22, 0xac, 0x02, 0x0a, 0x0e, 0x43, 0x6c,
+	0x69, 0x65, 0x6e, 0x74, 0x53, 0x6e, 0x61, 0x70, 0x73, 0x68, 0x6f, 0x74, 0x12, 0x1e, 0x0a, 0x0a,
+	0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x41, 0x64, 0x64, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0a, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x41, 0x64, 0x64, 0x72, 0x12, 0x20, 0x0a, 0x0b,
+	0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x41, 0x70, 0x70, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0b, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x41, 0x70, 0x70, 0x49, 0x44, 0x12, 0x34,
+	0x0a, 0x15, 0x6c, 0x61, 0x73, 0x74, 0x48, 0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74, 0x55,
+	0x6e, 0x69, 0x78, 0x4e, 0x61, 0x6e, 0x6f, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x15, 0x6c,
+	0x61, 0x73, 0x74, 0x48, 0x65, 0x61, 0x72, 0x74, 0x62, 0x65, 0x61, 0x74, 0x55, 0x6e, 0x69, 0x78,
+	0x4e, 0x61, 0x6e, 0x6f, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x18, 0x04,
+	0x20, 0x03, 0x28, 0x01, 0x52, 0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f, 0x77, 0x12, 0x22, 0x0a, 0x0c,
+	0x74, 0x6f, 0x74, 0x61, 0x6c, 0x53, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x0c, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x53, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x73,
+	0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x05, 0x52,
+	0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6c, 0x61, 0x73, 0x74, 0x50, 0x68,
+	0x69, 0x18, 0x07, 0x20, 0x01, 0x28, 0x01, 0x52, 0x07, 0x6c, 0x61, 0x73, 0x74, 0x50, 0x68, 0x69,
+	0x12, 0x18, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x64, 0x18, 0x08, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x41, 0x64, 0x64, 0x72, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x73,
+	0x65, 0x72, 0x76, 0x65, 0x41, 0x64, 0x64, 0x72, 0x42, 0x25, 0x5a, 0x23, 0x67, 0x69, 0x74, 0x68,
+	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x64, 0x6d, 0x77, 0x32, 0x31, 0x35, 0x31, 0x2f, 0x67,
+	0x6f, 0x2d, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_proto_snapshot_proto_rawDescOnce sync.Once
+	file_proto_snapshot_proto_rawDescData = file_proto_snapshot_proto_rawDesc
+)
+
+func file_proto_snapshot_proto_rawDescGZIP() []byte {
+	file_proto_snapshot_proto_rawDescOnce.Do(func() {
+		file_proto_snapshot_proto_rawDescData = protoimpl.X.CompressGZIP(file_proto_snapshot_proto_rawDescData)
+	})
+	return file_proto_snapshot_proto_rawDescData
+}
+
+var file_proto_snapshot_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_snapshot_proto_goTypes = []interface{}{
+	(*NodeSnapshot)(nil),   // 0: failure.NodeSnapshot
+	(*ClientSnapshot)(nil), // 1: failure.ClientSnapshot
+}
+var file_proto_snapshot_proto_depIdxs = []int32{
+	1, // 0: failure.NodeSnapshot.clients:type_name -> failure.ClientSnapshot
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_proto_snapshot_proto_init() }
+func file_proto_snapshot_proto_init() {
+	if File_proto_snapshot_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_proto_snapshot_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NodeSnapshot); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_proto_snapshot_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ClientSnapshot); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_proto_snapshot_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_proto_snapshot_proto_goTypes,
+		DependencyIndexes: file_proto_snapshot_proto_depIdxs,
+		MessageInfos:      file_proto_snapshot_proto_msgTypes,
+	}.Build()
+	File_proto_snapshot_proto = out.File
+	file_proto_snapshot_proto_rawDesc = nil
+	file_proto_snapshot_proto_goTypes = nil
+	file_proto_snapshot_proto_depIdxs = nil
+}
@@ -0,0 +1,505 @@
+package failure
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultPublishInterval - time between beats when PublisherOptions.Interval is unset
+const DefaultPublishInterval time.Duration = time.Second
+
+// DefaultPublishJitter - fraction of the interval each wait varies by when
+// PublisherOptions.Jitter is unset
+const DefaultPublishJitter float64 = 0.1
+
+// DefaultPublishMinBackoff - first wait before reconnecting to a target
+const DefaultPublishMinBackoff time.Duration = 100 * time.Millisecond
+
+// DefaultPublishMaxBackoff - longest wait before reconnecting to a target
+const DefaultPublishMaxBackoff time.Duration = 30 * time.Second
+
+// DefaultLeaveTimeout - longest Close waits on each target to end the stream after the leave
+const DefaultLeaveTimeout time.Duration = time.Second
+
+var (
+	// errStreamEndedByServer - target ended the stream w/o an error
+	errStreamEndedByServer = errors.New("heartbeat stream ended by the server")
+
+	// errLeaveTimeout - target didn't end the stream after the leave
+	errLeaveTimeout = errors.New("timed out waiting for the server to end the stream")
+
+	// errPublisherRunning - Run called while the publisher is already running
+	errPublisherRunning = errors.New("failure: publisher is already running")
+)
+
+// PublisherOptions - where, as who && how often a Publisher sends beats
+type PublisherOptions struct {
+	AppID       string            // sent as each Beat's ClientID
+	Addr        string            // optional, address the publisher's process serves on, lets balancers route to it, see: ClientStatus.Addr
+	SigningKey  *SigningKey       // optional, sign every beat w. the key, for nodes w. AuthHMAC
+	Targets     []string          // addresses of the detector nodes to send beats to, each gets every beat
+	Interval    time.Duration     // optional, defaults to DefaultPublishInterval
+	Jitter      float64           // optional, each wait is Interval +/- Jitter*Interval, defaults to DefaultPublishJitter, < 0 for none
+	MinBackoff  time.Duration     // optional, defaults to DefaultPublishMinBackoff
+	MaxBackoff  time.Duration     // optional, defaults to DefaultPublishMaxBackoff
+	DialOptions []grpc.DialOption // optional, defaults to insecure transport credentials
+	Logger      Logger            // optional, defaults to the global logrus instance
+	Metrics     *MetricsOptions   // optional, only Registerer, Namespace && ConstLabels apply
+}
+
+// Publisher - sends beats to one or more detector nodes over a long-lived heartbeat stream to
+// each (see: HeartbeatService), reconnecting w. backoff when a stream fails
+type Publisher struct {
+	opts    *PublisherOptions
+	logger  Logger
+	metrics *publisherMetrics
+	targets []*publishTarget
+	closing chan struct{}
+	closed  bool // guarded by mu
+	running bool // guarded by mu, only one Run at a time
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// publishTarget - a single detector node's connection, seq && left are only used by its own loop
+// (or by Close once no loop is running)
+type publishTarget struct {
+	addr   string
+	conn   *grpc.ClientConn
+	client failproto.HeartbeatClient
+	seq    uint64
+	left   bool // loop sent (or tried to send) the leave on its stream
+}
+
+// NewPublisher - new publisher w. a connection to each target, beats are only sent once Run
+// is called
+func NewPublisher(opts *PublisherOptions) (*Publisher, error) {
+
+	if opts.AppID == "" {
+		return nil, errors.New("failure: publisher needs an AppID")
+	}
+	if len(opts.Targets) == 0 {
+		return nil, errors.New("failure: publisher needs at least one target")
+	}
+
+	var logger Logger = opts.Logger
+	if logger == nil {
+		logger = LogrusLogger(nil)
+	}
+
+	p := &Publisher{
+		opts:    opts,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}
+
+	var err error
+	if p.metrics, err = newPublisherMetrics(opts.Metrics); err != nil {
+		logger.Warn("failed to register heartbeat publisher metrics",
+			"client_app_id", opts.AppID,
+			"err", err,
+		)
+	}
+
+	dialOpts := opts.DialOptions
+	if len(dialOpts) == 0 {
+		dialOpts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	for _, addr := range opts.Targets {
+		conn, err := grpc.Dial(addr, dialOpts...)
+		if err != nil {
+			for _, t := range p.targets {
+				t.conn.Close()
+			}
+			return nil, err
+		}
+		p.targets = append(p.targets, &publishTarget{addr: addr, conn: conn, client: failproto.NewHeartbeatClient(conn)})
+	}
+	return p, nil
+}
+
+// Run - send beats to every target until ctx is done or the publisher is closed, returns
+// ctx.Err() or nil after Close. Only one Run at a time, a second returns an error
+func (p *Publisher) Run(ctx context.Context) error {
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	if p.running {
+		p.mu.Unlock()
+		return errPublisherRunning
+	}
+	p.running = true
+	for _, t := range p.targets {
+		p.wg.Add(1)
+		go p.publish(ctx, t)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+	p.mu.Lock()
+	p.running = false
+	p.mu.Unlock()
+
+	select {
+	case <-p.closing:
+		return nil
+	default:
+		return ctx.Err()
+	}
+}
+
+// Close - send a leave to every target so the nodes remove this publisher at once, then stop Run
+// && close the connections. Leaves are sent whether or not Run is running (or ever ran), call
+// Close even after Run returns to leave && release the connections
+func (p *Publisher) Close() error {
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.closing)
+	p.mu.Unlock()
+	p.wg.Wait()
+
+	// targets whose loop didn't leave on its stream (Run isn't running, or the loop was between
+	// streams) get the leave on a stream of its own
+	var leaving sync.WaitGroup
+	for _, t := range p.targets {
+		if t.left {
+			continue
+		}
+		leaving.Add(1)
+		go func(t *publishTarget) {
+			defer leaving.Done()
+			p.logLeave(t, p.leaveTarget(t))
+		}(t)
+	}
+	leaving.Wait()
+
+	var err error
+	for _, t := range p.targets {
+		if closeErr := t.conn.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// publish - hold a stream to the target, reconnecting w. backoff, until ctx is done or the
+// publisher closes
+func (p *Publisher) publish(ctx context.Context, t *publishTarget) {
+
+	defer p.wg.Done()
+
+	var backoff time.Duration = p.minBackoff()
+	for {
+		sent, err := p.stream(ctx, t)
+
+		select {
+		case <-p.closing:
+			if t.left {
+				p.logLeave(t, err)
+			}
+			return
+		default:
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		// a stream that carried beats was healthy for a while, start backing off from scratch
+		if sent > 0 {
+			backoff = p.minBackoff()
+		}
+		p.metrics.reconnects.WithLabelValues(p.opts.AppID, t.addr).Inc()
+		p.logger.Warn("heartbeat stream to detector failed, reconnecting",
+			"client_app_id", p.opts.AppID,
+			"target", t.addr,
+			"backoff", backoff.String(),
+			"err", err,
+		)
+
+		// full jitter, so publishers that lost the same target don't reconnect in lockstep
+		wait := time.NewTimer(time.Duration(rand.Int63n(int64(backoff)) + 1))
+		select {
+		case <-wait.C:
+		case <-ctx.Done():
+			wait.Stop()
+			return
+		case <-p.closing:
+			wait.Stop()
+			return
+		}
+		if backoff *= 2; backoff > p.maxBackoff() {
+			backoff = p.maxBackoff()
+		}
+	}
+}
+
+// stream - send beats on a single stream to the target until it fails, ctx is done or the
+// publisher closes, returns the number of beats sent
+func (p *Publisher) stream(ctx context.Context, t *publishTarget) (int, error) {
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := t.client.Stream(streamCtx)
+	if err != nil {
+		p.metrics.beats.WithLabelValues(p.opts.AppID, t.addr, "failed").Inc()
+		return 0, err
+	}
+
+	connected := p.metrics.connected.WithLabelValues(p.opts.AppID, t.addr)
+	connected.Set(1)
+	defer connected.Set(0)
+
+	// acks are drained on their own goroutine, Recv failing is the stream breaking
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := stream.Recv(); err != nil {
+				recvErr <- err
+				return
+			}
+		}
+	}()
+
+	var (
+		sent  int
+		timer *time.Timer = time.NewTimer(0)
+	)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if err := p.send(stream, t, false); err != nil {
+				return sent, err
+			}
+			sent++
+			timer.Reset(p.opts.nextInterval())
+		case err := <-recvErr:
+			if err == io.EOF {
+				err = errStreamEndedByServer
+			}
+			return sent, err
+		case <-ctx.Done():
+			return sent, ctx.Err()
+		case <-p.closing:
+			t.left = true
+			return sent, p.leave(stream, t, recvErr)
+		}
+	}
+}
+
+// leaveTarget - send a leave to the target on a stream of its own
+func (p *Publisher) leaveTarget(t *publishTarget) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultLeaveTimeout)
+	defer cancel()
+
+	stream, err := t.client.Stream(ctx)
+	if err != nil {
+		p.metrics.beats.WithLabelValues(p.opts.AppID, t.addr, "failed").Inc()
+		return err
+	}
+
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := stream.Recv(); err != nil {
+				recvErr <- err
+				return
+			}
+		}
+	}()
+	return p.leave(stream, t, recvErr)
+}
+
+// logLeave - log a leave that failed
+func (p *Publisher) logLeave(t *publishTarget, err error) {
+	if err == nil {
+		return
+	}
+	p.logger.Warn("failed to leave detector",
+		"client_app_id", p.opts.AppID,
+		"target", t.addr,
+		"err", err,
+	)
+}
+
+// leave - send a leave on the stream && close it, waiting for the target to end the stream so
+// the leave has been processed by the time Close returns
+func (p *Publisher) leave(stream failproto.Heartbeat_StreamClient, t *publishTarget, recvErr chan error) error {
+
+	if err := p.send(stream, t, true); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(DefaultLeaveTimeout)
+	defer timeout.Stop()
+	select {
+	case err := <-recvErr:
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	case <-timeout.C:
+		return errLeaveTimeout
+	}
+}
+
+// send - send a single beat, counting it as sent or failed
+func (p *Publisher) send(stream failproto.Heartbeat_StreamClient, t *publishTarget, leave bool) error {
+
+	t.seq++
+	beat := &failproto.Beat{ClientID: p.opts.AppID, Addr: p.opts.Addr, Seq: t.seq, Leave: leave}
+	if p.opts.SigningKey != nil {
+		SignBeat(beat, p.opts.SigningKey, time.Now())
+	}
+	err := stream.Send(beat)
+
+	var result string = "sent"
+	if err != nil {
+		result = "failed"
+	}
+	p.metrics.beats.WithLabelValues(p.opts.AppID, t.addr, result).Inc()
+	return err
+}
+
+// nextInterval - time until the next beat, w. jitter
+func (o *PublisherOptions) nextInterval() time.Duration {
+
+	var (
+		interval time.Duration = o.Interval
+		jitter   float64       = o.Jitter
+	)
+	if interval <= 0 {
+		interval = DefaultPublishInterval
+	}
+	if jitter == 0 {
+		jitter = DefaultPublishJitter
+	}
+	if jitter < 0 {
+		return interval
+	}
+	return time.Duration(float64(interval) * (1 + jitter*(2*rand.Float64()-1)))
+}
+
+// minBackoff - first wait before reconnecting
+func (p *Publisher) minBackoff() time.Duration {
+	if p.opts.MinBackoff > 0 {
+		return p.opts.MinBackoff
+	}
+	return DefaultPublishMinBackoff
+}
+
+// maxBackoff - longest wait before reconnecting
+func (p *Publisher) maxBackoff() time.Duration {
+	if p.opts.MaxBackoff > 0 {
+		return p.opts.MaxBackoff
+	}
+	return DefaultPublishMaxBackoff
+}
+
+// publisherMetrics - a publisher's counters, shared by every publisher on the same registry &&
+// told apart by client_app_id
+type publisherMetrics struct {
+
+	// failure_detector_publisher_beats_total -> beats sent or failed, per target
+	beats *prometheus.CounterVec
+
+	// failure_detector_publisher_reconnects_total -> streams re-established after failing
+	reconnects *prometheus.CounterVec
+
+	// failure_detector_publisher_connected -> 1 while a stream to the target is open
+	connected *prometheus.GaugeVec
+}
+
+// newPublisherMetrics - publisher metrics registered w. mOpts.Registerer, or those already
+// registered by another publisher
+func newPublisherMetrics(mOpts *MetricsOptions) (*publisherMetrics, error) {
+
+	var opts MetricsOptions
+	if mOpts != nil {
+		opts = *mOpts
+	}
+	if opts.Registerer == nil {
+		opts.Registerer = prometheus.DefaultRegisterer
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultMetricsNamespace
+	}
+
+	m := &publisherMetrics{
+		beats: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "publisher",
+			Name:        "beats_total",
+			Help:        "beats sent to each target, by result",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"client_app_id", "target", "result"}),
+		reconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "publisher",
+			Name:        "reconnects_total",
+			Help:        "heartbeat streams re-established after failing",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"client_app_id", "target"}),
+		connected: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   opts.Namespace,
+			Subsystem:   "publisher",
+			Name:        "connected",
+			Help:        "1 while a heartbeat stream to the target is open",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"client_app_id", "target"}),
+	}
+
+	var err error
+	if existing, regErr := registerOrExisting(opts.Registerer, m.beats); regErr == nil {
+		m.beats = existing.(*prometheus.CounterVec)
+	} else {
+		err = regErr
+	}
+	if existing, regErr := registerOrExisting(opts.Registerer, m.reconnects); regErr == nil {
+		m.reconnects = existing.(*prometheus.CounterVec)
+	} else {
+		err = regErr
+	}
+	if existing, regErr := registerOrExisting(opts.Registerer, m.connected); regErr == nil {
+		m.connected = existing.(*prometheus.GaugeVec)
+	} else {
+		err = regErr
+	}
+	return m, err
+}
+
+// registerOrExisting - register c, or return the identical collector already registered
+func registerOrExisting(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector, nil
+		}
+		return c, err
+	}
+	return c, nil
+}
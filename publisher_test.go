@@ -0,0 +1,180 @@
+package failure
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// serveHeartbeats - grpc server for n's heartbeat stream on addr ("127.0.0.1:0" for any port),
+// returns the address it listens on && a func stopping it
+func serveHeartbeats(t testing.TB, n *Node, addr string) (string, func()) {
+
+	lis, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	srv := grpc.NewServer(grpc.StreamInterceptor(n.FailureDetectorStreamInterceptor()))
+	failproto.RegisterHeartbeatServer(srv, HeartbeatService{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String(), srv.Stop
+}
+
+// newTestPublisher - fast publisher to targets, metrics go to the returned registry
+func newTestPublisher(t *testing.T, targets ...string) (*Publisher, *prometheus.Registry) {
+	reg := prometheus.NewRegistry()
+	p, err := NewPublisher(&PublisherOptions{
+		AppID:      "worker",
+		Targets:    targets,
+		Interval:   10 * time.Millisecond,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 50 * time.Millisecond,
+		Logger:     NopLogger(),
+		Metrics:    &MetricsOptions{Registerer: reg},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { p.Close() })
+	return p, reg
+}
+
+// eventuallyClient - wait for n to have a single client w. at least samples samples
+func eventuallyClient(t *testing.T, n *Node, samples int) ClientStatus {
+	var status ClientStatus
+	require.Eventually(t, func() bool {
+		clients := n.Clients()
+		if len(clients) != 1 {
+			return false
+		}
+		status = clients[0]
+		return status.Samples >= samples
+	}, 5*time.Second, 5*time.Millisecond)
+	return status
+}
+
+func TestPublisher(t *testing.T) {
+
+	var (
+		a, _     = newTestNode(&NodeOptions{})
+		b, _     = newTestNode(&NodeOptions{})
+		addrA, _ = serveHeartbeats(t, a, "127.0.0.1:0")
+		addrB, _ = serveHeartbeats(t, b, "127.0.0.1:0")
+		p, reg   = newTestPublisher(t, addrA, addrB)
+	)
+
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+
+	// every target gets every beat
+	for _, n := range []*Node{a, b} {
+		status := eventuallyClient(t, n, 3)
+		assert.Equal(t, "worker", status.AppID)
+	}
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metrics.connected.WithLabelValues("worker", addrA)))
+	assert.Less(t, 3.0, testutil.ToFloat64(p.metrics.beats.WithLabelValues("worker", addrB, "sent")))
+
+	// leaves on Close, the nodes drop it at once
+	require.NoError(t, p.Close())
+	assert.NoError(t, <-done)
+	assert.Empty(t, a.Clients())
+	assert.Empty(t, b.Clients())
+
+	count, err := testutil.GatherAndCount(reg, "failure_detector_publisher_beats_total")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestPublisherReconnects(t *testing.T) {
+
+	var (
+		first, _    = newTestNode(&NodeOptions{})
+		addr, stop  = serveHeartbeats(t, first, "127.0.0.1:0")
+		p, _        = newTestPublisher(t, addr)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+	defer cancel()
+	go p.Run(ctx)
+	eventuallyClient(t, first, 2)
+
+	// the target restarts on the same address, w. nothing to remember the publisher by
+	stop()
+	second, _ := newTestNode(&NodeOptions{})
+	serveHeartbeats(t, second, addr)
+	eventuallyClient(t, second, 2)
+
+	assert.LessOrEqual(t, 1.0, testutil.ToFloat64(p.metrics.reconnects.WithLabelValues("worker", addr)))
+}
+
+func TestPublisherContextCancelled(t *testing.T) {
+
+	var (
+		n, _        = newTestNode(&NodeOptions{})
+		addr, _     = serveHeartbeats(t, n, "127.0.0.1:0")
+		p, _        = newTestPublisher(t, addr)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+	eventuallyClient(t, n, 3)
+
+	// stops w/o leaving, to the node that's a broken stream
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	require.Eventually(t, func() bool {
+		status, _ := n.Client(n.Clients()[0].ClientID)
+		return status.State == StateSuspected
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// ...but Close still leaves
+	require.NoError(t, p.Close())
+	assert.Empty(t, n.Clients())
+}
+
+func TestPublisherRunOnce(t *testing.T) {
+
+	var (
+		n, _    = newTestNode(&NodeOptions{})
+		addr, _ = serveHeartbeats(t, n, "127.0.0.1:0")
+		p, _    = newTestPublisher(t, addr)
+	)
+
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+	eventuallyClient(t, n, 1)
+	assert.ErrorIs(t, p.Run(context.Background()), errPublisherRunning)
+
+	require.NoError(t, p.Close())
+	assert.NoError(t, <-done)
+	assert.NoError(t, p.Run(context.Background()))
+}
+
+func TestPublisherCloseWithoutRun(t *testing.T) {
+
+	var (
+		n, _    = newTestNode(&NodeOptions{})
+		addr, _ = serveHeartbeats(t, n, "127.0.0.1:0")
+		p, _    = newTestPublisher(t, addr)
+	)
+
+	// the leave is sent all the same, a node that never saw the publisher has nothing to remove
+	require.NoError(t, p.Close())
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metrics.beats.WithLabelValues("worker", addr, "sent")))
+	assert.Empty(t, n.Clients())
+}
+
+func TestNewPublisherInvalid(t *testing.T) {
+
+	_, err := NewPublisher(&PublisherOptions{Targets: []string{"127.0.0.1:52151"}})
+	assert.Error(t, err)
+	_, err = NewPublisher(&PublisherOptions{AppID: "worker"})
+	assert.Error(t, err)
+}
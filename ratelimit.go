@@ -0,0 +1,203 @@
+package failure
+
+import (
+	"sync"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimitAction - what happens to a heartbeat over the rate limit
+type RateLimitAction int
+
+const (
+	// RateLimitReject - fail the heartbeat w. ResourceExhausted, on a stream this ends the stream.
+	// Unlike a broken stream that doesn't suspect the client, a flood over the global limit
+	// would otherwise get well-behaved streaming clients suspected
+	RateLimitReject RateLimitAction = iota
+
+	// RateLimitCoalesce - accept the heartbeat but fold it into the client's last one, i.e. it
+	// isn't recorded as an arrival
+	RateLimitCoalesce
+)
+
+// DefaultRateLimitMaxClients - clients a node keeps rate limit buckets for when
+// RateLimitOptions.MaxClients is unset
+const DefaultRateLimitMaxClients int = 1 << 16
+
+// rateLimitSweepInterval - min. time between sweeps for refilled buckets when the limiter is full
+const rateLimitSweepInterval time.Duration = time.Second
+
+// RateLimitOptions - most heartbeats a node's interceptors take in, per client && overall. A
+// limit of 0 is no limit. Leave beats are limited like any other, they're only authenticated
+// after the limit
+type RateLimitOptions struct {
+	PerClient      float64         // optional, beats/s from a single client (i.e. peer address)
+	PerClientBurst int             // optional, beats a client may send at once, defaults to 1
+	Global         float64         // optional, beats/s from all clients together
+	GlobalBurst    int             // optional, beats all clients may send at once, defaults to 1
+	Action         RateLimitAction // optional, defaults to RateLimitReject
+	MaxClients     int             // optional, clients to keep buckets for (UDP source addresses are spoofable), defaults to DefaultRateLimitMaxClients
+}
+
+// maxClients - clients to keep buckets for
+func (o *RateLimitOptions) maxClients() int {
+	if o.MaxClients > 0 {
+		return o.MaxClients
+	}
+	return DefaultRateLimitMaxClients
+}
+
+// tokenBucket - token bucket kept as the time it'll next be full (GCRA), each heartbeat pushes
+// that time back by one interval (1/rate) && a heartbeat is allowed while it's no more than
+// burst-1 intervals ahead. Integer durations keep refills exact, summed fractional tokens don't
+type tokenBucket struct {
+	interval  time.Duration
+	tolerance time.Duration
+	full      time.Time // bucket is full from then on
+}
+
+// newTokenBucket - full bucket
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	interval := time.Duration(float64(time.Second) / rate)
+	return &tokenBucket{interval: interval, tolerance: time.Duration(max(burst, 1)-1) * interval}
+}
+
+// conforms - bucket has a token at t
+func (b *tokenBucket) conforms(t time.Time) bool {
+	return !t.Before(b.full.Add(-b.tolerance))
+}
+
+// take - take a token at t, caller checks conforms first
+func (b *tokenBucket) take(t time.Time) {
+	if b.full.Before(t) {
+		b.full = t
+	}
+	b.full = b.full.Add(b.interval)
+}
+
+// rateLimiter - per-client && global token buckets
+type rateLimiter struct {
+	opts    *RateLimitOptions
+	global  *tokenBucket            // guarded by mu
+	clients map[string]*tokenBucket // guarded by mu
+	swept   time.Time               // last sweep for refilled buckets, guarded by mu
+	mu      sync.Mutex
+}
+
+// newRateLimiter - limiter per opts, nil w/o any limit
+func newRateLimiter(opts *RateLimitOptions) *rateLimiter {
+
+	if opts == nil || (opts.PerClient <= 0 && opts.Global <= 0) {
+		return nil
+	}
+
+	l := &rateLimiter{opts: opts, clients: make(map[string]*tokenBucket)}
+	if opts.Global > 0 {
+		l.global = newTokenBucket(opts.Global, opts.GlobalBurst)
+	}
+	return l
+}
+
+// allow - take a token for a heartbeat from clientID at t, returns the limit it's over ("client"
+// or "global") if there's no token to take. Neither bucket is charged for a limited heartbeat
+func (l *rateLimiter) allow(clientID string, t time.Time) (string, bool) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var client *tokenBucket
+	if l.opts.PerClient > 0 {
+		var ok bool
+		if client, ok = l.clients[clientID]; !ok {
+			if len(l.clients) >= l.opts.maxClients() {
+				l.makeRoom(t)
+			}
+			client = newTokenBucket(l.opts.PerClient, l.opts.PerClientBurst)
+			l.clients[clientID] = client
+		}
+		if !client.conforms(t) {
+			return "client", false
+		}
+	}
+
+	if l.global != nil {
+		if !l.global.conforms(t) {
+			return "global", false
+		}
+		l.global.take(t)
+	}
+	if client != nil {
+		client.take(t)
+	}
+	return "", true
+}
+
+// makeRoom - drop buckets until there's room for another client, refilled ones first (at most
+// once per rateLimitSweepInterval, a sweep goes over every client) then arbitrary ones. An
+// evicted client just starts over w. a full bucket. caller must hold l.mu
+func (l *rateLimiter) makeRoom(t time.Time) {
+	if t.Sub(l.swept) >= rateLimitSweepInterval {
+		l.sweep(t)
+	}
+	for clientID := range l.clients {
+		if len(l.clients) < l.opts.maxClients() {
+			return
+		}
+		delete(l.clients, clientID)
+	}
+}
+
+// sweep - forget clients whose buckets have refilled, a new bucket is full anyway. caller must
+// hold l.mu
+func (l *rateLimiter) sweep(t time.Time) {
+	l.swept = t
+	for clientID, bucket := range l.clients {
+		if !bucket.full.After(t) {
+			delete(l.clients, clientID)
+		}
+	}
+}
+
+// prune - sweep for refilled buckets
+func (l *rateLimiter) prune(t time.Time) {
+
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(t)
+}
+
+// limit - apply NodeOptions.RateLimit to a heartbeat from clientID, returns whether to process
+// it && the error to fail it w. (ResourceExhausted under RateLimitReject). Limited heartbeats
+// are counted && logged at Debug, a flooding client would flood the log too. Leave beats aren't
+// exempt, the flag isn't authenticated yet && would let a flood skip the limits
+func (n *Node) limit(clientID string, beatmsg *failproto.Beat) (bool, error) {
+
+	if n.limiter == nil {
+		return true, nil
+	}
+	scope, ok := n.limiter.allow(clientID, n.clock.Now())
+	if ok {
+		return true, nil
+	}
+
+	var action string = "rejected"
+	if n.limiter.opts.Action == RateLimitCoalesce {
+		action = "coalesced"
+	}
+	n.metrics.observeLimit(scope, action)
+	n.logger.Debug("heartbeat over rate limit",
+		n.clientLogArgs(clientID, beatmsg.ClientID, "limit", scope, "action", action)...,
+	)
+
+	if n.limiter.opts.Action == RateLimitCoalesce {
+		return false, nil
+	}
+	return false, status.Errorf(codes.ResourceExhausted, "heartbeat over the %s rate limit", scope)
+}
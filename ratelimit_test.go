@@ -0,0 +1,203 @@
+package failure
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// limited - heartbeats the node limited at scope w. action
+func limited(n *Node, scope string, action string) float64 {
+	return testutil.ToFloat64(n.metrics.heartbeatsLimited.WithLabelValues(
+		append(n.metrics.labelValues(n.metrics.nodeLabels, "", ""), scope, action)...,
+	))
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+
+	var (
+		n, clock = newTestNode(&NodeOptions{RateLimit: &RateLimitOptions{PerClient: 2, PerClientBurst: 2}})
+		ctx      = context.Background()
+		beat     = &failproto.Beat{ClientID: "worker"}
+	)
+
+	// the burst, then nothing until a token refills
+	for i := 0; i < 2; i++ {
+		require.NoError(t, interceptBeat(t, ctx, n, "10.0.0.1:40000", beat))
+	}
+	err := interceptBeat(t, ctx, n, "10.0.0.1:40000", beat)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, 1.0, limited(n, "client", "rejected"))
+
+	// other clients have their own budget
+	assert.NoError(t, interceptBeat(t, ctx, n, "10.0.0.2:40000", beat))
+
+	clock.Advance(500 * time.Millisecond)
+	assert.NoError(t, interceptBeat(t, ctx, n, "10.0.0.1:40000", beat))
+
+	// refilled buckets are forgotten
+	clock.Advance(time.Second)
+	n.PurgeInactiveClients(ctx, clock.Now())
+	assert.Empty(t, n.limiter.clients)
+}
+
+func TestRateLimitLeave(t *testing.T) {
+
+	var (
+		keys     = NewKeyRing(map[string][]byte{testKey.ID: testKey.Secret})
+		n, clock = newTestNode(&NodeOptions{
+			Logger:    NopLogger(),
+			Auth:      &AuthOptions{Mode: AuthHMAC, Keys: keys},
+			RateLimit: &RateLimitOptions{PerClient: 1},
+		})
+		ctx = context.Background()
+	)
+	require.NoError(t, interceptBeat(t, ctx, n, "10.0.0.1:40000", signedBeat("10.0.0.1:8080", 1, testKey, clock.Now())))
+
+	// forged leaves are limited before their signatures are checked
+	for i := 0; i < 100; i++ {
+		err := interceptBeat(t, ctx, n, "10.0.0.9:40000", &failproto.Beat{ClientID: "worker", Addr: "10.0.0.1:8080", Leave: true})
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 1.0, rejected(n, "unsigned"))
+	assert.Equal(t, 99.0, limited(n, "client", "rejected"))
+	_, ok := n.Client("10.0.0.1:40000")
+	assert.True(t, ok)
+
+	// a client leaving an interval after its last beat has a token for it
+	clock.Advance(time.Second)
+	leave := &failproto.Beat{ClientID: "worker", Addr: "10.0.0.1:8080", Seq: 2, Leave: true}
+	SignBeat(leave, testKey, clock.Now())
+	require.NoError(t, interceptBeat(t, ctx, n, "10.0.0.1:40000", leave))
+	_, ok = n.Client("10.0.0.1:40000")
+	assert.False(t, ok)
+}
+
+func TestRateLimitMaxClients(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{RateLimit: &RateLimitOptions{PerClient: 1, MaxClients: 2}})
+
+	// spoofed sources can't grow the limiter past MaxClients
+	for i := 0; i < 10; i++ {
+		require.NoError(t, interceptBeat(t, context.Background(), n, fmt.Sprintf("10.0.0.%d:40000", i+1), &failproto.Beat{ClientID: "worker"}))
+		assert.LessOrEqual(t, len(n.limiter.clients), 2)
+	}
+	_, ok := n.limiter.clients["10.0.0.10:40000"]
+	assert.True(t, ok)
+
+	// refilled buckets are swept first, w/o a purge
+	clock.Advance(time.Second)
+	require.NoError(t, interceptBeat(t, context.Background(), n, "10.0.0.11:40000", &failproto.Beat{ClientID: "worker"}))
+	assert.Len(t, n.limiter.clients, 1)
+}
+
+func TestRateLimitCoalesce(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{RateLimit: &RateLimitOptions{PerClient: 1, Action: RateLimitCoalesce}})
+
+	// a client spinning every 100ms still looks like one beating every second
+	for i := 0; i < 21; i++ {
+		require.NoError(t, interceptBeat(t, context.Background(), n, "10.0.0.1:40000", &failproto.Beat{ClientID: "worker"}))
+		clock.Advance(100 * time.Millisecond)
+	}
+
+	window, ok := n.ClientIntervals("10.0.0.1:40000")
+	require.True(t, ok)
+	assert.Equal(t, []float64{1000, 1000}, window)
+	assert.Equal(t, 18.0, limited(n, "client", "coalesced"))
+}
+
+func TestRateLimitGlobal(t *testing.T) {
+
+	n, clock := newTestNode(&NodeOptions{RateLimit: &RateLimitOptions{PerClient: 1, Global: 2, GlobalBurst: 3}})
+
+	for _, clientID := range []string{"10.0.0.1:40000", "10.0.0.2:40000", "10.0.0.3:40000"} {
+		require.NoError(t, interceptBeat(t, context.Background(), n, clientID, &failproto.Beat{ClientID: "worker"}))
+	}
+	err := interceptBeat(t, context.Background(), n, "10.0.0.4:40000", &failproto.Beat{ClientID: "worker"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, 1.0, limited(n, "global", "rejected"))
+
+	// the client's own budget wasn't charged for the rejected beat, it has 1 beat/s to itself
+	clock.Advance(500 * time.Millisecond)
+	assert.NoError(t, interceptBeat(t, context.Background(), n, "10.0.0.4:40000", &failproto.Beat{ClientID: "worker"}))
+}
+
+func TestRateLimitStream(t *testing.T) {
+
+	n, _ := newTestNode(&NodeOptions{RateLimit: &RateLimitOptions{PerClient: 1, Action: RateLimitCoalesce}})
+	stream, err := newStreamServer(t, n).Stream(context.Background())
+	require.NoError(t, err)
+
+	// every beat is acked, only the first is recorded
+	streamBeats(t, stream, 5)
+	require.NoError(t, stream.CloseSend())
+	client, ok := n.Client("bufconn")
+	require.True(t, ok)
+	assert.Equal(t, 0, client.Samples)
+	assert.Equal(t, 4.0, limited(n, "client", "coalesced"))
+
+	// rejecting instead ends the stream
+	n.limiter.opts.Action = RateLimitReject
+	stream, err = newStreamServer(t, n).Stream(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&failproto.Beat{ClientID: "worker", Seq: 1}))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestRateLimitGlobalStreamFlood(t *testing.T) {
+
+	var (
+		n, clock = newTestNode(&NodeOptions{RateLimit: &RateLimitOptions{Global: 1}})
+		addr, _  = serveHeartbeats(t, n, "127.0.0.1:0")
+	)
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// a worker beating at the global limit on its own stream...
+	worker, err := failproto.NewHeartbeatClient(conn).Stream(context.Background())
+	require.NoError(t, err)
+	for seq := uint64(1); seq <= 3; seq++ {
+		clock.Advance(time.Second)
+		require.NoError(t, worker.Send(&failproto.Beat{ClientID: "worker", Seq: seq}))
+		_, err := worker.Recv()
+		require.NoError(t, err)
+	}
+	clients := n.Clients()
+	require.Len(t, clients, 1)
+	require.Equal(t, StateHealthy, clients[0].State)
+
+	// ...until another client floods the node && uses up the global budget
+	flooder, err := failproto.NewHeartbeatClient(conn).Stream(context.Background())
+	require.NoError(t, err)
+	for err == nil {
+		if err = flooder.Send(&failproto.Beat{ClientID: "flooder"}); err == nil {
+			_, err = flooder.Recv()
+		}
+	}
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// the worker's next beat is rejected && its stream ends, but the node ended it, the worker
+	// didn't fail
+	require.NoError(t, worker.Send(&failproto.Beat{ClientID: "worker", Seq: 4}))
+	_, err = worker.Recv()
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.GreaterOrEqual(t, limited(n, "global", "rejected"), 2.0)
+
+	client, ok := n.Client(clients[0].ClientID)
+	require.True(t, ok)
+	assert.Equal(t, StateHealthy, client.State)
+}
@@ -0,0 +1,197 @@
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// SnapshotVersion - version of the snapshot format written by Node.Snapshot
+const SnapshotVersion uint32 = 1
+
+// DefaultSnapshotMaxAge - oldest snapshot Node.Restore accepts when RestoreOptions.MaxAge is unset
+const DefaultSnapshotMaxAge time.Duration = 10 * time.Minute
+
+var (
+	// ErrSnapshotVersion - snapshot written by a newer version of the package
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+
+	// ErrSnapshotTooOld - snapshot older than RestoreOptions.MaxAge
+	ErrSnapshotTooOld = errors.New("snapshot too old")
+)
+
+// RestoreOptions - how much of a snapshot Node.Restore trusts
+type RestoreOptions struct {
+	MaxAge time.Duration // optional, defaults to DefaultSnapshotMaxAge, < 0 accepts any age
+}
+
+// Snapshot - serialize every detector on the node (window, sample count, last heartbeat, state
+// && metadata), see: Restore
+func (n *Node) Snapshot() ([]byte, error) {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return proto.Marshal(n.snapshot())
+}
+
+// snapshot - every detector on the node, caller must hold n.mu
+func (n *Node) snapshot() *failproto.NodeSnapshot {
+
+	snapshot := &failproto.NodeSnapshot{
+		Version:         SnapshotVersion,
+		TakenAtUnixNano: n.clock.Now().UnixNano(),
+		ServerAppID:     n.metadata.AppID,
+		ServerAddr:      n.metadata.HostAddress,
+		Clients:         make([]*failproto.ClientSnapshot, 0, len(n.RecentClients)),
+	}
+
+	for clientID, detector := range n.RecentClients {
+		var serveAddr string
+		if detector.metadata.HostAddress != clientID {
+			serveAddr = detector.metadata.HostAddress
+		}
+		snapshot.Clients = append(snapshot.Clients, &failproto.ClientSnapshot{
+			ClientAddr:            clientID,
+			ClientAppID:           detector.metadata.AppID,
+			LastHeartbeatUnixNano: detector.lastHeartbeat.UnixNano(),
+			Window:                detector.Intervals(),
+			TotalSamples:          uint64(detector.Samples()),
+			State:                 int32(detector.state),
+			LastPhi:               detector.lastPhi,
+			Resumed:               detector.resumed,
+			ServeAddr:             serveAddr,
+		})
+	}
+
+	sort.Slice(snapshot.Clients, func(i, j int) bool {
+		return snapshot.Clients[i].ClientAddr < snapshot.Clients[j].ClientAddr
+	})
+	return snapshot
+}
+
+// Restore - recreate the detectors in a snapshot from Snapshot, returns the number of clients
+// restored. Clients already on the node (e.g. heartbeats that arrived before the restore) are
+// fresher than the snapshot && are kept as-is.
+//
+// The node saw no heartbeats between the snapshot && the restore, so the gap is not held against
+// the clients - each client's last heartbeat is moved forward by the snapshot's age, i.e. phi
+// resumes where it was when the snapshot was taken. The first heartbeat from a restored client
+// only re-anchors its last heartbeat rather than adding an interval that spans the node's
+// downtime. Snapshots older than MaxAge are rejected outright w. ErrSnapshotTooOld
+func (n *Node) Restore(data []byte, opts *RestoreOptions) (int, error) {
+
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+
+	var snapshot failproto.NodeSnapshot
+	if err := proto.Unmarshal(data, &snapshot); err != nil {
+		return 0, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	if snapshot.Version == 0 || snapshot.Version > SnapshotVersion {
+		return 0, fmt.Errorf("%w: %d", ErrSnapshotVersion, snapshot.Version)
+	}
+
+	restored, err := n.restore(&snapshot, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	// restored detectors were never written to the WAL, checkpoint so they survive a crash
+	if n.persist != nil {
+		if err := n.Checkpoint(); err != nil {
+			return restored, err
+		}
+	}
+	return restored, nil
+}
+
+// restore - add the snapshot's clients to the node, see: Restore
+func (n *Node) restore(snapshot *failproto.NodeSnapshot, opts *RestoreOptions) (int, error) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var (
+		now    time.Time     = n.clock.Now()
+		age    time.Duration = now.Sub(time.Unix(0, snapshot.TakenAtUnixNano))
+		maxAge time.Duration = opts.MaxAge
+	)
+	if maxAge == 0 {
+		maxAge = DefaultSnapshotMaxAge
+	}
+	if maxAge > 0 && age > maxAge {
+		return 0, fmt.Errorf("%w: taken %s ago, max %s", ErrSnapshotTooOld, age, maxAge)
+	}
+	if age < 0 {
+		age = 0 // clock skew between the writer && this node
+	}
+
+	var restored int
+	for _, client := range snapshot.Clients {
+		if _, ok := n.RecentClients[client.ClientAddr]; ok {
+			continue
+		}
+
+		detector := n.restoreDetector(client, age)
+		detector.resumed = true
+		n.RecentClients[client.ClientAddr] = detector
+		n.metrics.track(client.ClientAddr, client.ClientAppID)
+		restored++
+	}
+
+	n.logger.Info("restored clients from snapshot",
+		"server_app_id", n.metadata.AppID,
+		"server_addr", n.metadata.HostAddress,
+		"restored", restored,
+		"snapshot_clients", len(snapshot.Clients),
+		"snapshot_age", age.String(),
+	)
+	return restored, nil
+}
+
+// restoreDetector - detector from a client's snapshot w. its last heartbeat moved forward by age.
+// The window is replayed into a fresh detector sized by the node's options, so a node restored
+// w. a smaller window keeps only the most recent intervals
+func (n *Node) restoreDetector(client *failproto.ClientSnapshot, age time.Duration) *PhiAccrualDetector {
+
+	hostAddress := client.ClientAddr
+	if client.ServeAddr != "" {
+		hostAddress = client.ServeAddr
+	}
+	detector := NewPhiAccrualDetector(
+		time.Unix(0, client.LastHeartbeatUnixNano).Add(age),
+		n.opts,
+		&NodeMetadata{HostAddress: hostAddress, AppID: client.ClientAppID},
+	)
+
+	window := client.Window
+	if len(window) > len(detector.window) {
+		window = window[len(window)-len(detector.window):]
+	}
+	for _, interval := range window {
+		detector.addInterval(interval)
+	}
+
+	// samples that expired from the snapshot's window only count once this window is full too,
+	// min(window size, samples) must stay the number of intervals actually in the window
+	if len(window) == len(detector.window) && int(client.TotalSamples) > len(window) {
+		detector.stats.nTotalSamples = int(client.TotalSamples)
+	}
+
+	// a client in the snapshot was still in the node's table, anything else is unknown
+	detector.state = StateUnknown
+	for _, state := range tableStates {
+		if ClientState(client.State) == state {
+			detector.state = state
+		}
+	}
+	detector.lastPhi = client.LastPhi
+	detector.resumed = client.Resumed
+	return detector
+}
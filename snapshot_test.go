@@ -0,0 +1,145 @@
+package failure
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// snapshotTestNode - node w. a healthy worker advertising the address it serves on && a
+// suspected one, snapshotted at the returned clock
+func snapshotTestNode(t *testing.T) (*Node, *testClock, []byte) {
+
+	n, clock := newTestNode(&NodeOptions{SuspicionThreshold: 4, PurgeGracePeriod: time.Hour})
+	for _, interval := range []time.Duration{0, 900, 1100, 1000, 950} {
+		beat(n, clock, "10.0.0.1:40000", interval*time.Millisecond)
+		beat(n, clock, "10.0.0.2:40000", 0)
+	}
+	clock.Advance(3 * time.Second)
+	n.ReceiveHeartbeat(context.Background(), "10.0.0.1:40000", &failproto.Beat{ClientID: "worker", Addr: "10.0.0.1:8080"})
+	n.PurgeInactiveClients(context.Background(), clock.Now())
+	require.Equal(t, StateSuspected, n.RecentClients["10.0.0.2:40000"].State())
+
+	data, err := n.Snapshot()
+	require.NoError(t, err)
+	return n, clock, data
+}
+
+func TestSnapshotRestore(t *testing.T) {
+
+	src, srcClock, data := snapshotTestNode(t)
+
+	// restored a minute later, phi picks up where it was when the snapshot was taken
+	dst, dstClock := newTestNode(&NodeOptions{SuspicionThreshold: 4, PurgeGracePeriod: time.Hour})
+	dstClock.now = srcClock.Now().Add(time.Minute)
+
+	restored, err := dst.Restore(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, restored)
+
+	// balancers can dial restored clients before their next heartbeat
+	status, _ := dst.Client("10.0.0.1:40000")
+	assert.Equal(t, "10.0.0.1:8080", status.Addr)
+
+	want, got := src.Clients(), dst.Clients()
+	require.Len(t, got, 2)
+	for i := range want {
+		assert.Equal(t, want[i].ClientID, got[i].ClientID)
+		assert.Equal(t, want[i].AppID, got[i].AppID)
+		assert.Equal(t, want[i].Addr, got[i].Addr)
+		assert.Equal(t, want[i].State, got[i].State)
+		assert.Equal(t, want[i].Samples, got[i].Samples)
+		assert.InDelta(t, want[i].Phi, got[i].Phi, 1e-9)
+		assert.InDelta(t, want[i].Mean, got[i].Mean, 1e-9)
+		assert.InDelta(t, want[i].StdDev, got[i].StdDev, 1e-9)
+		assert.Equal(t, want[i].LastHeartbeat.Add(time.Minute), got[i].LastHeartbeat)
+
+		wantWindow, _ := src.ClientIntervals(want[i].ClientID)
+		gotWindow, _ := dst.ClientIntervals(got[i].ClientID)
+		assert.Equal(t, wantWindow, gotWindow)
+	}
+}
+
+func TestRestoredClientResumes(t *testing.T) {
+
+	_, srcClock, data := snapshotTestNode(t)
+	dst, dstClock := newTestNode(&NodeOptions{SuspicionThreshold: 4, PurgeGracePeriod: time.Hour})
+	dstClock.now = srcClock.Now().Add(time.Minute)
+	_, err := dst.Restore(data, nil)
+	require.NoError(t, err)
+
+	// the first heartbeat re-anchors w/o an interval spanning the downtime, && clears suspicion
+	before, _ := dst.ClientIntervals("10.0.0.2:40000")
+	beat(dst, dstClock, "10.0.0.2:40000", 5*time.Second)
+	after, _ := dst.ClientIntervals("10.0.0.2:40000")
+	assert.Equal(t, before, after)
+
+	status, _ := dst.Client("10.0.0.2:40000")
+	assert.Equal(t, StateHealthy, status.State)
+	assert.Equal(t, dstClock.Now(), status.LastHeartbeat)
+
+	// ...after which intervals are added as usual
+	beat(dst, dstClock, "10.0.0.2:40000", time.Second)
+	after, _ = dst.ClientIntervals("10.0.0.2:40000")
+	assert.Equal(t, 1000.0, after[len(after)-1])
+}
+
+func TestRestoreKeepsLiveClients(t *testing.T) {
+
+	_, srcClock, data := snapshotTestNode(t)
+	dst, dstClock := newTestNode(&NodeOptions{})
+	dstClock.now = srcClock.Now()
+	beat(dst, dstClock, "10.0.0.1:40000", 0)
+
+	restored, err := dst.Restore(data, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored)
+
+	status, _ := dst.Client("10.0.0.1:40000")
+	assert.Equal(t, 0, status.Samples)
+}
+
+func TestRestoreSmallerWindow(t *testing.T) {
+
+	_, srcClock, data := snapshotTestNode(t)
+	dst, dstClock := newTestNode(&NodeOptions{EstimationWindowSize: 2})
+	dstClock.now = srcClock.Now()
+	_, err := dst.Restore(data, nil)
+	require.NoError(t, err)
+
+	window, _ := dst.ClientIntervals("10.0.0.1:40000")
+	assert.Equal(t, []float64{950, 3000}, window)
+	status, _ := dst.Client("10.0.0.1:40000")
+	assert.Equal(t, 5, status.Samples)
+}
+
+func TestRestoreRejects(t *testing.T) {
+
+	_, srcClock, data := snapshotTestNode(t)
+
+	dst, dstClock := newTestNode(&NodeOptions{})
+	dstClock.now = srcClock.Now().Add(DefaultSnapshotMaxAge + time.Second)
+	_, err := dst.Restore(data, nil)
+	assert.ErrorIs(t, err, ErrSnapshotTooOld)
+	assert.Empty(t, dst.Clients())
+
+	restored, err := dst.Restore(data, &RestoreOptions{MaxAge: -1})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, restored)
+
+	var snapshot failproto.NodeSnapshot
+	require.NoError(t, proto.Unmarshal(data, &snapshot))
+	snapshot.Version = SnapshotVersion + 1
+	future, _ := proto.Marshal(&snapshot)
+	_, err = dst.Restore(future, nil)
+	assert.ErrorIs(t, err, ErrSnapshotVersion)
+
+	_, err = dst.Restore([]byte("not a snapshot"), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package failure
+
+import (
+	"fmt"
+)
+
+// ClientState - node's current view of a client
+type ClientState int
+
+const (
+	// StateUnknown - too few intervals observed to calculate phi
+	StateUnknown ClientState = iota
+
+	// StateHealthy - heartbeats arriving, phi below the suspicion threshold
+	StateHealthy
+
+	// StateSuspected - phi at or above the suspicion threshold on the last reap
+	StateSuspected
+
+	// StateRemoved - client purged from the node after the grace period
+	StateRemoved
+)
+
+// TransitionReason - why a client changed state, tells a clean leave apart from a failure
+type TransitionReason int
+
+const (
+	// ReasonDetected - the client's heartbeats && phi, i.e. the node's own judgement
+	ReasonDetected TransitionReason = iota
+
+	// ReasonStreamBroken - the client's heartbeat stream failed
+	ReasonStreamBroken
+
+	// ReasonPurged - removed after no heartbeat in the grace period w. infinite phi
+	ReasonPurged
+
+	// ReasonLeft - removed on the client's leave, a clean shutdown rather than a failure
+	ReasonLeft
+)
+
+// String -
+func (r TransitionReason) String() string {
+	switch r {
+	case ReasonDetected:
+		return "detected"
+	case ReasonStreamBroken:
+		return "stream_broken"
+	case ReasonPurged:
+		return "purged"
+	case ReasonLeft:
+		return "left"
+	}
+	return "invalid"
+}
+
+// DefaultSuspicionThreshold - phi above which a client is marked suspected when
+// NodeOptions.SuspicionThreshold is unset
+const DefaultSuspicionThreshold float64 = 8.0
+
+// minPhiSamples - intervals required before phi is meaningful (i.e. non-zero variance)
+const minPhiSamples int = 2
+
+// String -
+func (s ClientState) String() string {
+	switch s {
+	case StateUnknown:
+		return "unknown"
+	case StateHealthy:
+		return "healthy"
+	case StateSuspected:
+		return "suspected"
+	case StateRemoved:
+		return "removed"
+	}
+	return "invalid"
+}
+
+// ParseClientState - inverse of ClientState.String
+func ParseClientState(s string) (ClientState, error) {
+	for _, state := range []ClientState{StateUnknown, StateHealthy, StateSuspected, StateRemoved} {
+		if state.String() == s {
+			return state, nil
+		}
+	}
+	return StateUnknown, fmt.Errorf("unknown client state %q", s)
+}
@@ -13,14 +13,34 @@ type IntervalStatistics struct {
 	windowSize    int
 }
 
+// moments - mean and variance of the intervals (ms) in the window, NaN before the first sample
+func (s *IntervalStatistics) moments() (float64, float64) {
+	var (
+		nSamp float64 = math.Min(float64(s.windowSize), float64(s.nTotalSamples))
+		rAvg  float64 = (s.rSum / nSamp)
+		rVar  float64 = (s.rSumSquares / nSamp) - math.Pow(rAvg, 2)
+	)
+	return rAvg, rVar
+}
+
+// Mean - mean interval (ms) over the window
+func (s *IntervalStatistics) Mean() float64 {
+	rAvg, _ := s.moments()
+	return rAvg
+}
+
+// StdDev - standard deviation of the intervals (ms) over the window
+func (s *IntervalStatistics) StdDev() float64 {
+	_, rVar := s.moments()
+	return math.Sqrt(math.Max(rVar, 0))
+}
+
 // Phi - calculate phi (suspicion level) from IntervalStatistics
 func (s *IntervalStatistics) Phi(lastT time.Time, currentT time.Time) float64 {
 
 	var (
-		nSamp     float64 = math.Min(float64(s.windowSize), float64(s.nTotalSamples))
-		rAvg      float64 = (s.rSum / nSamp)
-		rVar      float64 = (s.rSumSquares / nSamp) - math.Pow(rAvg, 2)
-		timeDelta float64 = float64(currentT.Sub(lastT) / time.Millisecond)
+		rAvg, rVar         = s.moments()
+		timeDelta  float64 = float64(currentT.Sub(lastT) / time.Millisecond)
 	)
 
 	// use the def'n straight from the book -> https://en.wikipedia.org/wiki/Normal_distribution
@@ -0,0 +1,69 @@
+package failure
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// intervalStats - IntervalStatistics over the given intervals (ms), assumes they fit the window
+func intervalStats(windowSize int, intervals ...float64) *IntervalStatistics {
+	s := &IntervalStatistics{windowSize: windowSize}
+	for _, v := range intervals {
+		s.rSum += v
+		s.rSumSquares += v * v
+		s.nTotalSamples++
+	}
+	return s
+}
+
+func TestPhi(t *testing.T) {
+
+	var (
+		s     *IntervalStatistics = intervalStats(10, 900, 1100, 900, 1100) // mean 1000ms, stddev 100ms
+		lastT time.Time           = time.Unix(0, 0)
+	)
+
+	// at the mean, F = 0.5 -> phi = log10(2)
+	assert.InDelta(t, math.Log10(2), s.Phi(lastT, lastT.Add(1000*time.Millisecond)), 1e-9)
+
+	// one stddev above the mean, F ~ 0.8413
+	assert.InDelta(t, -math.Log10(1-0.841344746), s.Phi(lastT, lastT.Add(1100*time.Millisecond)), 1e-6)
+
+	// phi grows w. time since the last heartbeat...
+	assert.Less(t, s.Phi(lastT, lastT.Add(500*time.Millisecond)), s.Phi(lastT, lastT.Add(1200*time.Millisecond)))
+
+	// ...until F rounds to 1
+	assert.True(t, math.IsInf(s.Phi(lastT, lastT.Add(time.Hour)), 1))
+}
+
+func TestPhiNoSamples(t *testing.T) {
+	s := intervalStats(10)
+	assert.True(t, math.IsNaN(s.Phi(time.Unix(0, 0), time.Unix(1, 0))))
+}
+
+func BenchmarkPhi(b *testing.B) {
+	for _, windowSize := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("window=%d", windowSize), func(b *testing.B) {
+			// a full window of alternating 900ms / 1100ms intervals
+			intervals := make([]float64, windowSize)
+			for i := range intervals {
+				intervals[i] = float64(900 + 200*(i%2))
+			}
+
+			var (
+				s     *IntervalStatistics = intervalStats(windowSize, intervals...)
+				lastT time.Time           = time.Unix(0, 0)
+				now   time.Time           = lastT.Add(1200 * time.Millisecond)
+			)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Phi(lastT, now)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package failure
+
+import (
+	"sort"
+	"time"
+)
+
+// ClientStatus - point-in-time view of a single client, safe to hold onto after the node moves on
+type ClientStatus struct {
+	ClientID      string
+	AppID         string
+	Addr          string // address the client serves on if it advertises one (see: PublisherOptions.Addr), else ClientID
+	State         ClientState
+	Phi           float64
+	LastHeartbeat time.Time
+	Samples       int
+	Mean          float64 // mean interval (ms) over the window
+	StdDev        float64 // interval standard deviation (ms) over the window
+	Latency       float64 // mean response latency (ms) over the window, only for servers watched w. FailureDetectorClientInterceptor
+}
+
+// status - current view of a client, caller must hold n.mu
+func (n *Node) status(clientID string, detector *PhiAccrualDetector, t time.Time) ClientStatus {
+	return ClientStatus{
+		ClientID:      clientID,
+		AppID:         detector.metadata.AppID,
+		Addr:          detector.metadata.HostAddress,
+		State:         detector.state,
+		Phi:           detector.Suspicion(t),
+		LastHeartbeat: detector.lastHeartbeat,
+		Samples:       detector.Samples(),
+		Mean:          detector.stats.Mean(),
+		StdDev:        detector.stats.StdDev(),
+		Latency:       detector.latency.mean(),
+	}
+}
+
+// Clients - status of every client known to the node, phi calculated at the node's current time
+// and sorted by client ID
+func (n *Node) Clients() []ClientStatus {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	var (
+		t        time.Time      = n.clock.Now()
+		statuses []ClientStatus = make([]ClientStatus, 0, len(n.RecentClients))
+	)
+
+	for clientID, detector := range n.RecentClients {
+		statuses = append(statuses, n.status(clientID, detector, t))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].ClientID < statuses[j].ClientID
+	})
+	return statuses
+}
+
+// Client - status of a single client, false if the node has no record of it
+func (n *Node) Client(clientID string) (ClientStatus, bool) {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	detector, ok := n.RecentClients[clientID]
+	if !ok {
+		return ClientStatus{}, false
+	}
+	return n.status(clientID, detector, n.clock.Now()), true
+}
+
+// ClientIntervals - heartbeat intervals (ms) in a client's estimation window, oldest first;
+// false if the node has no record of the client
+func (n *Node) ClientIntervals(clientID string) ([]float64, bool) {
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	detector, ok := n.RecentClients[clientID]
+	if !ok {
+		return nil, false
+	}
+	return detector.Intervals(), true
+}
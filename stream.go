@@ -0,0 +1,141 @@
+package failure
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// errStreamEnded - stream handler returned w/o error before the client closed its side
+var errStreamEnded = errors.New("stream ended before the client closed it")
+
+// HeartbeatService - failproto.HeartbeatServer that acks every Beat on the stream, heartbeats
+// themselves are processed by FailureDetectorStreamInterceptor as they're received
+type HeartbeatService struct {
+	failproto.UnimplementedHeartbeatServer
+}
+
+// Stream - implements failproto.HeartbeatServer
+func (HeartbeatService) Stream(stream failproto.Heartbeat_StreamServer) error {
+	for {
+		beat, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&failproto.BeatAck{Seq: beat.Seq}); err != nil {
+			return err
+		}
+	}
+}
+
+// FailureDetectorStreamInterceptor - Acts as a StreamServerInterceptor, updates detector node's
+// heartbeat statistics for every failproto.Beat received on a stream, or w. NodeOptions.Implicit
+// for opening any other stream && each message on it from a recognized client. A client whose stream
+// breaks (i.e. ends w. anything but the client closing its side) is suspected at once rather
+// than once phi catches up, the stream's connection is gone && no more heartbeats will follow.
+// A stream the node ended itself, by rejecting a beat over the rate limit or one that failed
+// authentication, says nothing abt. the client && isn't a break
+func (n *Node) FailureDetectorStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		p, ok := peer.FromContext(ss.Context())
+		if !ok {
+			return handler(srv, ss)
+		}
+
+		n.implicitHeartbeat(ss.Context(), info.FullMethod)
+		stream := &heartbeatStream{ServerStream: ss, node: n, clientID: p.Addr.String(), fullMethod: info.FullMethod}
+		err := handler(srv, stream)
+		if stream.beats > 0 && !stream.closed && !stream.rejected {
+			brokenErr := err
+			if brokenErr == nil {
+				brokenErr = errStreamEnded
+			}
+			n.dispatchBreak(stream.clientID, brokenErr)
+		}
+		return err
+	}
+}
+
+// heartbeatStream - grpc.ServerStream that hands every Beat received to the node
+type heartbeatStream struct {
+	grpc.ServerStream
+	node       *Node
+	clientID   string
+	fullMethod string
+	beats      int  // Beats received on the stream
+	closed     bool // client closed its side of the stream, i.e. ended it cleanly
+	rejected   bool // node rejected a Beat (rate limit or auth), ending the stream itself
+}
+
+// RecvMsg - implements grpc.ServerStream
+func (s *heartbeatStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == io.EOF {
+		s.closed = true
+	}
+	if err != nil {
+		return err
+	}
+	if msg, ok := m.(*failproto.Beat); ok {
+		process, err := s.node.limit(s.clientID, msg)
+		if err != nil {
+			s.rejected = true
+			return err
+		}
+		if !process {
+			return nil
+		}
+		beat, err := s.node.authenticate(s.Context(), s.clientID, msg)
+		if err != nil {
+			s.rejected = true
+			return err
+		}
+		s.beats++
+		s.node.dispatch(s.Context(), s.clientID, beat)
+		return nil
+	}
+	s.node.implicitHeartbeat(s.Context(), s.fullMethod)
+	return nil
+}
+
+// dispatchBreak - suspect a client whose stream broke, queued behind its pooled heartbeats so
+// none of them clear the suspicion afterwards
+func (n *Node) dispatchBreak(clientID string, err error) {
+
+	var brokenAt time.Time = n.clock.Now()
+	if n.pool == nil {
+		n.streamBroken(clientID, err, brokenAt)
+		return
+	}
+	n.pool.submitBreak(heartbeatTask{clientID: clientID, arrivalTime: brokenAt, err: err})
+}
+
+// streamBroken - suspect a client whose heartbeat stream broke
+func (n *Node) streamBroken(clientID string, err error, t time.Time) {
+	n.suspect(clientID, "heartbeat stream from client broke, suspecting", err, t)
+}
+
+// suspect - suspect a client on a strong failure signal at t w/o waiting on phi, if it's still
+// in the table && hasn't been heard from since (e.g. a break processed after the heartbeats of
+// the client's next stream)
+func (n *Node) suspect(clientID string, msg string, err error, t time.Time) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	detector, ok := n.RecentClients[clientID]
+	if !ok || detector.lastHeartbeat.After(t) {
+		return
+	}
+
+	n.logger.Info(msg, n.clientLogArgs(clientID, detector.metadata.AppID, "err", err)...)
+	n.transition(clientID, detector, StateSuspected, ReasonStreamBroken, t)
+}
@@ -0,0 +1,100 @@
+package failure
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// streamClientID - peer address of every client of a bufconn server
+const streamClientID string = "bufconn"
+
+// newStreamServer - in-memory grpc server serving the heartbeat stream through n's interceptor,
+// returns a client connected to it
+func newStreamServer(t *testing.T, n *Node) failproto.HeartbeatClient {
+
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer(grpc.StreamInterceptor(n.FailureDetectorStreamInterceptor()))
+	failproto.RegisterHeartbeatServer(srv, HeartbeatService{})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return failproto.NewHeartbeatClient(conn)
+}
+
+// streamBeats - send count beats on the stream, waiting for each ack
+func streamBeats(t *testing.T, stream failproto.Heartbeat_StreamClient, count int) {
+	for seq := uint64(1); seq <= uint64(count); seq++ {
+		require.NoError(t, stream.Send(&failproto.Beat{ClientID: "worker", Seq: seq}))
+		ack, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, seq, ack.Seq)
+	}
+}
+
+func TestStreamHeartbeats(t *testing.T) {
+
+	n, _ := newTestNode(&NodeOptions{})
+	stream, err := newStreamServer(t, n).Stream(context.Background())
+	require.NoError(t, err)
+	streamBeats(t, stream, 3)
+
+	status, ok := n.Client(streamClientID)
+	require.True(t, ok)
+	assert.Equal(t, "worker", status.AppID)
+	assert.Equal(t, 2, status.Samples)
+	assert.Equal(t, StateHealthy, status.State)
+
+	// closing the stream cleanly isn't a failure
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	require.Equal(t, io.EOF, err)
+
+	status, _ = n.Client(streamClientID)
+	assert.Equal(t, StateHealthy, status.State)
+}
+
+func TestStreamBreak(t *testing.T) {
+
+	for name, processing := range map[string]*ProcessingOptions{
+		"sync": nil,
+		"pool": {Mode: ProcessPool, Workers: 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+
+			n, _ := newTestNode(&NodeOptions{Processing: processing})
+			ctx, cancel := context.WithCancel(context.Background())
+			stream, err := newStreamServer(t, n).Stream(ctx)
+			require.NoError(t, err)
+			streamBeats(t, stream, 3)
+
+			// suspected as soon as the stream breaks, w/o waiting on phi
+			cancel()
+			require.Eventually(t, func() bool {
+				status, _ := n.Client(streamClientID)
+				return status.State == StateSuspected
+			}, 5*time.Second, 10*time.Millisecond)
+
+			// ...&& stays so once every heartbeat from the stream has been processed
+			require.NoError(t, n.Close())
+			status, _ := n.Client(streamClientID)
+			assert.Equal(t, StateSuspected, status.State)
+		})
+	}
+}
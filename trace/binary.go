@@ -0,0 +1,276 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Binary trace format
+//
+// A binary trace starts w. a 5 byte header, the magic `PHTR` followed by a format version (1).
+// Each record that follows is framed as
+//
+//	uvarint   payload length
+//	payload:
+//	  byte      kind (1 = arrival, 2 = transition, 3 = crash)
+//	  varint    time, ns since the previous record in the file (unix ns for the first record)
+//	  uvarint   seq
+//	  string    client id
+//	  string    app id
+//	  string    from state (transitions only)
+//	  string    to state (transitions only)
+//	  string    advertised address (arrivals only, omitted when empty)
+//
+// where a string is a uvarint length followed by that many bytes. Times are delta encoded, so a
+// binary trace can only be read from the start of the file. Trailing fields absent from a
+// payload (e.g. written before they were added) read as empty.
+
+var binaryMagic = []byte("PHTR")
+
+const binaryVersion byte = 1
+
+// maxBinaryRecordSize - upper bound on a record payload, guards against corrupt length prefixes
+const maxBinaryRecordSize uint64 = 1 << 16
+
+// errUnknownKind - record kind has no binary encoding
+var errUnknownKind = errors.New("trace: unknown record kind")
+
+var binaryKinds = map[Kind]byte{
+	KindArrival:    1,
+	KindTransition: 2,
+	KindCrash:      3,
+}
+
+// BinaryWriter - writes records to a binary trace, not safe for concurrent use
+type BinaryWriter struct {
+	w             io.Writer
+	buf           []byte
+	last          int64
+	headerWritten bool
+}
+
+// NewBinaryWriter - new writer for a binary trace, the header is written w. the first record
+func NewBinaryWriter(w io.Writer) *BinaryWriter {
+	return &BinaryWriter{w: w}
+}
+
+// Record - append a record, each record is a single call to Write
+func (bw *BinaryWriter) Record(rec *Record) error {
+
+	kind, ok := binaryKinds[rec.Kind]
+	if !ok {
+		return fmt.Errorf("%w: %q", errUnknownKind, rec.Kind)
+	}
+
+	var (
+		ts      int64  = rec.Time.UnixNano()
+		payload []byte = make([]byte, 0, 64)
+	)
+
+	payload = append(payload, kind)
+	payload = appendVarint(payload, ts-bw.last)
+	payload = appendUvarint(payload, rec.Seq)
+	payload = appendString(payload, rec.ClientID)
+	payload = appendString(payload, rec.AppID)
+	if rec.Kind == KindTransition {
+		payload = appendString(payload, rec.From)
+		payload = appendString(payload, rec.To)
+	}
+	if rec.Kind == KindArrival && rec.Addr != "" {
+		payload = appendString(payload, rec.Addr)
+	}
+
+	bw.buf = bw.buf[:0]
+	if !bw.headerWritten {
+		bw.buf = append(append(bw.buf, binaryMagic...), binaryVersion)
+	}
+	bw.buf = appendUvarint(bw.buf, uint64(len(payload)))
+	bw.buf = append(bw.buf, payload...)
+
+	if _, err := bw.w.Write(bw.buf); err != nil {
+		return err
+	}
+	bw.headerWritten = true
+	bw.last = ts
+	return nil
+}
+
+// BinaryReader - reads records from a binary trace
+type BinaryReader struct {
+	r          *bufio.Reader
+	last       int64
+	headerRead bool
+	payload    []byte
+}
+
+// NewBinaryReader - new reader over a binary trace
+func NewBinaryReader(r io.Reader) *BinaryReader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &BinaryReader{r: br}
+}
+
+// Read - returns the next record; a record cut short by the end of the file (e.g. the writer
+// crashed mid-write) returns io.ErrUnexpectedEOF
+func (br *BinaryReader) Read() (*Record, error) {
+
+	if !br.headerRead {
+		header := make([]byte, len(binaryMagic)+1)
+		if _, err := io.ReadFull(br.r, header); err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("trace: reading header: %w", err)
+		}
+		if string(header[:len(binaryMagic)]) != string(binaryMagic) {
+			return nil, errors.New("trace: not a binary trace")
+		}
+		if header[len(binaryMagic)] != binaryVersion {
+			return nil, fmt.Errorf("trace: unsupported binary trace version %d", header[len(binaryMagic)])
+		}
+		br.headerRead = true
+	}
+
+	size, err := binary.ReadUvarint(br.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	if size > maxBinaryRecordSize {
+		return nil, fmt.Errorf("trace: record of %d bytes exceeds max record size", size)
+	}
+
+	if cap(br.payload) < int(size) {
+		br.payload = make([]byte, size)
+	}
+	br.payload = br.payload[:size]
+	if _, err := io.ReadFull(br.r, br.payload); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return br.decode(br.payload)
+}
+
+// decode - decode a single record payload
+func (br *BinaryReader) decode(payload []byte) (*Record, error) {
+
+	var (
+		rec Record
+		p   *payloadReader = &payloadReader{b: payload}
+	)
+
+	switch k := p.byte(); k {
+	case binaryKinds[KindArrival]:
+		rec.Kind = KindArrival
+	case binaryKinds[KindTransition]:
+		rec.Kind = KindTransition
+	case binaryKinds[KindCrash]:
+		rec.Kind = KindCrash
+	default:
+		return nil, fmt.Errorf("%w: %d", errUnknownKind, k)
+	}
+
+	br.last += p.varint()
+	rec.Time = time.Unix(0, br.last).UTC()
+	rec.Seq = p.uvarint()
+	rec.ClientID = p.string()
+	rec.AppID = p.string()
+	if rec.Kind == KindTransition {
+		rec.From = p.string()
+		rec.To = p.string()
+	}
+	if rec.Kind == KindArrival && p.remaining() {
+		rec.Addr = p.string()
+	}
+
+	if p.err != nil {
+		return nil, fmt.Errorf("trace: malformed record: %w", p.err)
+	}
+	return &rec, nil
+}
+
+// appendVarint -
+func appendVarint(b []byte, v int64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	return append(b, scratch[:binary.PutVarint(scratch[:], v)]...)
+}
+
+// appendUvarint -
+func appendUvarint(b []byte, v uint64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	return append(b, scratch[:binary.PutUvarint(scratch[:], v)]...)
+}
+
+// appendString - append a length prefixed string
+func appendString(b []byte, s string) []byte {
+	return append(appendUvarint(b, uint64(len(s))), s...)
+}
+
+// payloadReader - cursor over a record payload, the first decoding error sticks
+type payloadReader struct {
+	b   []byte
+	err error
+}
+
+// remaining - payload has bytes left to decode
+func (p *payloadReader) remaining() bool {
+	return p.err == nil && len(p.b) > 0
+}
+
+func (p *payloadReader) byte() byte {
+	if p.err != nil || len(p.b) == 0 {
+		p.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := p.b[0]
+	p.b = p.b[1:]
+	return v
+}
+
+func (p *payloadReader) varint() int64 {
+	if p.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(p.b)
+	if n <= 0 {
+		p.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	p.b = p.b[n:]
+	return v
+}
+
+func (p *payloadReader) uvarint() uint64 {
+	if p.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(p.b)
+	if n <= 0 {
+		p.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	p.b = p.b[n:]
+	return v
+}
+
+func (p *payloadReader) string() string {
+	size := p.uvarint()
+	if p.err != nil {
+		return ""
+	}
+	if uint64(len(p.b)) < size {
+		p.err = io.ErrUnexpectedEOF
+		return ""
+	}
+	s := string(p.b[:size])
+	p.b = p.b[size:]
+	return s
+}
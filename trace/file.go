@@ -0,0 +1,170 @@
+package trace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Format - on-disk encoding of a trace
+type Format int
+
+const (
+	// FormatJSON - one JSON record per line
+	FormatJSON Format = iota
+
+	// FormatBinary - length prefixed binary records, see: binary.go
+	FormatBinary
+)
+
+// extension - file extension for traces in this format
+func (f Format) extension() string {
+	if f == FormatBinary {
+		return ".phtr"
+	}
+	return ".jsonl"
+}
+
+// FileWriterOptions - location, format and rotation policy for trace files
+type FileWriterOptions struct {
+	Dir      string
+	Prefix   string        // file names are <prefix>-<unix ns>.<ext>, defaults to `heartbeats`
+	Format   Format        //
+	MaxBytes int64         // rotate once the current file exceeds this size, 0 disables
+	MaxAge   time.Duration // rotate once the current file is this old, 0 disables
+	MaxFiles int           // remove the oldest files once more than this many exist, 0 keeps all
+}
+
+// FileWriter - append-only trace file w. size and age based rotation, safe for concurrent use
+type FileWriter struct {
+	opts    FileWriterOptions
+	mu      sync.Mutex
+	file    *os.File
+	rec     Recorder
+	size    int64
+	created time.Time
+}
+
+// countingWriter - tracks the number of bytes written to the current file
+type countingWriter struct {
+	fw *FileWriter
+}
+
+// Write -
+func (cw countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.fw.file.Write(b)
+	cw.fw.size += int64(n)
+	return n, err
+}
+
+// NewFileWriter - open a new trace file in opts.Dir, the directory is created if missing
+func NewFileWriter(opts FileWriterOptions) (*FileWriter, error) {
+
+	if opts.Prefix == "" {
+		opts.Prefix = "heartbeats"
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	fw := &FileWriter{opts: opts}
+	if err := fw.rotate(time.Now()); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+// Record - append a record to the current file, rotating first if the file is due
+func (fw *FileWriter) Record(rec *Record) error {
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.file == nil {
+		return os.ErrClosed
+	}
+
+	now := time.Now()
+	if (fw.opts.MaxBytes > 0 && fw.size >= fw.opts.MaxBytes) || (fw.opts.MaxAge > 0 && now.Sub(fw.created) >= fw.opts.MaxAge) {
+		if err := fw.rotate(now); err != nil {
+			return err
+		}
+	}
+	return fw.rec.Record(rec)
+}
+
+// Close - close the current file, further records are rejected
+func (fw *FileWriter) Close() error {
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.file == nil {
+		return nil
+	}
+	err := fw.file.Close()
+	fw.file = nil
+	return err
+}
+
+// Files - trace files written by this writer's prefix & format in opts.Dir, oldest first
+func (fw *FileWriter) Files() ([]string, error) {
+	return listFiles(fw.opts.Dir, fw.opts.Prefix, fw.opts.Format)
+}
+
+// rotate - close the current file (if any), open a new one and drop files over MaxFiles
+func (fw *FileWriter) rotate(now time.Time) error {
+
+	if fw.file != nil {
+		if err := fw.file.Close(); err != nil {
+			return err
+		}
+	}
+
+	name := filepath.Join(fw.opts.Dir, fmt.Sprintf("%s-%d%s", fw.opts.Prefix, now.UnixNano(), fw.opts.Format.extension()))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		fw.file = nil
+		return err
+	}
+
+	fw.file, fw.size, fw.created = f, 0, now
+	if fw.opts.Format == FormatBinary {
+		fw.rec = NewBinaryWriter(countingWriter{fw: fw})
+	} else {
+		fw.rec = NewJSONWriter(countingWriter{fw: fw})
+	}
+
+	if fw.opts.MaxFiles <= 0 {
+		return nil
+	}
+
+	files, err := fw.Files()
+	if err != nil {
+		return err
+	}
+	for len(files) > fw.opts.MaxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// listFiles - trace files in dir w. the given prefix & format, oldest first
+func listFiles(dir string, prefix string, format Format) ([]string, error) {
+
+	files, err := filepath.Glob(filepath.Join(dir, prefix+"-*"+format.extension()))
+	if err != nil {
+		return nil, err
+	}
+
+	// names embed the creation time in unix ns, all the same width until 2286
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,144 @@
+// Package trace - record formats for heartbeat arrival traces, used for offline evaluation of
+// failure detector configurations
+//
+// A JSONL trace holds one Record per line, e.g.
+//
+//	{"kind":"arrival","client_id":"10.0.0.7:41312","app_id":"worker","time":"2022-11-02T15:04:05.123Z","seq":1,"addr":"10.0.0.7:8080"}
+//	{"kind":"transition","client_id":"10.0.0.7:41312","app_id":"worker","time":"2022-11-02T15:04:30Z","from":"healthy","to":"suspected"}
+//	{"kind":"crash","client_id":"10.0.0.7:41312","app_id":"worker","time":"2022-11-02T15:09:00Z"}
+//
+// `arrival` records are heartbeats as seen by the receiving node, `transition` records are
+// changes in the node's view of a client. `crash` records are optional ground truth (e.g. from
+// a synthetic workload), marking the time a client stopped for good.
+//
+// The binary variant (see: binary.go) holds the same records in a more compact encoding.
+// NewReader detects the format of a trace from its first bytes.
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Kind - type of a trace record
+type Kind string
+
+const (
+	// KindArrival - a heartbeat arrived from the client
+	KindArrival Kind = "arrival"
+
+	// KindTransition - the node's view of the client changed
+	KindTransition Kind = "transition"
+
+	// KindCrash - the client crashed at this time, no further arrivals expected
+	KindCrash Kind = "crash"
+)
+
+// Record - single entry in a trace
+type Record struct {
+	Kind     Kind      `json:"kind"`
+	ClientID string    `json:"client_id"`
+	AppID    string    `json:"app_id,omitempty"`
+	Time     time.Time `json:"time"`
+	Seq      uint64    `json:"seq,omitempty"`
+	Addr     string    `json:"addr,omitempty"` // arrivals only, address the client advertised, if any
+	From     string    `json:"from,omitempty"` // transitions only
+	To       string    `json:"to,omitempty"`   // transitions only
+}
+
+// Reader - reads records from a trace
+type Reader interface {
+	// Read - returns the next record, or io.EOF at the end of the trace
+	Read() (*Record, error)
+}
+
+// Recorder - appends records to a trace
+type Recorder interface {
+	Record(rec *Record) error
+}
+
+// NewReader - reader over a JSONL or binary trace, format is detected from the file header
+func NewReader(r io.Reader) (Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(binaryMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if bytes.Equal(head, binaryMagic) {
+		return NewBinaryReader(br), nil
+	}
+	return NewJSONReader(br), nil
+}
+
+// JSONReader - reads records from a JSONL trace
+type JSONReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewJSONReader - new reader over a JSONL trace
+func NewJSONReader(r io.Reader) *JSONReader {
+	return &JSONReader{
+		scanner: bufio.NewScanner(r),
+	}
+}
+
+// Read - returns the next record, blank lines are skipped
+func (jr *JSONReader) Read() (*Record, error) {
+	for jr.scanner.Scan() {
+		jr.line++
+		if len(jr.scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(jr.scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("trace: line %d: %w", jr.line, err)
+		}
+		return &rec, nil
+	}
+
+	if err := jr.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// JSONWriter - writes records to a JSONL trace, not safe for concurrent use
+type JSONWriter struct {
+	w io.Writer
+}
+
+// NewJSONWriter - new writer for a JSONL trace
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	return &JSONWriter{w: w}
+}
+
+// Record - append a record as a single line, each record is a single call to Write
+func (jw *JSONWriter) Record(rec *Record) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = jw.w.Write(append(b, '\n'))
+	return err
+}
+
+// ReadAll - reads all remaining records from a trace
+func ReadAll(r Reader) ([]*Record, error) {
+	var records []*Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
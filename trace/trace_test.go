@@ -0,0 +1,187 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRecords - one record of each kind from a single client, w. && w/o an advertised address,
+// times are UTC as both readers return them
+func testRecords() []*Record {
+	start := time.Date(2022, 11, 2, 15, 4, 5, 123000000, time.UTC)
+	return []*Record{
+		{Kind: KindArrival, ClientID: "10.0.0.7:41312", AppID: "worker", Time: start, Seq: 1},
+		{Kind: KindArrival, ClientID: "10.0.0.7:41312", AppID: "worker", Time: start.Add(time.Second), Seq: 2, Addr: "10.0.0.7:8080"},
+		{Kind: KindTransition, ClientID: "10.0.0.7:41312", AppID: "worker", Time: start.Add(25 * time.Second), From: "healthy", To: "suspected"},
+		{Kind: KindCrash, ClientID: "10.0.0.7:41312", AppID: "worker", Time: start.Add(20 * time.Second)},
+	}
+}
+
+// writeAll - records through rec, fails the test on the first error
+func writeAll(t *testing.T, rec Recorder, records []*Record) {
+	for _, r := range records {
+		require.NoError(t, rec.Record(r))
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+
+	var buf bytes.Buffer
+	writeAll(t, NewJSONWriter(&buf), testRecords())
+
+	// blank lines are skipped
+	buf.WriteString("\n")
+	records, err := ReadAll(NewJSONReader(&buf))
+	require.NoError(t, err)
+	assert.Equal(t, testRecords(), records)
+
+	_, err = NewJSONReader(bytes.NewBufferString("{\"kind\":\n")).Read()
+	assert.ErrorContains(t, err, "line 1")
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+
+	var buf bytes.Buffer
+	writeAll(t, NewBinaryWriter(&buf), testRecords())
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("PHTR\x01")))
+
+	// times go backwards in the crash record, deltas are signed
+	records, err := ReadAll(NewBinaryReader(&buf))
+	require.NoError(t, err)
+	assert.Equal(t, testRecords(), records)
+
+	assert.ErrorIs(t, NewBinaryWriter(&buf).Record(&Record{Kind: "unknown"}), errUnknownKind)
+}
+
+func TestBinaryWithoutAddr(t *testing.T) {
+
+	// an arrival written before advertised addresses were recorded, i.e. ending at its app ID
+	payload := []byte{binaryKinds[KindArrival]}
+	payload = appendVarint(payload, time.Unix(1, 0).UnixNano())
+	payload = appendUvarint(payload, 7)
+	payload = appendString(payload, "10.0.0.7:41312")
+	payload = appendString(payload, "worker")
+
+	trace := appendUvarint(append(append([]byte{}, binaryMagic...), binaryVersion), uint64(len(payload)))
+	rec, err := NewBinaryReader(bytes.NewReader(append(trace, payload...))).Read()
+	require.NoError(t, err)
+	assert.Equal(t, &Record{Kind: KindArrival, ClientID: "10.0.0.7:41312", AppID: "worker", Time: time.Unix(1, 0).UTC(), Seq: 7}, rec)
+}
+
+func TestBinaryTruncated(t *testing.T) {
+
+	var buf bytes.Buffer
+	writeAll(t, NewBinaryWriter(&buf), testRecords()[:2])
+	full := buf.Len()
+
+	// cut short in the second record's payload, the first still reads
+	r := NewBinaryReader(bytes.NewReader(buf.Bytes()[:full-3]))
+	_, err := r.Read()
+	require.NoError(t, err)
+	_, err = r.Read()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// an empty file is an empty trace
+	_, err = NewBinaryReader(bytes.NewReader(nil)).Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestNewReader(t *testing.T) {
+
+	for name, newWriter := range map[string]func(io.Writer) Recorder{
+		"json":   func(w io.Writer) Recorder { return NewJSONWriter(w) },
+		"binary": func(w io.Writer) Recorder { return NewBinaryWriter(w) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeAll(t, newWriter(&buf), testRecords())
+
+			r, err := NewReader(&buf)
+			require.NoError(t, err)
+			records, err := ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, testRecords(), records)
+		})
+	}
+
+	r, err := NewReader(bytes.NewReader(nil))
+	require.NoError(t, err)
+	assert.IsType(t, &JSONReader{}, r)
+}
+
+// readFiles - every record in files, in order
+func readFiles(t *testing.T, files []string) []*Record {
+	var records []*Record
+	for _, name := range files {
+		f, err := os.Open(name)
+		require.NoError(t, err)
+		r, err := NewReader(f)
+		require.NoError(t, err)
+		rs, err := ReadAll(r)
+		require.NoError(t, err)
+		records = append(records, rs...)
+		f.Close()
+	}
+	return records
+}
+
+func TestFileWriterMaxBytes(t *testing.T) {
+
+	// a file rotates once it reaches MaxBytes, i.e. here after its first 2 records
+	var buf bytes.Buffer
+	writeAll(t, NewBinaryWriter(&buf), testRecords()[:2])
+
+	fw, err := NewFileWriter(FileWriterOptions{Dir: t.TempDir(), Format: FormatBinary, MaxBytes: int64(buf.Len())})
+	require.NoError(t, err)
+	writeAll(t, fw, testRecords())
+	require.NoError(t, fw.Close())
+
+	files, err := fw.Files()
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	// each file has its own header && time base
+	assert.Equal(t, testRecords(), readFiles(t, files))
+	assert.ErrorIs(t, fw.Record(testRecords()[0]), os.ErrClosed)
+}
+
+func TestFileWriterMaxAge(t *testing.T) {
+
+	fw, err := NewFileWriter(FileWriterOptions{Dir: t.TempDir(), MaxAge: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer fw.Close()
+
+	records := testRecords()
+	writeAll(t, fw, records[:2])
+	time.Sleep(20 * time.Millisecond)
+	writeAll(t, fw, records[2:])
+
+	files, err := fw.Files()
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, records[:2], readFiles(t, files[:1]))
+	assert.Equal(t, records[2:], readFiles(t, files[1:]))
+}
+
+func TestFileWriterMaxFiles(t *testing.T) {
+
+	// every record rotates, only the latest 2 files are kept
+	fw, err := NewFileWriter(FileWriterOptions{Dir: t.TempDir(), Prefix: "node", MaxBytes: 1, MaxFiles: 2})
+	require.NoError(t, err)
+	defer fw.Close()
+
+	records := testRecords()
+	writeAll(t, fw, records)
+
+	files, err := fw.Files()
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Contains(t, files[0], "node-")
+	assert.Equal(t, records[2:], readFiles(t, files))
+}
@@ -0,0 +1,216 @@
+package failure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// MaxUDPBeatSize - largest Beat datagram a node reads or a UDPPublisher sends, a signed beat
+// is ~100 bytes plus its app ID && address
+const MaxUDPBeatSize int = 1024
+
+// errMalformedBeat - datagram that isn't a Beat
+var errMalformedBeat = &authError{reason: "malformed", msg: "datagram is not a heartbeat"}
+
+// ServeUDP - read heartbeats from conn until it's closed, each datagram is a single
+// protobuf-encoded failproto.Beat. Beats go through the same rate limits, authentication &&
+// processing as the interceptors', w. the datagram's source address as the client ID. There's
+// no TLS over UDP, so under AuthMTLS every beat is rejected, use AuthHMAC instead (source
+// addresses are trivial to spoof). Returns nil once conn is closed
+func (n *Node) ServeUDP(conn net.PacketConn) error {
+
+	// one byte over the max, so a datagram that fills the buffer was truncated
+	buf := make([]byte, MaxUDPBeatSize+1)
+	for {
+		size, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		n.receiveDatagram(addr.String(), buf[:size])
+	}
+}
+
+// receiveDatagram - decode && process a single datagram from clientID. Nothing is sent back,
+// a rejected beat is only counted && logged
+func (n *Node) receiveDatagram(clientID string, datagram []byte) {
+
+	// pooled beats outlive the read, so each gets its own message
+	beatmsg := &failproto.Beat{}
+	if len(datagram) > MaxUDPBeatSize || proto.Unmarshal(datagram, beatmsg) != nil {
+		n.metrics.observeReject(errMalformedBeat.reason)
+		n.logger.Debug("rejected malformed heartbeat datagram",
+			n.clientLogArgs(clientID, "", "size", len(datagram))...,
+		)
+		return
+	}
+
+	if process, err := n.limit(clientID, beatmsg); !process || err != nil {
+		return
+	}
+	beat, err := n.authenticate(context.Background(), clientID, beatmsg)
+	if err != nil {
+		return
+	}
+	n.dispatch(context.Background(), clientID, beat)
+}
+
+// UDPPublisher - sends beats to one or more detector nodes as UDP datagrams (see: Node.ServeUDP),
+// far lighter than a Publisher's streams but w/o acks, a lost datagram is just a late beat to
+// the node. Takes PublisherOptions, MinBackoff, MaxBackoff && DialOptions don't apply
+type UDPPublisher struct {
+	opts    *PublisherOptions
+	logger  Logger
+	metrics *publisherMetrics
+	conn    *net.UDPConn
+	targets []*net.UDPAddr
+	seq     uint64 // only used by Run (one at a time, see: running), then Close
+	closing chan struct{}
+	closed  bool // guarded by mu
+	running bool // guarded by mu
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+}
+
+// NewUDPPublisher - new publisher w. a single socket for every target, so each node sees the
+// publisher at one address. Beats are only sent once Run is called
+func NewUDPPublisher(opts *PublisherOptions) (*UDPPublisher, error) {
+
+	if opts.AppID == "" {
+		return nil, errors.New("failure: publisher needs an AppID")
+	}
+	if len(opts.Targets) == 0 {
+		return nil, errors.New("failure: publisher needs at least one target")
+	}
+
+	var logger Logger = opts.Logger
+	if logger == nil {
+		logger = LogrusLogger(nil)
+	}
+
+	p := &UDPPublisher{
+		opts:    opts,
+		logger:  logger,
+		closing: make(chan struct{}),
+	}
+
+	var err error
+	if p.metrics, err = newPublisherMetrics(opts.Metrics); err != nil {
+		logger.Warn("failed to register heartbeat publisher metrics",
+			"client_app_id", opts.AppID,
+			"err", err,
+		)
+	}
+
+	for _, target := range opts.Targets {
+		addr, err := net.ResolveUDPAddr("udp", target)
+		if err != nil {
+			return nil, err
+		}
+		p.targets = append(p.targets, addr)
+	}
+	if p.conn, err = net.ListenUDP("udp", nil); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Run - send beats to every target until ctx is done or the publisher is closed, returns
+// ctx.Err() or nil after Close. Only one Run at a time, a second returns an error
+func (p *UDPPublisher) Run(ctx context.Context) error {
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	if p.running {
+		p.mu.Unlock()
+		return errPublisherRunning
+	}
+	p.running = true
+	p.wg.Add(1)
+	defer p.wg.Done()
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.running = false
+		p.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			p.send(false)
+			timer.Reset(p.opts.nextInterval())
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.closing:
+			return nil
+		}
+	}
+}
+
+// Close - stop Run, send a leave to every target so the nodes remove this publisher at once
+// (unless it's lost) whether or not Run ever ran, then close the socket
+func (p *UDPPublisher) Close() error {
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.closing)
+	p.mu.Unlock()
+	p.wg.Wait()
+
+	p.send(true)
+	return p.conn.Close()
+}
+
+// send - send a single beat to every target, counting it as sent or failed for each
+func (p *UDPPublisher) send(leave bool) {
+
+	p.seq++
+	beat := &failproto.Beat{ClientID: p.opts.AppID, Addr: p.opts.Addr, Seq: p.seq, Leave: leave}
+	if p.opts.SigningKey != nil {
+		SignBeat(beat, p.opts.SigningKey, time.Now())
+	}
+
+	datagram, err := proto.Marshal(beat)
+	if err == nil && len(datagram) > MaxUDPBeatSize {
+		err = fmt.Errorf("beat is %d bytes, over MaxUDPBeatSize", len(datagram))
+	}
+
+	for i, addr := range p.targets {
+		var sendErr error = err
+		if sendErr == nil {
+			_, sendErr = p.conn.WriteToUDP(datagram, addr)
+		}
+
+		var result string = "sent"
+		if sendErr != nil {
+			result = "failed"
+			p.logger.Warn("failed to send heartbeat datagram",
+				"client_app_id", p.opts.AppID,
+				"target", p.opts.Targets[i],
+				"err", sendErr,
+			)
+		}
+		p.metrics.beats.WithLabelValues(p.opts.AppID, p.opts.Targets[i], result).Inc()
+	}
+}
@@ -0,0 +1,222 @@
+package failure
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	failproto "github.com/dmw2151/go-failure/proto"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+// serveUDP - serve n's heartbeats on a loopback UDP socket, returns its address
+func serveUDP(t testing.TB, n *Node) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- n.ServeUDP(conn) }()
+	t.Cleanup(func() {
+		conn.Close()
+		assert.NoError(t, <-done)
+	})
+	return conn.LocalAddr().String()
+}
+
+// dialUDP - socket sending datagrams to addr
+func dialUDP(t testing.TB, addr string) net.Conn {
+	conn, err := net.Dial("udp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// sendDatagram - encode beat into a single datagram on conn
+func sendDatagram(t testing.TB, conn net.Conn, beat *failproto.Beat) {
+	datagram, err := proto.Marshal(beat)
+	require.NoError(t, err)
+	_, err = conn.Write(datagram)
+	require.NoError(t, err)
+}
+
+// arrivalCounter - Observer counting heartbeat arrivals
+type arrivalCounter struct {
+	arrivals atomic.Int64
+}
+
+func (c *arrivalCounter) ObserveHeartbeat(HeartbeatEvent)   { c.arrivals.Add(1) }
+func (c *arrivalCounter) ObserveTransition(TransitionEvent) {}
+
+func TestUDPHeartbeats(t *testing.T) {
+
+	var (
+		n, _     = newTestNode(&NodeOptions{})
+		counter  = &arrivalCounter{}
+		conn     = dialUDP(t, serveUDP(t, n))
+		clientID = conn.LocalAddr().String()
+	)
+	n.AddObserver(counter)
+
+	for seq := uint64(1); seq <= 3; seq++ {
+		sendDatagram(t, conn, &failproto.Beat{ClientID: "worker", Addr: "10.0.0.1:8080", Seq: seq})
+	}
+	require.Eventually(t, func() bool { return counter.arrivals.Load() == 3 }, 5*time.Second, 5*time.Millisecond)
+
+	status, ok := n.Client(clientID)
+	require.True(t, ok)
+	assert.Equal(t, "worker", status.AppID)
+	assert.Equal(t, "10.0.0.1:8080", status.Addr)
+
+	// garbage && oversized datagrams are rejected, the listener keeps going
+	_, err := conn.Write([]byte{0xff, 0xff, 0xff})
+	require.NoError(t, err)
+	sendDatagram(t, conn, &failproto.Beat{ClientID: string(make([]byte, MaxUDPBeatSize))})
+	require.Eventually(t, func() bool { return rejected(n, "malformed") == 2 }, 5*time.Second, 5*time.Millisecond)
+
+	sendDatagram(t, conn, &failproto.Beat{ClientID: "worker", Seq: 4, Leave: true})
+	require.Eventually(t, func() bool {
+		_, ok := n.Client(clientID)
+		return !ok
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestUDPHeartbeatsAuth(t *testing.T) {
+
+	var (
+		n, clock = newTestNode(&NodeOptions{
+			Logger:    NopLogger(),
+			Auth:      &AuthOptions{Mode: AuthHMAC, Keys: NewKeyRing(map[string][]byte{testKey.ID: testKey.Secret})},
+			RateLimit: &RateLimitOptions{PerClient: 1},
+		})
+		conn = dialUDP(t, serveUDP(t, n))
+	)
+
+	sendDatagram(t, conn, &failproto.Beat{ClientID: "worker", Addr: "10.0.0.1:8080", Seq: 1})
+	require.Eventually(t, func() bool { return rejected(n, "unsigned") == 1 }, 5*time.Second, 5*time.Millisecond)
+	assert.Empty(t, n.Clients())
+
+	// limits apply to UDP senders too
+	clock.Advance(time.Second)
+	sendDatagram(t, conn, signedBeat("10.0.0.1:8080", 2, testKey, clock.Now()))
+	sendDatagram(t, conn, signedBeat("10.0.0.1:8080", 3, testKey, clock.Now()))
+	require.Eventually(t, func() bool { return limited(n, "client", "rejected") == 1 }, 5*time.Second, 5*time.Millisecond)
+	_, ok := n.Client(conn.LocalAddr().String())
+	assert.True(t, ok)
+}
+
+func TestUDPPublisher(t *testing.T) {
+
+	n := newCallerNode()
+	addr := serveUDP(t, n)
+
+	p, err := NewUDPPublisher(&PublisherOptions{
+		AppID:      "worker",
+		Addr:       "10.0.0.1:8080",
+		SigningKey: testKey,
+		Targets:    []string{addr},
+		Interval:   10 * time.Millisecond,
+		Logger:     NopLogger(),
+		Metrics:    &MetricsOptions{Registerer: prometheus.NewRegistry()},
+	})
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- p.Run(context.Background()) }()
+	status := eventuallyClient(t, n, 3)
+	assert.Equal(t, "10.0.0.1:8080", status.Addr)
+	assert.ErrorIs(t, p.Run(context.Background()), errPublisherRunning)
+
+	// leaving removes the publisher at once
+	require.NoError(t, p.Close())
+	require.NoError(t, <-done)
+	require.Eventually(t, func() bool { return len(n.Clients()) == 0 }, 5*time.Second, 5*time.Millisecond)
+	assert.NoError(t, p.Close())
+}
+
+// BenchmarkHeartbeatTransport - beats/s a node takes in from a single sender on loopback, over
+// UDP datagrams vs. a gRPC heartbeat stream. UDP has no flow control, so the sender keeps at
+// most udpInFlight beats unprocessed (as a socket buffer's worth of publishers would), beats
+// lost anyway are reported as lost/op
+func BenchmarkHeartbeatTransport(b *testing.B) {
+
+	const udpInFlight int64 = 128
+
+	// newNode - node counting arrivals on wall time, w/o auth or limits
+	newNode := func(b *testing.B) (*Node, *arrivalCounter) {
+		n := NewFailureDetectorNode(&NodeOptions{
+			EstimationWindowSize: 100,
+			Logger:               NopLogger(),
+			Metrics:              &MetricsOptions{Registerer: prometheus.NewRegistry()},
+		}, &NodeMetadata{AppID: "test-node"})
+		counter := &arrivalCounter{}
+		n.AddObserver(counter)
+		return n, counter
+	}
+
+	// report - wait for the node to stop receiving, then report the rate it received at
+	report := func(b *testing.B, counter *arrivalCounter, start time.Time) {
+		var last int64 = -1
+		for received := counter.arrivals.Load(); received != last && received < int64(b.N); received = counter.arrivals.Load() {
+			last = received
+			time.Sleep(50 * time.Millisecond)
+		}
+		b.StopTimer()
+
+		received := counter.arrivals.Load()
+		b.ReportMetric(float64(received)/time.Since(start).Seconds(), "beats/s")
+		b.ReportMetric(float64(int64(b.N)-received)/float64(b.N), "lost/op")
+	}
+
+	b.Run("udp", func(b *testing.B) {
+		n, counter := newNode(b)
+		conn := dialUDP(b, serveUDP(b, n))
+		datagram, err := proto.Marshal(&failproto.Beat{ClientID: "worker", Seq: 1})
+		require.NoError(b, err)
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			conn.Write(datagram)
+			for deadline := time.Now().Add(10 * time.Millisecond); int64(i+1)-counter.arrivals.Load() >= udpInFlight && time.Now().Before(deadline); {
+				time.Sleep(10 * time.Microsecond)
+			}
+		}
+		report(b, counter, start)
+	})
+
+	b.Run("grpc", func(b *testing.B) {
+		n, counter := newNode(b)
+		addr, _ := serveHeartbeats(b, n, "127.0.0.1:0")
+		conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(b, err)
+		defer conn.Close()
+
+		stream, err := failproto.NewHeartbeatClient(conn).Stream(context.Background())
+		require.NoError(b, err)
+		go func() {
+			for {
+				if _, err := stream.Recv(); err != nil {
+					return
+				}
+			}
+		}()
+
+		b.ReportAllocs()
+		b.ResetTimer()
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			stream.Send(&failproto.Beat{ClientID: "worker", Seq: uint64(i + 1)})
+		}
+		report(b, counter, start)
+		stream.CloseSend()
+	})
+}